@@ -1,8 +1,11 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
@@ -15,8 +18,19 @@ type Digi4SchoolClient struct {
 	Username string
 	Password string
 	Client   *http.Client
+	// ctx bounds every request of the client.
+	ctx context.Context
 }
 
+var (
+	// ErrInvalidCredentials is returned if Digi4School rejected the username or password.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrLocked is returned if the account is locked, e.g. after too many failed logins.
+	ErrLocked = errors.New("account locked")
+	// ErrNetwork is returned if Digi4School could not be reached.
+	ErrNetwork = errors.New("network error")
+)
+
 type BookCookies struct {
 	Digi4Bname  string
 	Digi4Bvalue string
@@ -25,12 +39,13 @@ type BookCookies struct {
 	SubPath     string
 }
 
-func NewDigi4SClient(username, password string) *Digi4SchoolClient {
+func NewDigi4SClient(ctx context.Context, username, password string) *Digi4SchoolClient {
 	transport := http.DefaultTransport
 	jar, _ := cookiejar.New(nil)
 	return &Digi4SchoolClient{
 		Username: username,
 		Password: password,
+		ctx:      ctx,
 		Client: &http.Client{
 			Jar: jar,
 			CheckRedirect: func(req *http.Request, via []*http.Request) error {
@@ -57,7 +72,7 @@ func (c *Digi4SchoolClient) Login() error {
 		"Origin":           "https://digi4school.at",
 	}
 
-	req, err := http.NewRequest("POST", baseUrl, strings.NewReader(payload.Encode()))
+	req, err := http.NewRequestWithContext(c.ctx, "POST", baseUrl, strings.NewReader(payload.Encode()))
 	if err != nil {
 		return err
 	}
@@ -67,8 +82,11 @@ func (c *Digi4SchoolClient) Login() error {
 	}
 
 	resp, err := c.Client.Do(req)
+	if c.ctx.Err() != nil {
+		return c.ctx.Err()
+	}
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %v", ErrNetwork, err)
 	}
 	defer resp.Body.Close()
 
@@ -77,7 +95,21 @@ func (c *Digi4SchoolClient) Login() error {
 			return nil
 		}
 	}
-	return fmt.Errorf("login failed")
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%w: %s", ErrNetwork, resp.Status)
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusTooManyRequests || isLockedMessage(string(body)) {
+		return ErrLocked
+	}
+	return ErrInvalidCredentials
+}
+
+// isLockedMessage detects the message Digi4School shows for locked accounts.
+func isLockedMessage(body string) bool {
+	body = strings.ToLower(body)
+	return strings.Contains(body, "gesperrt") || strings.Contains(body, "locked")
 }
 func (c *Digi4SchoolClient) Logout() error {
 	baseUrl := "https://digi4school.at/br/logout"
@@ -89,7 +121,7 @@ func (c *Digi4SchoolClient) Logout() error {
 		"Referer":         "https://digi4school.at/",
 	}
 
-	req, err := http.NewRequest("GET", baseUrl, nil)
+	req, err := http.NewRequestWithContext(c.ctx, "GET", baseUrl, nil)
 	if err != nil {
 		return err
 	}
@@ -108,7 +140,7 @@ func (c *Digi4SchoolClient) Logout() error {
 }
 func (c *Digi4SchoolClient) GetBooks() ([]structs.Book, error) {
 	baseURL := "https://digi4school.at/br/xhr/v2/synch"
-	req, err := http.NewRequest("GET", baseURL, nil)
+	req, err := http.NewRequestWithContext(c.ctx, "GET", baseURL, nil)
 	if err != nil {
 		return nil, err
 	}
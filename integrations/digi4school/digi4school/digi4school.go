@@ -0,0 +1,138 @@
+// Package digi4school is the entry point of the integration. The Paperlink server uses
+// it in-process, the d4s command is a thin wrapper around it.
+package digi4school
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"paperlink_d4s/client"
+	"paperlink_d4s/downloader"
+	"paperlink_d4s/progress"
+	"paperlink_d4s/structs"
+	"strings"
+)
+
+type Integration struct {
+	opts downloader.Options
+}
+
+func New(opts downloader.Options) *Integration {
+	return &Integration{opts: opts}
+}
+
+// TestLogin returns nil if the credentials work. Otherwise the error wraps
+// client.ErrInvalidCredentials, client.ErrLocked or client.ErrNetwork.
+func (i *Integration) TestLogin(ctx context.Context, username, password string) error {
+	c := client.NewDigi4SClient(ctx, username, password)
+	if err := c.Login(); err != nil {
+		return err
+	}
+	_ = c.Logout()
+	return nil
+}
+
+// ListBooks returns the books of the account that are not expired.
+func (i *Integration) ListBooks(ctx context.Context, username, password string) ([]structs.Book, error) {
+	c := client.NewDigi4SClient(ctx, username, password)
+	defer c.Logout()
+
+	if err := c.Login(); err != nil {
+		return nil, err
+	}
+	return c.GetBooks()
+}
+
+// Metadata resolves the current metadata of the books. Books that fail are left out of
+// the result and reported in the joined error.
+func (i *Integration) Metadata(ctx context.Context, username, password string, ids []string) ([]downloader.Metadata, error) {
+	c := client.NewDigi4SClient(ctx, username, password)
+	defer c.Logout()
+
+	if err := c.Login(); err != nil {
+		return nil, err
+	}
+	books, err := c.GetBooks()
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[strings.TrimSpace(id)] = true
+	}
+
+	var errs []error
+	result := make([]downloader.Metadata, 0, len(wanted))
+	for _, b := range books {
+		if !wanted[b.DataId] {
+			continue
+		}
+		meta, err := downloader.BookMetadata(ctx, &b, c.GetCurrentDigi4sCookie(), i.opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("book %s: %w", b.DataId, err))
+			continue
+		}
+		result = append(result, meta)
+	}
+	return result, errors.Join(errs...)
+}
+
+// Download downloads the books of the account, targets maps the book id to the output
+// path. The progress is reported to sink. A failed book does not stop the remaining
+// ones, cancelling ctx does.
+func (i *Integration) Download(ctx context.Context, username, password string, targets map[string]string, sink progress.Sink) error {
+	c := client.NewDigi4SClient(ctx, username, password)
+	defer c.Logout()
+
+	if err := c.Login(); err != nil {
+		return err
+	}
+
+	books, err := c.GetBooks()
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for id, path := range targets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+
+		found := false
+		for _, b := range books {
+			if b.DataId == id {
+				found = true
+				report := progress.NewReporter(sink, b.DataId, b.Name)
+
+				if err := downloader.DownloadBook(ctx, &b, path, c.GetCurrentDigi4sCookie(), report, i.opts); err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					// A broken book should not keep the remaining ones from downloading.
+					report.Fatal(err)
+					failed++
+					break
+				}
+				report.Finished(path)
+				break
+			}
+		}
+
+		if !found {
+			progress.Warn(sink, "book with id %s not found", id)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d books failed", failed, len(targets))
+	}
+	return nil
+}
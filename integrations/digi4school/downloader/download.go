@@ -1,22 +1,41 @@
 package downloader
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/pdfcpu/pdfcpu/pkg/api"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
-	"os"
 	"paperlink_d4s/downloader/helper"
-	"paperlink_d4s/downloader/types"
+	"paperlink_d4s/downloader/publisher"
+	"paperlink_d4s/progress"
 	"paperlink_d4s/structs"
 	"path/filepath"
-	"sort"
 	"strings"
+	"sync"
 )
 
-func DownloadBook(book *structs.Book, outputPath string, digi4sCookie string) error {
+// Metadata describes the current remote state of a book, used to detect updates.
+type Metadata struct {
+	DataId string `json:"dataId"`
+	Name   string `json:"name"`
+	Pages  int    `json:"pages"`
+	// Publisher is the name of the adapter that serves the book.
+	Publisher string `json:"publisher"`
+}
+
+func newBookClient(ctx context.Context, digi4sCookie string, opts Options) *http.Client {
 	client := &http.Client{
+		Transport: &helper.ContextTransport{
+			Ctx: ctx,
+			Base: &helper.RetryTransport{
+				Limiter: helper.NewTokenBucket(opts.RateLimit, opts.Concurrency),
+				Retries: opts.Retries,
+				Backoff: opts.Backoff,
+			},
+		},
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
@@ -27,55 +46,73 @@ func DownloadBook(book *structs.Book, outputPath string, digi4sCookie string) er
 	client.Jar.SetCookies(uri, []*http.Cookie{
 		{Name: "digi4s", Value: digi4sCookie},
 	})
+	return client
+}
+
+// openBook runs the LTI chain of the book and opens it at its publisher.
+func openBook(ctx context.Context, book *structs.Book, digi4sCookie string, opts Options) (publisher.Publisher, publisher.Book, error) {
+	client := newBookClient(ctx, digi4sCookie, opts)
 
 	data, _, lastURL, location, err := helper.GetLastLTI(client, book.DataCode)
 	if err != nil {
-		return nil
+		return nil, nil, fmt.Errorf("failed to resolve book source: %w", err)
+	}
+	p, err := publisher.ForLaunch(book.EbookPlus, lastURL)
+	if err != nil {
+		return nil, nil, err
 	}
-	tmp, err := os.MkdirTemp("", "bookdl_*")
+	opened, err := p.Open(client, publisher.Launch{Endpoint: lastURL, Location: location, Body: data})
 	if err != nil {
-		return fmt.Errorf("failed to create temp dir: %w", err)
+		return nil, nil, fmt.Errorf("failed to open book at %s: %w", p.Name(), err)
 	}
-	defer os.RemoveAll(tmp)
+	return p, opened, nil
+}
 
-	current, err := os.Getwd()
+// BookMetadata resolves the book source and counts its pages without downloading them.
+func BookMetadata(ctx context.Context, book *structs.Book, digi4sCookie string, opts Options) (Metadata, error) {
+	meta := Metadata{DataId: book.DataId, Name: book.Name}
+	_, opened, err := openBook(ctx, book, digi4sCookie, opts)
+	if err != nil {
+		return meta, err
+	}
+	remote, err := opened.Metadata()
 	if err != nil {
-		return fmt.Errorf("failed to get current dir: %w", err)
+		return meta, err
 	}
-	defer os.Chdir(current)
+	meta.Publisher = remote.Publisher
+	meta.Pages = remote.Pages
+	return meta, nil
+}
 
-	var files []string
-	if book.EbookPlus {
-		if lastURL == "https://a.hpthek.at/lti" {
-			files, err = types.DownloadD4sBook(client, tmp, location)
-			if err != nil {
-				return fmt.Errorf("failed to download book: %w", err)
-			}
-		} else if lastURL == "https://mein.westermann.de/auth/gateway/d4s" {
-			files, err = types.DownloadBiboxBook(client, location, tmp)
-			if err != nil {
-				return fmt.Errorf("failed to download book: %w", err)
-			}
-		} else if lastURL == "https://service.helbling.com/ebookplus" {
-			files, err = types.DownloadHeblingBook(client, data, tmp)
-			if err != nil {
-				return fmt.Errorf("failed to download book: %w", err)
-			}
-		} else {
-			return fmt.Errorf("book source not supported")
-		}
-	} else {
-		files, err = types.DownloadD4sBook(client, tmp, location)
-		if err != nil {
-			return fmt.Errorf("failed to download book: %w", err)
-		}
+// DownloadBook downloads the book into outputPath. Cancelling ctx stops the download,
+// the pages done so far stay in the work dir for the next attempt.
+func DownloadBook(ctx context.Context, book *structs.Book, outputPath string, digi4sCookie string, report *progress.Reporter, opts Options) error {
+	p, opened, err := openBook(ctx, book, digi4sCookie, opts)
+	if err != nil {
+		return err
+	}
+	outputPath, err = filepath.Abs(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve output path: %w", err)
+	}
+	// Pages are kept in a work dir per book until the book is assembled, so a stopped
+	// or crashed download resumes where it left off.
+	state, err := helper.LoadWorkState(helper.WorkDirFor(outputPath))
+	if err != nil {
+		return err
+	}
+	if len(state.Pages) > 0 {
+		report.Warn("resuming download with %d pages already done", len(state.Pages))
 	}
 
-	sort.Strings(files)
+	files, err := downloadPages(ctx, opened, state, report, opts.Concurrency)
+	if err != nil {
+		return fmt.Errorf("failed to download book from %s: %w", p.Name(), err)
+	}
 
 	switch strings.ToLower(filepath.Ext(outputPath)) {
 	case ".pdf":
-		mergedPath := filepath.Join(tmp, "merged.pdf")
+		mergedPath := filepath.Join(state.Dir(), "merged.pdf")
 		err = api.MergeCreateFile(files, mergedPath, false, nil)
 		if err != nil {
 			return fmt.Errorf("failed to write merged pdf: %w", err)
@@ -90,5 +127,116 @@ func DownloadBook(book *structs.Book, outputPath string, digi4sCookie string) er
 	default:
 		return fmt.Errorf("unsupported output format %q", filepath.Ext(outputPath))
 	}
+	if err := state.Remove(); err != nil {
+		report.Warn("failed to remove work dir: %v", err)
+	}
 	return nil
 }
+
+type pageResult struct {
+	page int
+	file string
+	err  error
+}
+
+// downloadPages downloads every page that is not in the work dir yet with a pool of
+// workers and returns the page pdfs in page order. The work state is only touched by
+// the collecting goroutine.
+func downloadPages(ctx context.Context, book publisher.Book, state *helper.WorkState, report *progress.Reporter, concurrency int) ([]string, error) {
+	meta, err := book.Metadata()
+	if err != nil {
+		return nil, err
+	}
+	concurrency = max(concurrency, 1)
+
+	files := make([]string, meta.Pages+1)
+	done := 0
+	for page := 1; page <= meta.Pages; page++ {
+		if file, ok := state.Done(page); ok {
+			files[page] = file
+			done++
+		}
+	}
+	if done > 0 {
+		report.Page(done, meta.Pages)
+	}
+
+	jobs := make(chan int)
+	results := make(chan pageResult)
+	stop := make(chan struct{})
+
+	var workers sync.WaitGroup
+	for range concurrency {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for page := range jobs {
+				file, err := book.DownloadPage(page, state.Dir())
+				results <- pageResult{page: page, file: file, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for page := 1; page <= meta.Pages; page++ {
+			if files[page] != "" {
+				continue
+			}
+			select {
+			case jobs <- page:
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	var firstErr error
+	var stopOnce sync.Once
+	abort := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+		stopOnce.Do(func() { close(stop) })
+	}
+	for result := range results {
+		switch {
+		case errors.Is(result.err, publisher.ErrSkipPage):
+			report.Warn("skipping page %d: %v", result.page, result.err)
+		case errors.Is(result.err, publisher.ErrNoPage):
+			report.Warn("page %d of %d does not exist", result.page, meta.Pages)
+		case result.err != nil:
+			abort(fmt.Errorf("page %d: %w", result.page, result.err))
+		default:
+			if err := state.MarkDone(result.page, result.file); err != nil {
+				abort(err)
+				continue
+			}
+			files[result.page] = result.file
+			done++
+			report.Page(done, meta.Pages)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	ordered := make([]string, 0, done)
+	for _, file := range files[1:] {
+		if file != "" {
+			ordered = append(ordered, file)
+		}
+	}
+	if len(ordered) == 0 {
+		return nil, fmt.Errorf("book has no pages")
+	}
+	return ordered, nil
+}
@@ -0,0 +1,127 @@
+package downloader
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"paperlink_d4s/downloader/helper"
+	"paperlink_d4s/downloader/publisher"
+	"paperlink_d4s/progress"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeBook finishes its pages in random order.
+type fakeBook struct {
+	pages     int
+	skip      int
+	inFlight  atomic.Int32
+	maxFlight atomic.Int32
+
+	mu        sync.Mutex
+	requested []int
+}
+
+func (b *fakeBook) Metadata() (publisher.Metadata, error) {
+	return publisher.Metadata{Publisher: "fake", Pages: b.pages}, nil
+}
+
+func (b *fakeBook) DownloadPage(page int, dir string) (string, error) {
+	b.mu.Lock()
+	b.requested = append(b.requested, page)
+	b.mu.Unlock()
+
+	n := b.inFlight.Add(1)
+	defer b.inFlight.Add(-1)
+	for {
+		m := b.maxFlight.Load()
+		if n <= m || b.maxFlight.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	time.Sleep(time.Duration(rand.IntN(3)) * time.Millisecond)
+
+	if page == b.skip {
+		return "", publisher.ErrSkipPage
+	}
+	file := filepath.Join(dir, fmt.Sprintf("%05d.pdf", page))
+	return file, os.WriteFile(file, []byte{byte(page)}, 0600)
+}
+
+func TestDownloadPagesKeepsPageOrder(t *testing.T) {
+	state, err := helper.LoadWorkState(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	book := &fakeBook{pages: 40, skip: 7}
+
+	files, err := downloadPages(t.Context(), book, state, &progress.Reporter{}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 39 {
+		t.Fatalf("got %d files, want 39", len(files))
+	}
+	for i, file := range files {
+		page := i + 1
+		if page >= 7 {
+			page++
+		}
+		if want := filepath.Join(state.Dir(), fmt.Sprintf("%05d.pdf", page)); file != want {
+			t.Fatalf("file %d is %s, want %s", i, file, want)
+		}
+	}
+	if book.maxFlight.Load() > 4 {
+		t.Errorf("%d pages downloaded at once, want at most 4", book.maxFlight.Load())
+	}
+
+	// A second run resumes from the work state. Only the skipped page is requested again.
+	resumed, err := helper.LoadWorkState(state.Dir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resumed.Pages) != 39 {
+		t.Errorf("work state has %d pages, want 39", len(resumed.Pages))
+	}
+	again := &fakeBook{pages: 40, skip: 7}
+	resumedFiles, err := downloadPages(t.Context(), again, resumed, &progress.Reporter{}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(again.requested, []int{7}) {
+		t.Errorf("second run requested pages %v, want only the skipped page 7", again.requested)
+	}
+	if !slices.Equal(resumedFiles, files) {
+		t.Errorf("second run returned %v, want %v", resumedFiles, files)
+	}
+}
+
+func TestDownloadPagesResumeRequestsNoPages(t *testing.T) {
+	state, err := helper.LoadWorkState(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := downloadPages(t.Context(), &fakeBook{pages: 12}, state, &progress.Reporter{}, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, err := helper.LoadWorkState(state.Dir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	again := &fakeBook{pages: 12}
+	files, err := downloadPages(t.Context(), again, resumed, &progress.Reporter{}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.requested) != 0 {
+		t.Errorf("second run requested pages %v, want none", again.requested)
+	}
+	if len(files) != 12 {
+		t.Errorf("got %d files, want 12", len(files))
+	}
+}
@@ -6,15 +6,16 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
 
-func downloadEmbeddedAsset(url string, matches [][]string, client *http.Client) error {
+func downloadEmbeddedAsset(url string, matches [][]string, client *http.Client, dir string) error {
 	trimmedURL := url[:strings.LastIndex(url, "/")+1]
 	for _, match := range matches {
 		if len(match) > 1 {
-			if err := downloadFile(trimmedURL+match[1], client); err != nil {
+			if err := downloadFile(trimmedURL+match[1], client, dir); err != nil {
 				return fmt.Errorf("failed to download embedded asset %s: %w", match[1], err)
 			}
 		}
@@ -22,7 +23,7 @@ func downloadEmbeddedAsset(url string, matches [][]string, client *http.Client)
 	return nil
 }
 
-func downloadFile(url string, client *http.Client) error {
+func downloadFile(url string, client *http.Client, dir string) error {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request for %s: %w", url, err)
@@ -34,7 +35,7 @@ func downloadFile(url string, client *http.Client) error {
 	}
 	defer resp.Body.Close()
 
-	dirname := getDirName(url)
+	dirname := filepath.Join(dir, getDirName(url))
 	if dirname != "" {
 		if _, err := os.Stat(dirname); os.IsNotExist(err) {
 			if err := os.MkdirAll(dirname, 0700); err != nil {
@@ -43,7 +44,7 @@ func downloadFile(url string, client *http.Client) error {
 		}
 	}
 
-	filePath := path.Join(dirname, path.Base(url))
+	filePath := filepath.Join(dirname, path.Base(url))
 	file, err := os.Create(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to create file %s: %w", filePath, err)
@@ -57,7 +58,9 @@ func downloadFile(url string, client *http.Client) error {
 	return nil
 }
 
-func DownloadOnePage(url string, client *http.Client, subPath bool) (string, bool, error) {
+// DownloadOnePage downloads the svg page and its embedded images into dir. The returned
+// file name is relative to dir.
+func DownloadOnePage(url string, client *http.Client, subPath bool, dir string) (string, bool, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return "", false, fmt.Errorf("failed to create request for %s: %w", url, err)
@@ -82,7 +85,7 @@ func DownloadOnePage(url string, client *http.Client, subPath bool) (string, boo
 	if strings.Contains(bodyString, "image") {
 		matches := checkForEmbeddedImages(bodyString)
 		if len(matches) > 0 {
-			if err := downloadEmbeddedAsset(url, matches, client); err != nil {
+			if err := downloadEmbeddedAsset(url, matches, client, dir); err != nil {
 				return "", false, fmt.Errorf("failed to download embedded images for %s: %w", url, err)
 			}
 		}
@@ -98,13 +101,13 @@ func DownloadOnePage(url string, client *http.Client, subPath bool) (string, boo
 	if subPath {
 		pageDir := normalizePageDir(parts[0])
 		filename = pageDir + "/" + filename
-		err := os.MkdirAll(pageDir, 0700)
+		err := os.MkdirAll(filepath.Join(dir, pageDir), 0700)
 		if err != nil {
 			return "", false, fmt.Errorf("failed to create directory %s: %w", pageDir, err)
 		}
 	}
 
-	file, err := os.Create(filename)
+	file, err := os.Create(filepath.Join(dir, filename))
 	if err != nil {
 		return "", false, fmt.Errorf("failed to create file %s: %w", filename, err)
 	}
@@ -0,0 +1,66 @@
+package helper
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// maxPages bounds the page count search of books that do not tell their page count.
+const maxPages = 10000
+
+// CountPages finds the page count of a book whose pages are numbered from 1 without
+// gaps. It probes exponentially growing page numbers and bisects the last gap, so only
+// a few requests are needed even for large books.
+func CountPages(exists func(page int) (bool, error)) (int, error) {
+	ok, err := exists(1)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	low, high := 1, 2
+	for {
+		if high > maxPages {
+			return 0, fmt.Errorf("book has more than %d pages", maxPages)
+		}
+		ok, err := exists(high)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		low, high = high, high*2
+	}
+
+	// low exists, high does not.
+	for high-low > 1 {
+		mid := (low + high) / 2
+		ok, err := exists(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return low, nil
+}
+
+// PageExists checks if the page url can be fetched.
+func PageExists(c *http.Client, url string) (bool, error) {
+	resp, err := c.Get(url)
+	if err != nil {
+		return false, fmt.Errorf("failed to get page %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("unexpected status %s for page %s", resp.Status, url)
+}
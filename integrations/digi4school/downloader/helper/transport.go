@@ -0,0 +1,130 @@
+package helper
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TokenBucket limits the request rate to the publisher. It holds up to burst tokens
+// and refills rate tokens per second.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait blocks until a token is available. A nil bucket does not limit.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	if b == nil || b.rate <= 0 {
+		return nil
+	}
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// maxRetryAfter caps the Retry-After wait a publisher can ask for.
+const maxRetryAfter = time.Minute
+
+// RetryTransport rate limits the requests and retries idempotent ones that failed with
+// a transient error, waiting Backoff, 2*Backoff, 4*Backoff, ... in between.
+type RetryTransport struct {
+	Base    http.RoundTripper
+	Limiter *TokenBucket
+	Retries int
+	Backoff time.Duration
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	retryable := req.Method == http.MethodGet || req.Method == http.MethodHead
+
+	for attempt := 0; ; attempt++ {
+		if err := t.Limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+		resp, err := base.RoundTrip(req)
+		if !retryable || attempt >= t.Retries || !isTransient(req.Context(), resp, err) {
+			return resp, err
+		}
+
+		wait := t.Backoff << attempt
+		if resp != nil {
+			if after, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil {
+				wait = max(wait, min(time.Duration(after)*time.Second, maxRetryAfter))
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func isTransient(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// ContextTransport binds every request to Ctx, so cancelling it aborts all requests of
+// a download, including those the publisher adapters create without a context.
+type ContextTransport struct {
+	Ctx  context.Context
+	Base http.RoundTripper
+}
+
+func (t *ContextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.Base.RoundTrip(req.WithContext(t.Ctx))
+}
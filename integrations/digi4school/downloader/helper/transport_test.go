@@ -0,0 +1,56 @@
+package helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryTransportRetriesTransientErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c := &http.Client{Transport: &RetryTransport{Retries: 3, Backoff: time.Millisecond}}
+	resp, err := c.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Errorf("got status %d after %d calls, want 200 after 3", resp.StatusCode, calls.Load())
+	}
+
+	// POST requests are not idempotent and never retried.
+	calls.Store(0)
+	resp, err = c.Post(server.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if calls.Load() != 1 {
+		t.Errorf("POST was sent %d times, want 1", calls.Load())
+	}
+}
+
+func TestTokenBucketLimitsRate(t *testing.T) {
+	bucket := NewTokenBucket(100, 1)
+	start := time.Now()
+	for range 6 {
+		if err := bucket.Wait(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first token is available right away, the next five take 10ms each.
+	if elapsed := time.Since(start); elapsed < 45*time.Millisecond {
+		t.Errorf("6 requests took %v, want at least 50ms", elapsed)
+	}
+}
@@ -0,0 +1,98 @@
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const workStateFile = "progress.json"
+
+// WorkState records the pages of a book that are already downloaded and converted, so
+// an interrupted download can resume from the last completed page.
+type WorkState struct {
+	dir string
+	// Pages maps the page number to the converted page pdf, relative to the work dir.
+	Pages map[int]string `json:"pages"`
+}
+
+// LoadWorkState reads the state of the work dir, creating the dir if needed. Pages
+// whose file went missing are dropped and downloaded again.
+func LoadWorkState(dir string) (*WorkState, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create work dir %s: %w", dir, err)
+	}
+	state := &WorkState{dir: dir, Pages: make(map[int]string)}
+
+	data, err := os.ReadFile(filepath.Join(dir, workStateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read work state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		// A broken state file only costs a fresh download.
+		return &WorkState{dir: dir, Pages: make(map[int]string)}, nil
+	}
+	for page, file := range state.Pages {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			delete(state.Pages, page)
+		}
+	}
+	return state, nil
+}
+
+// Dir is the directory the pages are downloaded to.
+func (s *WorkState) Dir() string {
+	return s.dir
+}
+
+// Done returns the absolute path of the page pdf if the page was already completed.
+func (s *WorkState) Done(page int) (string, bool) {
+	file, ok := s.Pages[page]
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(s.dir, file), true
+}
+
+// MarkDone records a completed page and persists the state.
+func (s *WorkState) MarkDone(page int, file string) error {
+	rel, err := filepath.Rel(s.dir, file)
+	if err != nil {
+		return fmt.Errorf("page file %s is outside of the work dir: %w", file, err)
+	}
+	s.Pages[page] = rel
+	return s.save()
+}
+
+func (s *WorkState) save() error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	// Write to a temp file first so a crash never leaves a half written state behind.
+	tmp := filepath.Join(s.dir, workStateFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return fmt.Errorf("failed to write work state: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, workStateFile)); err != nil {
+		return fmt.Errorf("failed to store work state: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes the work dir once the book is assembled.
+func (s *WorkState) Remove() error {
+	return os.RemoveAll(s.dir)
+}
+
+// WorkDirFor returns the work dir of the book that is written to outputPath. It lives
+// next to the output and is keyed by its file name, which is the book UUID.
+func WorkDirFor(outputPath string) string {
+	base := filepath.Base(outputPath)
+	return filepath.Join(filepath.Dir(outputPath), ".work", base[:len(base)-len(filepath.Ext(base))])
+}
@@ -0,0 +1,47 @@
+package downloader
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Options tune how hard the publishers are hit.
+type Options struct {
+	// Concurrency is the number of pages of a book downloaded at the same time.
+	Concurrency int
+	// RateLimit is the maximum number of requests per second, 0 disables the limit.
+	RateLimit float64
+	// Retries is the number of retries of requests that failed with a transient error.
+	Retries int
+	// Backoff is the wait before the first retry, it doubles with every retry.
+	Backoff time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Concurrency: 4,
+		RateLimit:   8,
+		Retries:     3,
+		Backoff:     500 * time.Millisecond,
+	}
+}
+
+// OptionsFromEnv reads the options from the PAPERLINK_D4S_* variables the server passes
+// on, falling back to the defaults.
+func OptionsFromEnv() Options {
+	opts := DefaultOptions()
+	if v, err := strconv.Atoi(os.Getenv("PAPERLINK_D4S_CONCURRENCY")); err == nil && v > 0 {
+		opts.Concurrency = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("PAPERLINK_D4S_RATE_LIMIT"), 64); err == nil && v >= 0 {
+		opts.RateLimit = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("PAPERLINK_D4S_RETRIES")); err == nil && v >= 0 {
+		opts.Retries = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("PAPERLINK_D4S_BACKOFF")); err == nil && v > 0 {
+		opts.Backoff = v
+	}
+	return opts
+}
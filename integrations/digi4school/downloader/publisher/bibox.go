@@ -1,4 +1,4 @@
-package types
+package publisher
 
 import (
 	"bytes"
@@ -12,12 +12,19 @@ import (
 	"net/url"
 	"os"
 	"paperlink_d4s/downloader/helper"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 )
 
-type Image struct {
+const biboxName = "bibox"
+
+func init() {
+	Register(bibox{})
+}
+
+type biboxImage struct {
 	ID       int    `json:"id"`
 	Removed  bool   `json:"removed"`
 	Version  int    `json:"version"`
@@ -29,25 +36,36 @@ type Image struct {
 	FileSize int    `json:"filesize"`
 }
 
-type Page struct {
-	ID              int     `json:"id"`
-	Removed         bool    `json:"removed"`
-	Version         int     `json:"version"`
-	Name            string  `json:"name"`
-	InternalPageNum int     `json:"internalPagenum"`
-	BookID          int     `json:"bookId"`
-	Demo            bool    `json:"demo"`
-	Type            string  `json:"type"`
-	AemDorisID      *string `json:"aemDorisID"`
-	Images          []Image `json:"images"`
+type biboxPage struct {
+	ID              int          `json:"id"`
+	Removed         bool         `json:"removed"`
+	Version         int          `json:"version"`
+	Name            string       `json:"name"`
+	InternalPageNum int          `json:"internalPagenum"`
+	BookID          int          `json:"bookId"`
+	Demo            bool         `json:"demo"`
+	Type            string       `json:"type"`
+	AemDorisID      *string      `json:"aemDorisID"`
+	Images          []biboxImage `json:"images"`
 }
 
-type BookPagesResponse struct {
-	Pages []Page `json:"pages"`
+type biboxPagesResponse struct {
+	Pages []biboxPage `json:"pages"`
 }
 
-func DownloadBiboxBook(c *http.Client, location string, downloadPath string) ([]string, error) {
-	loginHint, id, ok := extractLoginInitParams(location)
+// bibox serves the png books of Westermann BiBox.
+type bibox struct{}
+
+func (bibox) Name() string {
+	return biboxName
+}
+
+func (bibox) Match(endpoint string) bool {
+	return endpoint == "https://mein.westermann.de/auth/gateway/d4s"
+}
+
+func (bibox) Open(c *http.Client, launch Launch) (Book, error) {
+	loginHint, id, ok := extractLoginInitParams(launch.Location)
 	if !ok {
 		return nil, fmt.Errorf("failed to extract loginHint")
 	}
@@ -59,54 +77,72 @@ func DownloadBiboxBook(c *http.Client, location string, downloadPath string) ([]
 	if err != nil {
 		return nil, fmt.Errorf("failed to get bibox pages: %w", err)
 	}
-	err = os.Chdir(downloadPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to chdir: %w", err)
+	// The images are served from a CDN that may redirect, which the LTI client does
+	// not follow.
+	images := &http.Client{Transport: c.Transport}
+	return &biboxBook{images: images, pages: pages}, nil
+}
+
+type biboxBook struct {
+	images *http.Client
+	pages  []biboxPage
+}
+
+func (b *biboxBook) Metadata() (Metadata, error) {
+	return Metadata{Publisher: biboxName, Pages: len(b.pages)}, nil
+}
+
+func (b *biboxBook) DownloadPage(page int, dir string) (string, error) {
+	if page < 1 || page > len(b.pages) {
+		return "", ErrNoPage
 	}
-	files := make([]string, 0)
-	page := 1
-	for _, p := range pages {
-		images := p.Images
-		if len(images) == 0 {
-			return nil, fmt.Errorf("no images found for page %d", page)
-		}
-		downloadImage := images[0]
-		// download the higher res version
-		if len(images) == 2 {
-			if images[1].FileSize > images[0].FileSize {
-				downloadImage = images[1]
-			}
+	images := b.pages[page-1].Images
+	if len(images) == 0 {
+		return "", fmt.Errorf("no images found for page %d", page)
+	}
+	downloadImage := images[0]
+	// download the higher res version
+	if len(images) == 2 {
+		if images[1].FileSize > images[0].FileSize {
+			downloadImage = images[1]
 		}
+	}
 
-		number := strings.Repeat("0", 5-len(strconv.Itoa(page))) + strconv.Itoa(page)
-		outputFile := number + ".png"
-		resp, err := http.Get(downloadImage.URL)
-		if err != nil {
-			panic(err)
-		}
-		outFile, err := os.Create(outputFile)
-		if err != nil {
-			panic(err)
-		}
-		_, err = io.Copy(outFile, resp.Body)
-		if err != nil {
-			panic(err)
-		}
-		resp.Body.Close()
-		outFile.Close()
+	number := strings.Repeat("0", 5-len(strconv.Itoa(page))) + strconv.Itoa(page)
+	outputFile := number + ".png"
+	if err := b.fetchImage(downloadImage.URL, filepath.Join(dir, outputFile)); err != nil {
+		return "", err
+	}
 
-		pdf, err := helper.ConvertPNGtoPDF(downloadPath, outputFile, downloadImage.Width, downloadImage.Height)
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert png to pdf: %w", err)
-		}
-		files = append(files, pdf)
-		page++
-		fmt.Printf("PAGE_COUNT: %d\n", page)
+	pdf, err := helper.ConvertPNGtoPDF(dir, outputFile, downloadImage.Width, downloadImage.Height)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert png to pdf: %w", err)
+	}
+	return pdf, nil
+}
+
+func (b *biboxBook) fetchImage(url, path string) error {
+	resp, err := b.images.Get(url)
+	if err != nil {
+		return fmt.Errorf("failed to download image %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download image %s: %s", url, resp.Status)
+	}
+
+	outFile, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	defer outFile.Close()
+	if _, err := io.Copy(outFile, resp.Body); err != nil {
+		return fmt.Errorf("failed to write image %s: %w", path, err)
 	}
-	return files, nil
+	return nil
 }
 
-func getBookPages(c *http.Client, bookID int, jwt string) ([]Page, error) {
+func getBookPages(c *http.Client, bookID int, jwt string) ([]biboxPage, error) {
 	bookUrl := fmt.Sprintf("https://backend.bibox2.westermann.de/v1/api/sync/%d?materialtypes[]=default&materialtypes[]=addon", bookID)
 
 	req, err := http.NewRequest("GET", bookUrl, nil)
@@ -131,7 +167,7 @@ func getBookPages(c *http.Client, bookID int, jwt string) ([]Page, error) {
 		return nil, fmt.Errorf("request failed: %s", body)
 	}
 
-	var result BookPagesResponse
+	var result biboxPagesResponse
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, err
 	}
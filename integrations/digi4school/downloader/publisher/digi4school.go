@@ -0,0 +1,94 @@
+package publisher
+
+import (
+	"fmt"
+	"net/http"
+	"paperlink_d4s/downloader/helper"
+	"strings"
+)
+
+const digi4schoolName = "digi4school"
+
+func init() {
+	Register(digi4school{})
+}
+
+// digi4school serves the plain svg books hosted by Digi4School.
+type digi4school struct{}
+
+func (digi4school) Name() string {
+	return digi4schoolName
+}
+
+func (digi4school) Match(endpoint string) bool {
+	return endpoint == "https://a.hpthek.at/lti"
+}
+
+func (digi4school) Open(c *http.Client, launch Launch) (Book, error) {
+	baseURL := strings.TrimSuffix(launch.Location, "/")
+	subPath, continuingSubPath := withSubPath(c, baseURL)
+	return &digi4schoolBook{
+		c:                 c,
+		baseURL:           baseURL,
+		subPath:           subPath,
+		continuingSubPath: continuingSubPath,
+	}, nil
+}
+
+type digi4schoolBook struct {
+	c                 *http.Client
+	baseURL           string
+	subPath           bool
+	continuingSubPath bool
+}
+
+func (b *digi4schoolBook) Metadata() (Metadata, error) {
+	pages, err := helper.CountPages(func(page int) (bool, error) {
+		return helper.PageExists(b.c, b.pageURL(page))
+	})
+	if err != nil {
+		return Metadata{}, fmt.Errorf("failed to count pages: %w", err)
+	}
+	return Metadata{Publisher: digi4schoolName, Pages: pages}, nil
+}
+
+func (b *digi4schoolBook) DownloadPage(page int, dir string) (string, error) {
+	filename, endReached, err := helper.DownloadOnePage(b.pageURL(page), b.c, b.subPath, dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to download page: %w", err)
+	}
+	if endReached {
+		return "", ErrNoPage
+	}
+	outputPDF, err := svgToPDF(dir, filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert svg to pdf: %w", err)
+	}
+	return outputPDF, nil
+}
+
+func (b *digi4schoolBook) pageURL(page int) string {
+	if b.continuingSubPath {
+		return fmt.Sprintf("%s/%d/%d.svg", b.baseURL, page, page)
+	} else if b.subPath {
+		return fmt.Sprintf("%s/1/%d.svg", b.baseURL, page)
+	}
+	return fmt.Sprintf("%s/%d.svg", b.baseURL, page)
+}
+
+func withSubPath(c *http.Client, baseURL string) (bool, bool) {
+	resp, err := c.Get(baseURL + "/1/1.svg")
+	if err != nil {
+		return false, false
+	}
+	resp.Body.Close()
+	subPath := resp.StatusCode == http.StatusOK
+
+	resp, err = c.Get(baseURL + "/2/2.svg")
+	if err != nil {
+		return false, false
+	}
+	resp.Body.Close()
+	continuingSubPath := resp.StatusCode == http.StatusOK
+	return subPath, continuingSubPath
+}
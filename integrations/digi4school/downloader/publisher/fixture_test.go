@@ -0,0 +1,84 @@
+package publisher
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newFixtureClient returns a client like the one of the downloader whose requests are
+// answered by an httptest server replaying the recorded responses in
+// testdata/<fixture>/<host>/<path>. Query strings are ignored, missing files are 404.
+func newFixtureClient(t *testing.T, fixture string) *http.Client {
+	t.Helper()
+	root := filepath.Join("testdata", fixture)
+	if _, err := os.Stat(root); err != nil {
+		t.Fatalf("missing fixture %s: %v", fixture, err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := filepath.Join(root, r.Host, filepath.FromSlash(r.URL.Path))
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	target, _ := url.Parse(server.URL)
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{
+		Jar:       jar,
+		Transport: &fixtureTransport{target: target},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// fixtureTransport sends every request to the fixture server and keeps the original
+// host in the Host header, so the server knows which publisher was asked.
+type fixtureTransport struct {
+	target *url.URL
+}
+
+func (f *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.Host = req.URL.Host
+	out.URL.Scheme = f.target.Scheme
+	out.URL.Host = f.target.Host
+	return http.DefaultTransport.RoundTrip(out)
+}
+
+// stubSVGToPDF replaces the rsvg-convert call with a copy of the svg, so the tests do
+// not depend on the tool. Pages listed in broken fail the conversion.
+func stubSVGToPDF(t *testing.T, broken ...string) {
+	t.Helper()
+	original := svgToPDF
+	t.Cleanup(func() { svgToPDF = original })
+
+	svgToPDF = func(downloadPath, filename string) (string, error) {
+		for _, b := range broken {
+			if filename == b {
+				return "", os.ErrInvalid
+			}
+		}
+		data, err := os.ReadFile(filepath.Join(downloadPath, filename))
+		if err != nil {
+			return "", err
+		}
+		out := filepath.Join(downloadPath, filename+".pdf")
+		return out, os.WriteFile(out, data, 0600)
+	}
+}
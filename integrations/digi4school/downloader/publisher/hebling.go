@@ -1,45 +1,73 @@
-package types
+package publisher
 
 import (
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"paperlink_d4s/downloader/helper"
 	"regexp"
 )
 
-func DownloadHeblingBook(c *http.Client, data string, downloadPath string) ([]string, error) {
-	jwt, book := extractData(data)
+const heblingName = "helbling"
+
+func init() {
+	Register(hebling{})
+}
+
+// hebling serves the svg books of Helbling ebook+.
+type hebling struct{}
+
+func (hebling) Name() string {
+	return heblingName
+}
+
+func (hebling) Match(endpoint string) bool {
+	return endpoint == "https://service.helbling.com/ebookplus"
+}
+
+func (hebling) Open(c *http.Client, launch Launch) (Book, error) {
+	jwt, book := extractData(launch.Body)
 	baseURL, err := getBookBaseURL(c, jwt, book)
 	if err != nil {
 		return nil, fmt.Errorf("error getting book url: %w", err)
 	}
-	page := 1
-	err = os.Chdir(downloadPath)
+	return &heblingBook{c: c, baseURL: baseURL}, nil
+}
+
+type heblingBook struct {
+	c       *http.Client
+	baseURL string
+}
+
+func (b *heblingBook) Metadata() (Metadata, error) {
+	pages, err := helper.CountPages(func(page int) (bool, error) {
+		return helper.PageExists(b.c, b.pageURL(page))
+	})
+	if err != nil {
+		return Metadata{}, fmt.Errorf("failed to count pages: %w", err)
+	}
+	return Metadata{Publisher: heblingName, Pages: pages}, nil
+}
+
+func (b *heblingBook) DownloadPage(page int, dir string) (string, error) {
+	filename, endReached, err := helper.DownloadOnePage(b.pageURL(page), b.c, false, dir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to chdir to %s: %w", downloadPath, err)
+		return "", fmt.Errorf("failed to download page: %w", err)
 	}
-	files := make([]string, 0)
-	for {
-		downloadURL := fmt.Sprintf("%s/pages/svg/%d.svg", baseURL, page)
-		filename, endReached, err := helper.DownloadOnePage(downloadURL, c, false)
-		if err != nil {
-			return nil, fmt.Errorf("failed to download page: %w", err)
-		}
-		if endReached {
-			break
-		}
-		outputPDF, err := helper.ConvertSVGToPDF(downloadPath, filename)
-		if err != nil {
-			continue
-		}
-		files = append(files, outputPDF)
-		page++
-		fmt.Printf("PAGE_COUNT: %d\n", page)
+	if endReached {
+		return "", ErrNoPage
+	}
+	outputPDF, err := svgToPDF(dir, filename)
+	if err != nil {
+		// Some helbling pages can not be converted, the rest of the book is still usable.
+		return "", fmt.Errorf("%w: conversion failed: %v", ErrSkipPage, err)
 	}
-	return files, nil
+	return outputPDF, nil
+}
+
+func (b *heblingBook) pageURL(page int) string {
+	return fmt.Sprintf("%s/pages/svg/%d.svg", b.baseURL, page)
 }
 
 func getBookBaseURL(c *http.Client, jwt string, book string) (string, error) {
@@ -53,6 +81,7 @@ func getBookBaseURL(c *http.Client, jwt string, book string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("failed to do request: %v", err)
 	}
+	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return "", fmt.Errorf("failed to read response body: %v", err)
@@ -66,6 +95,7 @@ func getBookBaseURL(c *http.Client, jwt string, book string) (string, error) {
 	}
 	return data.Content, nil
 }
+
 func extractData(html string) (jwt, lastPart string) {
 	tokenRe := regexp.MustCompile(`window\.localStorage\.setItem\('d4s-token',\s*'([^']+)'`)
 	hrefRe := regexp.MustCompile(`window\.location\.href\s*=\s*'([^']+)'`)
@@ -0,0 +1,75 @@
+// Package publisher contains the adapters for the publishers that serve Digi4School
+// books. Every adapter lives in its own file and registers itself in init, adding a
+// publisher does not touch the download loop.
+package publisher
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"paperlink_d4s/downloader/helper"
+)
+
+var (
+	// ErrNoPage is returned by DownloadPage for pages after the end of the book.
+	ErrNoPage = errors.New("page does not exist")
+	// ErrSkipPage is returned by DownloadPage for pages that are broken at the publisher.
+	// The download continues without them.
+	ErrSkipPage = errors.New("page skipped")
+	// ErrUnsupported is returned for books of publishers without adapter.
+	ErrUnsupported = errors.New("book source not supported")
+)
+
+// Launch is the outcome of the LTI chain that opens a book.
+type Launch struct {
+	// Endpoint is the url of the last LTI form, it tells the publisher apart.
+	Endpoint string
+	// Location is the redirect target of the last LTI request.
+	Location string
+	// Body is the body of the last LTI response.
+	Body string
+}
+
+type Metadata struct {
+	Publisher string `json:"publisher"`
+	Pages     int    `json:"pages"`
+}
+
+type Publisher interface {
+	Name() string
+	// Match reports whether the publisher serves books launched at the LTI endpoint.
+	Match(endpoint string) bool
+	// Open prepares the book for downloading, e.g. by logging into the publisher.
+	Open(c *http.Client, launch Launch) (Book, error)
+}
+
+// Book is a book opened at its publisher.
+type Book interface {
+	Metadata() (Metadata, error)
+	// DownloadPage downloads the page, starting at 1, into dir and returns the path of
+	// the page pdf.
+	DownloadPage(page int, dir string) (string, error)
+}
+
+var publishers []Publisher
+
+func Register(p Publisher) {
+	publishers = append(publishers, p)
+}
+
+// ForLaunch returns the publisher of the book. Books without ebook plus are always
+// served by Digi4School itself.
+func ForLaunch(ebookPlus bool, endpoint string) (Publisher, error) {
+	for _, p := range publishers {
+		if !ebookPlus && p.Name() == digi4schoolName {
+			return p, nil
+		}
+		if ebookPlus && p.Match(endpoint) {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupported, endpoint)
+}
+
+// svgToPDF is replaced in tests, the conversion needs rsvg-convert.
+var svgToPDF = helper.ConvertSVGToPDF
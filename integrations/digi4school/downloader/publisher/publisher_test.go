@@ -0,0 +1,123 @@
+package publisher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestForLaunch(t *testing.T) {
+	tests := []struct {
+		ebookPlus bool
+		endpoint  string
+		want      string
+	}{
+		{false, "", digi4schoolName},
+		{false, "https://service.helbling.com/ebookplus", digi4schoolName},
+		{true, "https://a.hpthek.at/lti", digi4schoolName},
+		{true, "https://mein.westermann.de/auth/gateway/d4s", biboxName},
+		{true, "https://service.helbling.com/ebookplus", heblingName},
+	}
+	for _, tt := range tests {
+		p, err := ForLaunch(tt.ebookPlus, tt.endpoint)
+		if err != nil {
+			t.Fatalf("ForLaunch(%v, %q): %v", tt.ebookPlus, tt.endpoint, err)
+		}
+		if p.Name() != tt.want {
+			t.Errorf("ForLaunch(%v, %q) = %s, want %s", tt.ebookPlus, tt.endpoint, p.Name(), tt.want)
+		}
+	}
+
+	if _, err := ForLaunch(true, "https://unknown.example/lti"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("unknown endpoint: got %v, want ErrUnsupported", err)
+	}
+}
+
+func TestDigi4School(t *testing.T) {
+	stubSVGToPDF(t)
+	c := newFixtureClient(t, "digi4school")
+
+	book, err := digi4school{}.Open(c, Launch{Location: "https://a.digi4school.at/ebook/5000/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPages(t, book, 3)
+
+	dir := t.TempDir()
+	for page := 1; page <= 3; page++ {
+		assertPageDownloaded(t, book, page, dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "0002", "img", "bg.png")); err != nil {
+		t.Errorf("embedded image of page 2 was not downloaded: %v", err)
+	}
+	if _, err := book.DownloadPage(4, dir); !errors.Is(err, ErrNoPage) {
+		t.Errorf("page 4: got %v, want ErrNoPage", err)
+	}
+}
+
+func TestHebling(t *testing.T) {
+	stubSVGToPDF(t, "00003.svg")
+	c := newFixtureClient(t, "hebling")
+
+	body, err := os.ReadFile(filepath.Join("testdata", "hebling", "launch.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	book, err := hebling{}.Open(c, Launch{Body: string(body)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPages(t, book, 4)
+
+	dir := t.TempDir()
+	assertPageDownloaded(t, book, 1, dir)
+	if _, err := book.DownloadPage(3, dir); !errors.Is(err, ErrSkipPage) {
+		t.Errorf("broken page 3: got %v, want ErrSkipPage", err)
+	}
+	assertPageDownloaded(t, book, 4, dir)
+}
+
+func TestBibox(t *testing.T) {
+	c := newFixtureClient(t, "bibox")
+
+	location := "https://mein.westermann.de/auth/login-init?login_hint=HINT&target_link_uri=%2Fv2%2Fbook%2F777"
+	book, err := bibox{}.Open(c, Launch{Location: location})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPages(t, book, 2)
+
+	dir := t.TempDir()
+	assertPageDownloaded(t, book, 1, dir)
+	assertPageDownloaded(t, book, 2, dir)
+	if _, err := book.DownloadPage(3, dir); !errors.Is(err, ErrNoPage) {
+		t.Errorf("page 3: got %v, want ErrNoPage", err)
+	}
+}
+
+func assertPages(t *testing.T, book Book, want int) {
+	t.Helper()
+	meta, err := book.Metadata()
+	if err != nil {
+		t.Fatalf("metadata: %v", err)
+	}
+	if meta.Pages != want {
+		t.Fatalf("got %d pages, want %d", meta.Pages, want)
+	}
+}
+
+func assertPageDownloaded(t *testing.T, book Book, page int, dir string) {
+	t.Helper()
+	file, err := book.DownloadPage(page, dir)
+	if err != nil {
+		t.Fatalf("page %d: %v", page, err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatalf("page %d: %v", page, err)
+	}
+	if info.Size() == 0 {
+		t.Errorf("page %d: %s is empty", page, file)
+	}
+}
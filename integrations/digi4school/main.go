@@ -1,139 +1,131 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"paperlink_d4s/client"
+	"paperlink_d4s/digi4school"
 	"paperlink_d4s/downloader"
+	"paperlink_d4s/progress"
 	"strings"
+	"syscall"
 )
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Fprintln(os.Stderr, "usage: downloader list|download|test-login ...")
+		fmt.Fprintln(os.Stderr, "usage: downloader list|download|metadata|test-login ...")
 		os.Exit(1)
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	integration := digi4school.New(downloader.OptionsFromEnv())
+
 	cmd := os.Args[1]
 	switch cmd {
 	case "list":
-		if len(os.Args) != 4 {
-			fmt.Fprintln(os.Stderr, "usage: downloader list <username> <password>")
+		if len(os.Args) != 3 {
+			fmt.Fprintln(os.Stderr, "usage: downloader list <username> (password on stdin)")
 			os.Exit(1)
 		}
-		username, password := os.Args[2], os.Args[3]
-		if err := listBooks(username, password); err != nil {
+		username, password := os.Args[2], readPassword()
+		books, err := integration.ListBooks(ctx, username, password)
+		if err != nil {
 			fmt.Fprintln(os.Stderr, "error:", err)
 			os.Exit(1)
 		}
+		printJSON(books)
 
 	case "download":
-		if len(os.Args) != 5 {
-			fmt.Fprintln(os.Stderr, "usage: downloader download <id=path,...> <username> <password>")
+		if len(os.Args) != 4 {
+			fmt.Fprintln(os.Stderr, "usage: downloader download <id=path,...> <username> (password on stdin)")
 			os.Exit(1)
 		}
-		mappingArg, username, password := os.Args[2], os.Args[3], os.Args[4]
+		mappingArg, username, password := os.Args[2], os.Args[3], readPassword()
 
 		idPathMap, err := parseIDPathMapping(mappingArg)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "error parsing id/path mapping:", err)
+			progress.FatalError(progress.Stdout, fmt.Errorf("error parsing id/path mapping: %w", err))
+			os.Exit(1)
+		}
+
+		if err := integration.Download(ctx, username, password, idPathMap, progress.Stdout); err != nil {
+			progress.FatalError(progress.Stdout, err)
 			os.Exit(1)
 		}
 
-		if err := downloadBooks(idPathMap, username, password); err != nil {
+	case "metadata":
+		if len(os.Args) != 4 {
+			fmt.Fprintln(os.Stderr, "usage: downloader metadata <id,...> <username> (password on stdin)")
+			os.Exit(1)
+		}
+		idsArg, username, password := os.Args[2], os.Args[3], readPassword()
+		metadata, err := integration.Metadata(ctx, username, password, strings.Split(idsArg, ","))
+		if metadata == nil && err != nil {
 			fmt.Fprintln(os.Stderr, "error:", err)
 			os.Exit(1)
 		}
+		if err != nil {
+			// Books that failed are left out, the others are still printed.
+			fmt.Fprintln(os.Stderr, err)
+		}
+		printJSON(metadata)
 
 	case "test-login":
-		if len(os.Args) != 4 {
-			fmt.Fprintln(os.Stderr, "usage: downloader test-login <username> <password>")
+		if len(os.Args) != 3 {
+			fmt.Fprintln(os.Stderr, "usage: downloader test-login <username> (password on stdin)")
 			os.Exit(1)
 		}
-		username, password := os.Args[2], os.Args[3]
-		testLogin(username, password)
+		username, password := os.Args[2], readPassword()
+		testLogin(ctx, integration, username, password)
 
 	default:
 		fmt.Fprintln(os.Stderr, "unknown command:", cmd)
-		fmt.Fprintln(os.Stderr, "available commands: list, download, test-login")
+		fmt.Fprintln(os.Stderr, "available commands: list, download, metadata, test-login")
 		os.Exit(1)
 	}
 }
 
-func testLogin(username, password string) {
-	c := client.NewDigi4SClient(username, password)
-	defer c.Logout()
-
-	if err := c.Login(); err != nil {
-		fmt.Println("0")
-		return
+// readPassword reads the password from the first line of stdin. It is not accepted as
+// argument so it does not show up in the process list.
+func readPassword() string {
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		fmt.Fprintln(os.Stderr, "error reading password from stdin:", err)
+		os.Exit(1)
 	}
-
-	fmt.Println("1")
+	return strings.TrimRight(password, "\r\n")
 }
 
-func listBooks(username, password string) error {
-	c := client.NewDigi4SClient(username, password)
-	defer c.Logout()
-
-	if err := c.Login(); err != nil {
-		return err
-	}
-
-	books, err := c.GetBooks()
-	if err != nil {
-		return err
-	}
-
-	b, err := json.Marshal(books)
-	if err != nil {
-		return err
+// testLogin prints 1 if the login works and 0 for invalid credentials. Locked accounts
+// and network errors print "locked" and "network".
+func testLogin(ctx context.Context, integration *digi4school.Integration, username, password string) {
+	err := integration.TestLogin(ctx, username, password)
+	switch {
+	case err == nil:
+		fmt.Println("1")
+	case errors.Is(err, client.ErrLocked):
+		fmt.Println("locked")
+	case errors.Is(err, client.ErrNetwork):
+		fmt.Println("network")
+	default:
+		fmt.Println("0")
 	}
-
-	fmt.Println(string(b))
-	return nil
 }
 
-func downloadBooks(idPathMap map[string]string, username, password string) error {
-	c := client.NewDigi4SClient(username, password)
-	defer c.Logout()
-
-	if err := c.Login(); err != nil {
-		return err
-	}
-
-	books, err := c.GetBooks()
+func printJSON(v any) {
+	b, err := json.Marshal(v)
 	if err != nil {
-		return err
-	}
-	completed := 0
-	for id, path := range idPathMap {
-		id = strings.TrimSpace(id)
-		if id == "" {
-			continue
-		}
-
-		found := false
-		for _, b := range books {
-			if b.DataId == id {
-				found = true
-				fmt.Printf("Downloading book: %s\n", b.Name)
-
-				if err := downloader.DownloadBook(&b, path, c.GetCurrentDigi4sCookie()); err != nil {
-					return fmt.Errorf("failed to download %s: %w", id, err)
-				}
-				completed++
-				break
-			}
-		}
-
-		if !found {
-			return fmt.Errorf("book with id %s not found", id)
-		}
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
 	}
-	fmt.Printf("%d books downloaded\n", completed)
-	return nil
+	fmt.Println(string(b))
 }
 
 func parseIDPathMapping(s string) (map[string]string, error) {
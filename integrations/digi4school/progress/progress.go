@@ -0,0 +1,97 @@
+// Package progress describes the events a download reports. The server consumes them
+// in-process through a Sink, the download command prints them as newline-delimited
+// JSON on stdout.
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	BookStarted    EventType = "book_started"
+	PageDownloaded EventType = "page_downloaded"
+	BookFinished   EventType = "book_finished"
+	Warning        EventType = "warning"
+	Fatal          EventType = "fatal"
+)
+
+type Event struct {
+	Type   EventType `json:"type"`
+	Time   int64     `json:"time"`
+	BookID string    `json:"bookId,omitempty"`
+	Name   string    `json:"name,omitempty"`
+	// Page is the number of pages downloaded so far, Total is 0 if the publisher does not
+	// tell the page count up front.
+	Page    int    `json:"page,omitempty"`
+	Total   int    `json:"total,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Sink receives the events of a download. It may be called from several goroutines.
+type Sink func(Event)
+
+var mu sync.Mutex
+
+// Stdout writes every event as one JSON line to stdout.
+func Stdout(e Event) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	_, _ = os.Stdout.Write(append(line, '\n'))
+}
+
+func emit(sink Sink, e Event) {
+	if sink == nil {
+		return
+	}
+	e.Time = time.Now().UnixMilli()
+	sink(e)
+}
+
+// Reporter emits the events of a single book.
+type Reporter struct {
+	BookID string
+	sink   Sink
+}
+
+func NewReporter(sink Sink, bookID, name string) *Reporter {
+	emit(sink, Event{Type: BookStarted, BookID: bookID, Name: name})
+	return &Reporter{BookID: bookID, sink: sink}
+}
+
+func (r *Reporter) Page(page, total int) {
+	emit(r.sink, Event{Type: PageDownloaded, BookID: r.BookID, Page: page, Total: total})
+}
+
+func (r *Reporter) Finished(path string) {
+	emit(r.sink, Event{Type: BookFinished, BookID: r.BookID, Path: path})
+}
+
+func (r *Reporter) Warn(format string, args ...any) {
+	emit(r.sink, Event{Type: Warning, BookID: r.BookID, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *Reporter) Fatal(err error) {
+	emit(r.sink, Event{Type: Fatal, BookID: r.BookID, Message: err.Error()})
+}
+
+// Warn reports a problem that is not tied to a book.
+func Warn(sink Sink, format string, args ...any) {
+	emit(sink, Event{Type: Warning, Message: fmt.Sprintf(format, args...)})
+}
+
+// FatalError reports an error that aborts the whole download.
+func FatalError(sink Sink, err error) {
+	emit(sink, Event{Type: Fatal, Message: err.Error()})
+}
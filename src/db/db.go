@@ -25,15 +25,15 @@ var log = util.GroupLog("DATABASE")
 
 func DB() *gorm.DB {
 	once.Do(func() {
-		err := os.MkdirAll("./data/log", 0755)
+		err := os.MkdirAll(util.DataPath("log"), 0755)
 		if err != nil {
 			logrus.Fatalf("Failed to create log directory: %v", err)
 		}
 		doesDBExist := true
-		if _, err = os.Stat("./data/app.db"); os.IsNotExist(err) {
+		if _, err = os.Stat(util.DataPath("app.db")); os.IsNotExist(err) {
 			doesDBExist = false
 		}
-		instance, err = gorm.Open(sqlite.Open("./data/app.db"), &gorm.Config{
+		instance, err = gorm.Open(sqlite.Open(util.DataPath("app.db")), &gorm.Config{
 			Logger: logger.Default.LogMode(logger.Silent),
 		})
 		if err != nil {
@@ -48,6 +48,7 @@ func DB() *gorm.DB {
 			&entity.Document{}, &entity.DocumentUser{}, &entity.Notification{},
 			&entity.Tag{}, &entity.User{}, &entity.Directory{},
 			&entity.RegistrationInvite{}, &entity.Digi4SchoolAccount{}, &entity.Digi4SchoolBook{}, &entity.Task{},
+			&entity.APIToken{}, &entity.Setting{}, &entity.CommentThread{}, &entity.Comment{},
 		)
 		if err != nil {
 			log.Fatalf("Error migrating database: %v", err)
@@ -56,6 +57,18 @@ func DB() *gorm.DB {
 		if err != nil {
 			log.Fatalf("Error migrating database columns: %v", err)
 		}
+		err = clearEmptyBookFileUUIDs(instance)
+		if err != nil {
+			log.Fatalf("Error migrating digi4school books: %v", err)
+		}
+		err = encryptTOTPSecrets(instance)
+		if err != nil {
+			log.Fatalf("Error encrypting totp secrets: %v", err)
+		}
+		err = encryptDigi4SchoolPasswords(instance)
+		if err != nil {
+			log.Fatalf("Error encrypting digi4school passwords: %v", err)
+		}
 		log.Info("Database connection established.")
 		if !doesDBExist {
 			instance.Save(&entity.RegistrationInvite{
@@ -164,6 +177,78 @@ func rebuildAnnotationActionsTableWithoutForeignKey(instance *gorm.DB) error {
 		return nil
 	})
 }
+
+// clearEmptyBookFileUUIDs sets the file of books that older versions stored without one to
+// NULL. Those rows got the DONE state with its column, they are moved back to PENDING so
+// their download is resumed.
+func clearEmptyBookFileUUIDs(instance *gorm.DB) error {
+	result := instance.Model(&entity.Digi4SchoolBook{}).
+		Where("file_uuid = ?", "").
+		Updates(map[string]any{
+			"file_uuid": nil,
+			"state":     gorm.Expr("CASE WHEN state = ? THEN ? ELSE state END", entity.BookDone, entity.BookPending),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Infof("Marked %d digi4school books without file as not downloaded", result.RowsAffected)
+	}
+	return nil
+}
+
+// encryptTOTPSecrets encrypts TOTP secrets that were stored in plaintext by older versions.
+func encryptTOTPSecrets(instance *gorm.DB) error {
+	var users []entity.User
+	if err := instance.Where("totp_secret <> ''").Find(&users).Error; err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if util.IsEncrypted(user.TOTPSecret) {
+			continue
+		}
+		encrypted, err := util.EncryptString(user.TOTPSecret)
+		if err != nil {
+			return err
+		}
+		err = instance.Model(&entity.User{}).
+			Where("id = ?", user.ID).
+			Update("totp_secret", encrypted).Error
+		if err != nil {
+			return err
+		}
+		log.Infof("Encrypted stored totp secret of user %s", user.Username)
+	}
+	return nil
+}
+
+// encryptDigi4SchoolPasswords encrypts passwords that were stored in plaintext by older versions.
+func encryptDigi4SchoolPasswords(instance *gorm.DB) error {
+	var accounts []entity.Digi4SchoolAccount
+	if err := instance.Find(&accounts).Error; err != nil {
+		return err
+	}
+
+	for _, account := range accounts {
+		if account.Password == "" || util.IsEncrypted(account.Password) {
+			continue
+		}
+		encrypted, err := util.EncryptString(account.Password)
+		if err != nil {
+			return err
+		}
+		err = instance.Model(&entity.Digi4SchoolAccount{}).
+			Where("id = ?", account.ID).
+			Update("password", encrypted).Error
+		if err != nil {
+			return err
+		}
+		log.Infof("Encrypted stored password of digi4school account %s", account.Username)
+	}
+	return nil
+}
+
 func ApplySQLiteConfig(instance *gorm.DB) error {
 	pragmas := []string{
 		"PRAGMA journal_mode = WAL;",
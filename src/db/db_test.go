@@ -0,0 +1,137 @@
+package db
+
+import (
+	"testing"
+
+	"paperlink/db/entity"
+	"paperlink/util"
+
+	"gorm.io/gorm"
+)
+
+func TestEncryptTOTPSecrets(t *testing.T) {
+	instance := DB()
+	user := entity.User{Username: "totp-plain", Password: "x", TOTPSecret: "JBSWY3DPEHPK3PXP"}
+	if err := instance.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// The second run must leave the secret encrypted once.
+	for range 2 {
+		if err := encryptTOTPSecrets(instance); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stored entity.User
+	if err := instance.First(&stored, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	secret, err := util.DecryptString(stored.TOTPSecret)
+	if err != nil {
+		t.Fatalf("secret not encrypted: %v", err)
+	}
+	if secret != user.TOTPSecret {
+		t.Fatalf("decrypted %q, want %q", secret, user.TOTPSecret)
+	}
+}
+
+func TestEncryptDigi4SchoolPasswords(t *testing.T) {
+	instance := DB()
+	encrypted, err := util.EncryptString("already-encrypted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := entity.Digi4SchoolAccount{Username: "d4s-plain", Password: "hunter2"}
+	stored := entity.Digi4SchoolAccount{Username: "d4s-encrypted", Password: encrypted}
+	for _, account := range []*entity.Digi4SchoolAccount{&plain, &stored} {
+		if err := instance.Create(account).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for range 2 {
+		if err := encryptDigi4SchoolPasswords(instance); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		id       int
+		password string
+	}{
+		{plain.ID, "hunter2"},
+		{stored.ID, "already-encrypted"},
+	}
+	for _, test := range tests {
+		var account entity.Digi4SchoolAccount
+		if err := instance.First(&account, test.id).Error; err != nil {
+			t.Fatal(err)
+		}
+		password, err := util.DecryptString(account.Password)
+		if err != nil {
+			t.Fatalf("password of account %d not encrypted once: %v", test.id, err)
+		}
+		if password != test.password {
+			t.Fatalf("account %d decrypted to %q, want %q", test.id, password, test.password)
+		}
+	}
+	var unchanged entity.Digi4SchoolAccount
+	if err := instance.First(&unchanged, stored.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if unchanged.Password != encrypted {
+		t.Fatal("encrypted password was encrypted again")
+	}
+}
+
+func TestClearEmptyBookFileUUIDs(t *testing.T) {
+	instance := DB()
+	empty := ""
+	file := entity.FileDocument{UUID: "book-file", Path: "book-file.pvf"}
+	if err := instance.Create(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	legacy := entity.Digi4SchoolBook{UUID: "legacy", BookID: "1", State: entity.BookDone, FileUUID: &empty}
+	excluded := entity.Digi4SchoolBook{UUID: "excluded", BookID: "2", State: entity.BookExcluded, FileUUID: &empty}
+	done := entity.Digi4SchoolBook{UUID: "done", BookID: "3", State: entity.BookDone, FileUUID: &file.UUID}
+	// Stored without foreign key checks, old databases have no such account and file.
+	err := instance.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+			return err
+		}
+		defer conn.Exec("PRAGMA foreign_keys = ON")
+		for _, book := range []*entity.Digi4SchoolBook{&legacy, &excluded, &done} {
+			if err := conn.Omit("File", "Account").Create(book).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := clearEmptyBookFileUUIDs(instance); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id    int
+		state entity.Digi4SchoolBookState
+		file  bool
+	}{
+		{legacy.ID, entity.BookPending, false},
+		{excluded.ID, entity.BookExcluded, false},
+		{done.ID, entity.BookDone, true},
+	}
+	for _, test := range tests {
+		var book entity.Digi4SchoolBook
+		if err := instance.First(&book, test.id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if book.State != test.state || (book.FileUUID != nil) != test.file {
+			t.Errorf("book %s: state %s, file %v, want %s and file %v", book.UUID, book.State, book.FileUUID, test.state, test.file)
+		}
+	}
+}
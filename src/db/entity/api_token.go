@@ -0,0 +1,29 @@
+package entity
+
+type APITokenScope string
+
+const (
+	// ScopeRead allows the routes that read documents, directories and pages.
+	ScopeRead APITokenScope = "read"
+	// ScopeUpload additionally allows creating, changing and deleting documents and directories.
+	ScopeUpload APITokenScope = "upload"
+	// ScopeAdmin allows the admin routes, if the owning user is an admin. Everything else,
+	// like collaborative editing, comments and account settings, needs a login session.
+	ScopeAdmin APITokenScope = "admin"
+)
+
+type APIToken struct {
+	ID     int    `gorm:"primaryKey" json:"id"`
+	Name   string `gorm:"not null" json:"name"`
+	UserID int    `gorm:"index" json:"-"`
+	User   User   `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	// TokenHash is the SHA-256 of the token. The token itself is only shown once at creation.
+	TokenHash string `gorm:"uniqueIndex;not null" json:"-"`
+	// Prefix is the start of the token so users can tell their tokens apart.
+	Prefix     string `json:"prefix"`
+	Scopes     string `json:"scopes"`
+	CreatedAt  int64  `json:"createdAt"`
+	LastUsedAt int64  `json:"lastUsedAt"`
+	// ExpiresAt is a unix timestamp, 0 means the token never expires.
+	ExpiresAt int64 `json:"expiresAt"`
+}
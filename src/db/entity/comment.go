@@ -0,0 +1,32 @@
+package entity
+
+// CommentThread is a discussion anchored to a page of a document and optionally to an
+// annotation on it.
+type CommentThread struct {
+	ID         int      `gorm:"primary_key;AUTO_INCREMENT"`
+	Document   Document `gorm:"constraint:OnDelete:CASCADE;"`
+	DocumentID int      `gorm:"index"`
+	Page       int64
+	// AnnotationID has no foreign key, annotations are written to the database in
+	// batches and may not exist there yet.
+	AnnotationID *int
+	CreatedBy    User `gorm:"constraint:OnDelete:CASCADE;"`
+	CreatedByID  int
+	Resolved     bool
+	ResolvedBy   *User `gorm:"constraint:OnDelete:SET NULL;"`
+	ResolvedByID *int
+	ResolvedAt   int64
+	CreatedAt    int64
+	UpdatedAt    int64
+	Comments     []Comment `gorm:"foreignKey:ThreadID;constraint:OnDelete:CASCADE;"`
+}
+
+type Comment struct {
+	ID        int  `gorm:"primary_key;AUTO_INCREMENT"`
+	ThreadID  int  `gorm:"index"`
+	User      User `gorm:"constraint:OnDelete:CASCADE;"`
+	UserID    int
+	Text      string
+	CreatedAt int64
+	UpdatedAt int64
+}
@@ -1,7 +1,28 @@
 package entity
 
+type Digi4SchoolAccountStatus string
+
+const (
+	AccountStatusUnknown            Digi4SchoolAccountStatus = "UNKNOWN"
+	AccountStatusOK                 Digi4SchoolAccountStatus = "OK"
+	AccountStatusInvalidCredentials Digi4SchoolAccountStatus = "INVALID_CREDENTIALS"
+	AccountStatusLocked             Digi4SchoolAccountStatus = "LOCKED"
+	AccountStatusNetworkError       Digi4SchoolAccountStatus = "NETWORK_ERROR"
+)
+
 type Digi4SchoolAccount struct {
 	ID       int    `gorm:"primaryKey" json:"id"`
 	Username string `gorm:"unique" json:"username"`
-	Password string `gorm:"size:255" json:"password"`
+	// Password is encrypted with the server key, see util.EncryptString.
+	Password string `gorm:"size:255" json:"-"`
+
+	// Status is the outcome of the last login check, LastCheckedAt its unix time.
+	Status        Digi4SchoolAccountStatus `gorm:"default:UNKNOWN" json:"status"`
+	LastCheckedAt int64                    `json:"lastCheckedAt"`
+}
+
+// Healthy reports whether a sync should use the account. Network errors are
+// temporary, so those accounts are still tried.
+func (a *Digi4SchoolAccount) Healthy() bool {
+	return a.Status != AccountStatusInvalidCredentials && a.Status != AccountStatusLocked
 }
@@ -1,5 +1,16 @@
 package entity
 
+type Digi4SchoolBookState string
+
+const (
+	BookPending     Digi4SchoolBookState = "PENDING"
+	BookDownloading Digi4SchoolBookState = "DOWNLOADING"
+	BookDone        Digi4SchoolBookState = "DONE"
+	BookFailed      Digi4SchoolBookState = "FAILED"
+	// BookExcluded books are skipped by the sync until an admin selects them again.
+	BookExcluded Digi4SchoolBookState = "EXCLUDED"
+)
+
 type Digi4SchoolBook struct {
 	ID        int    `gorm:"primaryKey" json:"id"`
 	UUID      string `gorm:"unique" json:"uuid"`
@@ -8,6 +19,21 @@ type Digi4SchoolBook struct {
 	AccountID int
 	Account   Digi4SchoolAccount `gorm:"foreignKey:AccountID" json:"account"`
 
-	FileUUID string
+	// State tracks the download. Rows from before the state existed are DONE.
+	State Digi4SchoolBookState `gorm:"default:DONE;index" json:"state"`
+	// Error holds the reason of the last failed download.
+	Error string `json:"error,omitempty"`
+
+	// FileUUID is only set once the download is DONE.
+	FileUUID *string
 	File     FileDocument `gorm:"foreignKey:FileUUID;references:UUID" json:"file"`
+
+	// Version is increased every time an updated edition replaces the file.
+	Version int `gorm:"default:1" json:"version"`
+	// RemotePages is the page count the publisher reported at the last update check.
+	RemotePages int `json:"remotePages"`
+	// UpdateAvailable is set while a changed edition is waiting to be downloaded into
+	// UpdateFileUUID. The current file stays available until then.
+	UpdateAvailable bool   `json:"updateAvailable"`
+	UpdateFileUUID  string `json:"-"`
 }
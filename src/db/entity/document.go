@@ -14,6 +14,11 @@ type Document struct {
 	FileUUID string       `json:"fileUuid"`
 	File     FileDocument `gorm:"foreignKey:FileUUID;references:UUID;constraint:OnDelete:CASCADE" json:"file"`
 
+	// OutdatedEdition is set if the book of the document got a new edition with another
+	// page count. The document keeps the old edition, its annotations would land on other
+	// pages of the new one.
+	OutdatedEdition bool `json:"outdatedEdition"`
+
 	DirectoryID *int       `json:"directoryId"`
 	Directory   *Directory `gorm:"foreignKey:DirectoryID;constraint:OnDelete:CASCADE" json:"directory"`
 }
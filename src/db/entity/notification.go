@@ -3,7 +3,10 @@ package entity
 type ActionType string
 
 const (
-	Invite ActionType = "INVITE"
+	Invite  ActionType = "INVITE"
+	Mention ActionType = "MENTION"
+	// BookEdition tells the owner of a document kept on an old book edition about the new one.
+	BookEdition ActionType = "BOOK_EDITION"
 )
 
 type Notification struct {
@@ -0,0 +1,8 @@
+package entity
+
+// Setting is a key value pair for runtime configuration that admins can change.
+type Setting struct {
+	Key       string `gorm:"primaryKey" json:"key"`
+	Value     string `json:"value"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
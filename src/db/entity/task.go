@@ -3,16 +3,38 @@ package entity
 type TaskStatus string
 
 const (
+	// QUEUED tasks wait for a free slot of their concurrency group.
+	QUEUED    TaskStatus = "QUEUED"
 	RUNNING   TaskStatus = "RUNNING"
 	FAILED    TaskStatus = "FAILED"
 	COMPLETED TaskStatus = "COMPLETED"
 	STOPPED   TaskStatus = "STOPPED"
+	// INTERRUPTED tasks were still running when the server stopped.
+	INTERRUPTED TaskStatus = "INTERRUPTED"
 )
 
+// TaskProgress is the progress of the current stage of a task.
+type TaskProgress struct {
+	Stage string `json:"stage"`
+	// Total is 0 while the amount of work of the stage is unknown.
+	Current int     `json:"current"`
+	Total   int     `json:"total"`
+	Percent float64 `json:"percent"`
+	// StageStartedAt and ETA are unix times, ETA is 0 until it can be estimated.
+	StageStartedAt int64 `json:"stageStartedAt"`
+	ETA            int64 `json:"eta"`
+}
+
 type Task struct {
-	ID        string     `gorm:"primary_key" json:"id"`
-	Status    TaskStatus `json:"status"`
-	Name      string     `gorm:"not null" json:"name"`
-	StartTime int64      `json:"startTime"`
-	EndTime   int64      `json:"endTime"`
+	ID     string     `gorm:"primary_key" json:"id"`
+	Status TaskStatus `gorm:"index" json:"status"`
+	// Kind tells which service started the task, e.g. to resume it after a restart.
+	Kind string `gorm:"index" json:"kind"`
+	Name string `gorm:"not null" json:"name"`
+	// Params are the JSON encoded arguments a resumable task is started again with.
+	Params    string       `json:"-"`
+	Priority  int          `json:"priority"`
+	StartTime int64        `json:"startTime"`
+	EndTime   int64        `json:"endTime"`
+	Progress  TaskProgress `gorm:"embedded;embeddedPrefix:progress_" json:"progress"`
 }
@@ -5,4 +5,15 @@ type User struct {
 	Username string `gorm:"unique;not null"`
 	Password string
 	IsAdmin  bool
+	// OIDCSubject links the user to the "sub" claim of the configured identity provider.
+	OIDCSubject string `gorm:"column:oidc_subject;index"`
+
+	// TOTPSecret is encrypted with util.EncryptString.
+	TOTPSecret  string
+	TOTPEnabled bool
+	// TOTPLastCounter is the time step of the last accepted TOTP code. Codes of it and
+	// earlier steps are rejected, so a code cannot be replayed.
+	TOTPLastCounter int64
+	// TOTPRecoveryCodes holds the comma separated hashes of the unused recovery codes.
+	TOTPRecoveryCodes string
 }
@@ -13,3 +13,18 @@ func newAnnotationRepo() *AnnotationRepo {
 }
 
 var Annotation = newAnnotationRepo()
+
+func (r *AnnotationRepo) CountByDocument(documentID int) (int64, error) {
+	var count int64
+	err := r.db.Model(&entity.Annotation{}).Where("document_id = ?", documentID).Count(&count).Error
+	return count, err
+}
+
+// GetInDocument returns the annotation if it belongs to the document.
+func (r *AnnotationRepo) GetInDocument(documentID, id int) (*entity.Annotation, error) {
+	var annotation entity.Annotation
+	if err := r.db.Where("id = ? AND document_id = ?", id, documentID).First(&annotation).Error; err != nil {
+		return nil, err
+	}
+	return &annotation, nil
+}
@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"paperlink/db/entity"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix marks personal access tokens so they can be told apart from JWTs.
+const APITokenPrefix = "plk_"
+
+type APITokenRepo struct {
+	*Repository[entity.APIToken]
+}
+
+func newAPITokenRepo() *APITokenRepo {
+	return &APITokenRepo{NewRepository[entity.APIToken]()}
+}
+
+var APIToken = newAPITokenRepo()
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create stores a new token and returns it together with the plain token value.
+func (r *APITokenRepo) Create(userID int, name string, scopes []entity.APITokenScope, expiresAt int64) (*entity.APIToken, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	plain := APITokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	scopeNames := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scopeNames = append(scopeNames, string(scope))
+	}
+
+	token := entity.APIToken{
+		Name:      name,
+		UserID:    userID,
+		TokenHash: hashAPIToken(plain),
+		Prefix:    plain[:len(APITokenPrefix)+6],
+		Scopes:    strings.Join(scopeNames, ","),
+		CreatedAt: time.Now().Unix(),
+		ExpiresAt: expiresAt,
+	}
+	if err := r.Save(&token); err != nil {
+		return nil, "", err
+	}
+	return &token, plain, nil
+}
+
+func (r *APITokenRepo) GetByToken(plain string) (*entity.APIToken, error) {
+	var token entity.APIToken
+	if err := r.db.Where("token_hash = ?", hashAPIToken(plain)).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *APITokenRepo) ListForUser(userID int) ([]entity.APIToken, error) {
+	var tokens []entity.APIToken
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// DeleteForUser revokes a token and reports whether the user owned it.
+func (r *APITokenRepo) DeleteForUser(id int, userID int) (bool, error) {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&entity.APIToken{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *APITokenRepo) TouchLastUsed(token *entity.APIToken) error {
+	return r.db.Model(token).Update("last_used_at", time.Now().Unix()).Error
+}
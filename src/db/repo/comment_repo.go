@@ -0,0 +1,37 @@
+package repo
+
+import (
+	"paperlink/db/entity"
+
+	"gorm.io/gorm"
+)
+
+type CommentRepo struct {
+	*Repository[entity.Comment]
+}
+
+func newCommentRepo() *CommentRepo {
+	return &CommentRepo{NewRepository[entity.Comment]()}
+}
+
+var Comment = newCommentRepo()
+
+// DeleteFromThread removes the comment and the thread with it if it was the last one.
+// Both happen in one transaction, so concurrent deletes never leave an empty thread.
+func (r *CommentRepo) DeleteFromThread(id, threadID int) (threadDeleted bool, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND thread_id = ?", id, threadID).Delete(&entity.Comment{}).Error; err != nil {
+			return err
+		}
+		var remaining int64
+		if err := tx.Model(&entity.Comment{}).Where("thread_id = ?", threadID).Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining > 0 {
+			return nil
+		}
+		threadDeleted = true
+		return tx.Delete(&entity.CommentThread{}, threadID).Error
+	})
+	return threadDeleted, err
+}
@@ -0,0 +1,64 @@
+package repo
+
+import (
+	"paperlink/db/entity"
+
+	"gorm.io/gorm"
+)
+
+type CommentThreadRepo struct {
+	*Repository[entity.CommentThread]
+}
+
+func newCommentThreadRepo() *CommentThreadRepo {
+	return &CommentThreadRepo{NewRepository[entity.CommentThread]()}
+}
+
+var CommentThread = newCommentThreadRepo()
+
+func (r *CommentThreadRepo) CountByDocument(documentID int) (int64, error) {
+	var count int64
+	err := r.db.Model(&entity.CommentThread{}).Where("document_id = ?", documentID).Count(&count).Error
+	return count, err
+}
+
+// ListByDocument returns the threads of the document with their comments and authors,
+// the threads of one page only if page is set.
+func (r *CommentThreadRepo) ListByDocument(documentID int, page *int64) ([]entity.CommentThread, error) {
+	query := r.withComments().Where("document_id = ?", documentID)
+	if page != nil {
+		query = query.Where("page = ?", *page)
+	}
+
+	var threads []entity.CommentThread
+	err := query.Order("page ASC").Order("created_at ASC").Order("id ASC").Find(&threads).Error
+	return threads, err
+}
+
+func (r *CommentThreadRepo) GetWithComments(id int) (*entity.CommentThread, error) {
+	var thread entity.CommentThread
+	if err := r.withComments().Where("id = ?", id).First(&thread).Error; err != nil {
+		return nil, err
+	}
+	return &thread, nil
+}
+
+// UpdateResolution stores the resolved state of the thread, its comments are left alone.
+func (r *CommentThreadRepo) UpdateResolution(thread *entity.CommentThread) error {
+	return r.db.Model(&entity.CommentThread{}).Where("id = ?", thread.ID).Updates(map[string]any{
+		"resolved":       thread.Resolved,
+		"resolved_by_id": thread.ResolvedByID,
+		"resolved_at":    thread.ResolvedAt,
+		"updated_at":     thread.UpdatedAt,
+	}).Error
+}
+
+func (r *CommentThreadRepo) withComments() *gorm.DB {
+	return r.db.
+		Preload("CreatedBy").
+		Preload("ResolvedBy").
+		Preload("Comments", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at ASC").Order("id ASC")
+		}).
+		Preload("Comments.User")
+}
@@ -13,3 +13,9 @@ func newDigi4SchoolAccountRepo() *Digi4SchoolAccountRepo {
 }
 
 var Digi4SchoolAccount = newDigi4SchoolAccountRepo()
+
+func (r *Digi4SchoolAccountRepo) UpdateStatus(id int, status entity.Digi4SchoolAccountStatus, checkedAt int64) error {
+	return r.db.Model(&entity.Digi4SchoolAccount{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"status": status, "last_checked_at": checkedAt}).Error
+}
@@ -22,3 +22,41 @@ func (r *Digi4SchoolBookRepo) GetByUUID(uuid string) *entity.Digi4SchoolBook {
 	}
 	return &book
 }
+
+func (r *Digi4SchoolBookRepo) GetByBookID(bookID string) *entity.Digi4SchoolBook {
+	var book entity.Digi4SchoolBook
+	err := r.db.Where("book_id = ?", bookID).First(&book).Error
+	if err != nil {
+		return nil
+	}
+	return &book
+}
+
+// ListDownloaded returns the books that have a file, including those whose updated
+// edition is still downloading.
+func (r *Digi4SchoolBookRepo) ListDownloaded() ([]entity.Digi4SchoolBook, error) {
+	var books []entity.Digi4SchoolBook
+	err := r.db.Where("file_uuid IS NOT NULL").Find(&books).Error
+	return books, err
+}
+
+func (r *Digi4SchoolBookRepo) CountDownloaded() (int64, error) {
+	var count int64
+	err := r.db.Model(&entity.Digi4SchoolBook{}).Where("file_uuid IS NOT NULL").Count(&count).Error
+	return count, err
+}
+
+// SetState updates the download state of the book with the given D4S id.
+func (r *Digi4SchoolBookRepo) SetState(bookID string, state entity.Digi4SchoolBookState, errMsg string) error {
+	return r.db.Model(&entity.Digi4SchoolBook{}).
+		Where("book_id = ?", bookID).
+		Updates(map[string]any{"state": state, "error": errMsg}).Error
+}
+
+// ResetInterrupted moves books that were downloading back to PENDING, e.g. after the
+// sync was stopped or the server restarted. Their downloads resume on the next sync.
+func (r *Digi4SchoolBookRepo) ResetInterrupted() error {
+	return r.db.Model(&entity.Digi4SchoolBook{}).
+		Where("state = ?", entity.BookDownloading).
+		Update("state", entity.BookPending).Error
+}
@@ -22,6 +22,31 @@ func (n *DocumentRepo) GetAnnotationsById(documentID int) ([]entity.Annotation,
 	return annotations, err
 }
 
+// ReplaceFile points the documents of the old file to the new one, except the ones in
+// keep. Annotations belong to the document and stay attached.
+func (r *DocumentRepo) ReplaceFile(oldFileUUID, newFileUUID string, keep []int) (int64, error) {
+	query := r.db.Model(&entity.Document{}).Where("file_uuid = ?", oldFileUUID)
+	if len(keep) > 0 {
+		query = query.Where("id NOT IN ?", keep)
+	}
+	result := query.Update("file_uuid", newFileUUID)
+	return result.RowsAffected, result.Error
+}
+
+func (r *DocumentRepo) GetByFileUUID(fileUUID string) ([]entity.Document, error) {
+	var documents []entity.Document
+	err := r.db.Where("file_uuid = ?", fileUUID).Find(&documents).Error
+	return documents, err
+}
+
+// FlagOutdatedEdition marks the documents as kept on an old edition of their book.
+func (r *DocumentRepo) FlagOutdatedEdition(ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Model(&entity.Document{}).Where("id IN ?", ids).Update("outdated_edition", true).Error
+}
+
 func (r *DocumentRepo) GetAllByUserIdWithFile(userId int) ([]entity.Document, error) {
 	var result []entity.Document
 	err := r.db.Preload("File").Where("user_id = ?", userId).Find(&result).Error
@@ -13,3 +13,12 @@ func newDocumentUserRepo() *DocumentUserRepo {
 }
 
 var DocumentUser = newDocumentUserRepo()
+
+// IsMember reports whether the document is shared with the user.
+func (r *DocumentUserRepo) IsMember(documentID, userID int) (bool, error) {
+	var count int64
+	err := r.db.Model(&entity.DocumentUser{}).
+		Where("document_id = ? AND user_id = ?", documentID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
@@ -22,3 +22,7 @@ func (f *FileDocumentRepo) GetByUUID(uuid string) *entity.FileDocument {
 	}
 	return &doc
 }
+
+func (f *FileDocumentRepo) DeleteByUUID(uuid string) error {
+	return f.db.Where("uuid = ?", uuid).Delete(&entity.FileDocument{}).Error
+}
@@ -3,8 +3,11 @@ package repo
 import (
 	"gorm.io/gorm"
 	"paperlink/db"
+	"paperlink/util"
 )
 
+var log = util.GroupLog("REPOSITORY")
+
 type Repository[T any] struct {
 	db *gorm.DB
 }
@@ -41,6 +44,12 @@ func (r *Repository[T]) GetList() ([]T, error) {
 	return entities, nil
 }
 
+func (r *Repository[T]) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(new(T)).Count(&count).Error
+	return count, err
+}
+
 func (r *Repository[T]) Delete(id any) error {
 	var entity T
 	return r.db.Delete(&entity, id).Error
@@ -0,0 +1,53 @@
+package repo
+
+import (
+	"errors"
+	"paperlink/db/entity"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SettingRepo struct {
+	*Repository[entity.Setting]
+}
+
+func newSettingRepo() *SettingRepo {
+	return &SettingRepo{NewRepository[entity.Setting]()}
+}
+
+var Setting = newSettingRepo()
+
+// GetString returns the value of the setting or the fallback if it is not set.
+func (r *SettingRepo) GetString(key string, fallback string) string {
+	var setting entity.Setting
+	err := r.db.Where("`key` = ?", key).First(&setting).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warnf("failed to read setting %s: %v", key, err)
+		}
+		return fallback
+	}
+	return setting.Value
+}
+
+func (r *SettingRepo) GetInt64(key string, fallback int64) int64 {
+	value, err := strconv.ParseInt(r.GetString(key, ""), 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func (r *SettingRepo) SetString(key string, value string) error {
+	return r.Save(&entity.Setting{
+		Key:       key,
+		Value:     value,
+		UpdatedAt: time.Now().Unix(),
+	})
+}
+
+func (r *SettingRepo) SetInt64(key string, value int64) error {
+	return r.SetString(key, strconv.FormatInt(value, 10))
+}
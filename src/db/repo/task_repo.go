@@ -16,12 +16,14 @@ func newTaskRepo() *TaskRepo {
 
 var Task = newTaskRepo()
 
-func (repo *TaskRepo) StartTask(name string) (*entity.Task, error) {
+func (repo *TaskRepo) QueueTask(kind, name, params string, priority int) (*entity.Task, error) {
 	task := entity.Task{
-		ID:        uuid.New().String(),
-		Status:    entity.RUNNING,
-		Name:      name,
-		StartTime: time.Now().Unix(),
+		ID:       uuid.New().String(),
+		Status:   entity.QUEUED,
+		Kind:     kind,
+		Name:     name,
+		Params:   params,
+		Priority: priority,
 	}
 	err := repo.Save(&task)
 	if err != nil {
@@ -30,6 +32,12 @@ func (repo *TaskRepo) StartTask(name string) (*entity.Task, error) {
 	return &task, nil
 }
 
+func (repo *TaskRepo) StartTask(task *entity.Task) error {
+	task.Status = entity.RUNNING
+	task.StartTime = time.Now().Unix()
+	return repo.Save(task)
+}
+
 func (repo *TaskRepo) FinishTask(task *entity.Task) error {
 	task.Status = entity.COMPLETED
 	task.EndTime = time.Now().Unix()
@@ -57,12 +65,97 @@ func (repo *TaskRepo) StopTask(task *entity.Task) error {
 	}
 	return nil
 }
+func (repo *TaskRepo) InterruptTask(task *entity.Task) error {
+	task.Status = entity.INTERRUPTED
+	task.EndTime = time.Now().Unix()
+	return repo.Save(task)
+}
 
-func (repo *TaskRepo) ListCompletedOrFailed() ([]*entity.Task, error) {
+func (repo *TaskRepo) ListByStatus(statuses ...entity.TaskStatus) ([]*entity.Task, error) {
 	var tasks []*entity.Task
-	err := repo.db.Where("status IN ?", []entity.TaskStatus{entity.COMPLETED, entity.FAILED, entity.STOPPED}).Find(&tasks).Error
+	err := repo.db.Where("status IN ?", statuses).Find(&tasks).Error
 	if err != nil {
 		return nil, err
 	}
 	return tasks, nil
 }
+
+// UpdateProgress stores the progress of a running task without touching the other
+// columns, which are only written when the task starts and finishes.
+func (repo *TaskRepo) UpdateProgress(id string, progress entity.TaskProgress) error {
+	return repo.db.Model(&entity.Task{}).Where("id = ?", id).Updates(map[string]any{
+		"progress_stage":            progress.Stage,
+		"progress_current":          progress.Current,
+		"progress_total":            progress.Total,
+		"progress_percent":          progress.Percent,
+		"progress_stage_started_at": progress.StageStartedAt,
+		"progress_eta":              progress.ETA,
+	}).Error
+}
+
+var finishedTaskStatuses = []entity.TaskStatus{entity.COMPLETED, entity.FAILED, entity.STOPPED, entity.INTERRUPTED}
+
+// ListPrunable returns the ids of the finished tasks that ended before the unix time or
+// are not among the newest keep finished tasks. A value of 0 disables either limit.
+func (repo *TaskRepo) ListPrunable(before int64, keep int) ([]string, error) {
+	ids := make(map[string]bool)
+	if before > 0 {
+		var old []string
+		err := repo.db.Model(&entity.Task{}).
+			Where("status IN ? AND end_time < ?", finishedTaskStatuses, before).
+			Pluck("id", &old).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range old {
+			ids[id] = true
+		}
+	}
+	if keep > 0 {
+		var excess []string
+		err := repo.db.Model(&entity.Task{}).
+			Where("status IN ?", finishedTaskStatuses).
+			Order("end_time DESC").Offset(keep).Limit(-1).
+			Pluck("id", &excess).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range excess {
+			ids[id] = true
+		}
+	}
+
+	result := make([]string, 0, len(ids))
+	for id := range ids {
+		result = append(result, id)
+	}
+	return result, nil
+}
+
+func (repo *TaskRepo) DeleteByIDs(ids []string) error {
+	return repo.db.Where("id IN ?", ids).Delete(&entity.Task{}).Error
+}
+
+// ListFiltered returns a page of tasks, queued tasks first and then the newest ones.
+// Empty filters match every task, name matches a part of the task name.
+func (repo *TaskRepo) ListFiltered(statuses []entity.TaskStatus, name string, limit, offset int) ([]entity.Task, int64, error) {
+	query := repo.db.Model(&entity.Task{})
+	if len(statuses) > 0 {
+		query = query.Where("status IN ?", statuses)
+	}
+	if name != "" {
+		query = query.Where("name LIKE ?", "%"+name+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var tasks []entity.Task
+	err := query.Order("CASE WHEN status = 'QUEUED' THEN 0 ELSE 1 END, start_time DESC").
+		Limit(limit).Offset(offset).Find(&tasks).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return tasks, total, nil
+}
@@ -2,6 +2,9 @@ package repo
 
 import (
 	"paperlink/db/entity"
+	"paperlink/util"
+	"slices"
+	"strings"
 )
 
 type UserRepo struct {
@@ -32,6 +35,67 @@ func (n *UserRepo) GetUserByName(name string) (*entity.User, error) {
 	return &user, err
 }
 
+func (n *UserRepo) GetUserByOIDCSubject(subject string) (*entity.User, error) {
+	var user entity.User
+	err := n.db.Where("oidc_subject = ?", subject).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ConsumeTOTPCounter marks the time step of a TOTP code as used. It returns false if the
+// step or a later one was used already, also by a concurrent request.
+func (n *UserRepo) ConsumeTOTPCounter(user *entity.User, counter int64) (bool, error) {
+	result := n.db.Model(&entity.User{}).
+		Where("id = ? AND totp_last_counter < ?", user.ID, counter).
+		Update("totp_last_counter", counter)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	user.TOTPLastCounter = counter
+	return true, nil
+}
+
+// ConsumeRecoveryCode removes the given recovery code from the user if it is valid. The
+// codes are only replaced if nobody changed them meanwhile, so a code is redeemed once
+// also by concurrent requests.
+func (n *UserRepo) ConsumeRecoveryCode(user *entity.User, code string) (bool, error) {
+	hash := util.HashRecoveryCode(code)
+	for attempt := 0; attempt < 3; attempt++ {
+		var current entity.User
+		if err := n.db.Select("totp_recovery_codes").Where("id = ?", user.ID).First(&current).Error; err != nil {
+			return false, err
+		}
+		if current.TOTPRecoveryCodes == "" {
+			return false, nil
+		}
+
+		hashes := strings.Split(current.TOTPRecoveryCodes, ",")
+		index := slices.Index(hashes, hash)
+		if index < 0 {
+			return false, nil
+		}
+		remaining := strings.Join(slices.Delete(hashes, index, index+1), ",")
+
+		result := n.db.Model(&entity.User{}).
+			Where("id = ? AND totp_recovery_codes = ?", user.ID, current.TOTPRecoveryCodes).
+			Update("totp_recovery_codes", remaining)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected == 1 {
+			user.TOTPRecoveryCodes = remaining
+			return true, nil
+		}
+		// Another code was redeemed meanwhile, look at the codes again.
+	}
+	return false, nil
+}
+
 func (n *DocumentRepo) GetOwnedDocuments(userId int) ([]entity.Document, error) {
 	var documents []entity.Document
 	err := n.db.Where("UserID = ?", userId).Find(&documents).Error
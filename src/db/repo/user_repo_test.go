@@ -0,0 +1,59 @@
+package repo
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"paperlink/db/entity"
+	"paperlink/util"
+)
+
+func TestConsumeRecoveryCodeOnce(t *testing.T) {
+	user := &entity.User{
+		Username:          "recovery",
+		Password:          "x",
+		TOTPEnabled:       true,
+		TOTPRecoveryCodes: strings.Join([]string{util.HashRecoveryCode("first"), util.HashRecoveryCode("second")}, ","),
+	}
+	if err := User.Save(user); err != nil {
+		t.Fatal(err)
+	}
+
+	var redeemed atomic.Int32
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stale := *user
+			used, err := User.ConsumeRecoveryCode(&stale, "first")
+			if err != nil {
+				t.Error(err)
+			}
+			if used {
+				redeemed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if redeemed.Load() != 1 {
+		t.Fatalf("code redeemed %d times, want once", redeemed.Load())
+	}
+
+	stale := *user
+	if ok, err := User.ConsumeTOTPCounter(user, 42); err != nil || !ok {
+		t.Fatalf("totp counter not consumed: %v", err)
+	}
+	if used, err := User.ConsumeRecoveryCode(&stale, "second"); err != nil || !used {
+		t.Fatalf("second code not redeemed: %v", err)
+	}
+	stored, err := User.Get(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.TOTPLastCounter != 42 || stored.TOTPRecoveryCodes != "" {
+		t.Fatalf("stored counter %d and codes %q, want 42 and none", stored.TOTPLastCounter, stored.TOTPRecoveryCodes)
+	}
+}
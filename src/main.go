@@ -4,6 +4,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"paperlink/db"
 	"paperlink/server"
+	"paperlink/service/d4s"
 	"paperlink/service/task"
 	"paperlink/util"
 )
@@ -13,5 +14,11 @@ func main() {
 	logrus.SetLevel(logrus.InfoLevel)
 	db.DB()
 	task.Init()
+	task.StartCleanup()
+	d4s.RecoverInterruptedBooks()
+	d4s.RegisterTaskKinds()
+	task.ResumeInterrupted()
+	d4s.StartScheduler()
+	d4s.StartHealthChecks()
 	server.Start()
 }
@@ -3,6 +3,7 @@ package middleware
 import (
 	"net/http"
 
+	"paperlink/db/entity"
 	"paperlink/db/repo"
 	"paperlink/server/routes"
 
@@ -32,5 +33,11 @@ func Admin(c *gin.Context) {
 		return
 	}
 
+	if !HasScope(c, entity.ScopeAdmin) {
+		c.Abort()
+		routes.JSONError(c, http.StatusForbidden, "token is missing the admin scope")
+		return
+	}
+
 	c.Next()
 }
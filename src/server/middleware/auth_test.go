@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scopedEngine serves a read route, an upload route and a session only route, all behind Auth.
+func scopedEngine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/read", Auth, RequireScope(entity.ScopeRead), ok)
+	r.GET("/upload", Auth, RequireScope(entity.ScopeUpload), ok)
+	r.GET("/session", Auth, SessionOnly, ok)
+	return r
+}
+
+func apiToken(t *testing.T, scopes ...entity.APITokenScope) string {
+	t.Helper()
+	user := &entity.User{Username: fmt.Sprintf("scoped-%v", scopes)}
+	if err := repo.User.Save(user); err != nil {
+		t.Fatal(err)
+	}
+	_, plain, err := repo.APIToken.Create(user.ID, "test", scopes, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plain
+}
+
+func TestAPITokenScopesArePerRoute(t *testing.T) {
+	r := scopedEngine()
+	read := apiToken(t, entity.ScopeRead)
+	upload := apiToken(t, entity.ScopeUpload)
+	admin := apiToken(t, entity.ScopeAdmin)
+
+	tests := []struct {
+		token string
+		path  string
+		want  int
+	}{
+		{read, "/read", http.StatusOK},
+		{read, "/upload", http.StatusForbidden},
+		{read, "/session", http.StatusForbidden},
+		{upload, "/read", http.StatusOK},
+		{upload, "/upload", http.StatusOK},
+		{upload, "/session", http.StatusForbidden},
+		{admin, "/read", http.StatusForbidden},
+		{admin, "/upload", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("GET %s with %s token: status = %d, want %d", tt.path, tt.token[:12], w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"paperlink/server/routes"
+	"paperlink/service/ratelimit"
+	"paperlink/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+const rateLimitResetKey = "rateLimitReset"
+
+var rateLimitLog = util.GroupLog("RATELIMIT")
+
+// RateLimit throttles failed requests per client IP, per the "username" field of the JSON body
+// and per the user of a TOTP "challenge" in it. Every 4xx response except 429 counts as a failed
+// attempt. The counters are only reset by handlers that call ResetRateLimit.
+//
+// Usernames are counted per route, so anyone failing to register or add a Digi4School
+// account under the name of a user does not lock that user out of the login.
+func RateLimit(c *gin.Context) {
+	keys := []string{"ip:" + c.ClientIP()}
+	limiters := []*ratelimit.Limiter{ratelimit.IP}
+	username, challenge := peekCredentials(c)
+	if username != "" {
+		keys = append(keys, "user:"+c.FullPath()+":"+strings.ToLower(username))
+		limiters = append(limiters, ratelimit.Username)
+	}
+	if challenge != "" {
+		// Keyed by the user rather than the challenge, a new login yields a new challenge.
+		if claims, err := util.ParseJWT(challenge); err == nil && claims.Type == "challenge" {
+			keys = append(keys, "totp:"+strconv.Itoa(claims.UserID))
+			limiters = append(limiters, ratelimit.TOTP)
+		}
+	}
+
+	for i, limiter := range limiters {
+		if wait := limiter.Check(keys[i]); wait > 0 {
+			rateLimitLog.Warnf("blocked %s %s for %s (%s)", c.Request.Method, c.FullPath(), keys[i], wait.Round(time.Second))
+			c.Header("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+			c.Abort()
+			routes.JSONError(c, http.StatusTooManyRequests, "too many attempts, try again later")
+			return
+		}
+	}
+
+	c.Next()
+
+	status := c.Writer.Status()
+	for i, limiter := range limiters {
+		switch {
+		case status >= 200 && status < 300 && c.GetBool(rateLimitResetKey):
+			limiter.Success(keys[i])
+		case status >= 400 && status < 500 && status != http.StatusTooManyRequests:
+			limiter.Fail(keys[i])
+		}
+	}
+}
+
+// ResetRateLimit marks the request as a completed authentication, RateLimit then forgets the
+// failures of its keys. Steps that only lead to a further factor, like the TOTP challenge of
+// the login, must not call it, or the second factor could be guessed without limit.
+func ResetRateLimit(c *gin.Context) {
+	c.Set(rateLimitResetKey, true)
+}
+
+func peekCredentials(c *gin.Context) (string, string) {
+	if c.Request.Body == nil {
+		return "", ""
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return "", ""
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var payload struct {
+		Username  string `json:"username"`
+		Challenge string `json:"challenge"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", ""
+	}
+	return strings.TrimSpace(payload.Username), strings.TrimSpace(payload.Challenge)
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"paperlink/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitedEngine serves POST /attempt and /register behind RateLimit. The response
+// status is taken from the "status" query, "reset" marks the request as a completed
+// authentication.
+func rateLimitedEngine(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if err := r.SetTrustedProxies(nil); err != nil {
+		t.Fatal(err)
+	}
+	handler := func(c *gin.Context) {
+		if c.Query("reset") != "" {
+			ResetRateLimit(c)
+		}
+		var status int
+		fmt.Sscan(c.Query("status"), &status)
+		c.Status(status)
+	}
+	r.POST("/attempt", RateLimit, handler)
+	r.POST("/register", RateLimit, handler)
+	return r
+}
+
+func attempt(r *gin.Engine, remoteAddr, query, body string, header http.Header) int {
+	return attemptAt(r, "/attempt", remoteAddr, query, body, header)
+}
+
+func attemptAt(r *gin.Engine, path, remoteAddr, query, body string, header http.Header) int {
+	req := httptest.NewRequest(http.MethodPost, path+"?"+query, strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRateLimitIgnoresForwardedForFromUntrustedPeers(t *testing.T) {
+	r := rateLimitedEngine(t)
+
+	// The free attempts of the IP limiter, each with a different forwarded address.
+	for i := 0; i < 6; i++ {
+		header := http.Header{"X-Forwarded-For": {fmt.Sprintf("203.0.113.%d", i)}}
+		attempt(r, "192.0.2.10:1234", "status=401", "{}", header)
+	}
+
+	header := http.Header{"X-Forwarded-For": {"203.0.113.99"}}
+	if code := attempt(r, "192.0.2.10:1234", "status=401", "{}", header); code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimitPartialSuccessKeepsFailures(t *testing.T) {
+	r := rateLimitedEngine(t)
+	addr := "192.0.2.20:1234"
+
+	for i := 0; i < 5; i++ {
+		attempt(r, addr, "status=401", "{}", nil)
+	}
+	// A 2xx without ResetRateLimit, like the TOTP challenge of the login.
+	attempt(r, addr, "status=200", "{}", nil)
+	attempt(r, addr, "status=401", "{}", nil)
+
+	if code := attempt(r, addr, "status=200", "{}", nil); code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimitResetForgetsFailures(t *testing.T) {
+	r := rateLimitedEngine(t)
+	addr := "192.0.2.30:1234"
+
+	for i := 0; i < 5; i++ {
+		attempt(r, addr, "status=401", "{}", nil)
+	}
+	attempt(r, addr, "status=200&reset=1", "{}", nil)
+	attempt(r, addr, "status=401", "{}", nil)
+
+	if code := attempt(r, addr, "status=200", "{}", nil); code != http.StatusOK {
+		t.Errorf("status = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestRateLimitCountsUsernamesPerRoute(t *testing.T) {
+	r := rateLimitedEngine(t)
+	body := `{"username":"Mallory-Target"}`
+
+	// Failed registrations with the name of the user do not lock the user out.
+	for i := 0; i < 4; i++ {
+		attemptAt(r, "/register", fmt.Sprintf("198.51.100.%d:1234", 50+i), "status=409", body, nil)
+	}
+	if code := attempt(r, "198.51.100.60:1234", "status=200", body, nil); code != http.StatusOK {
+		t.Errorf("login after failed registrations: status = %d, want %d", code, http.StatusOK)
+	}
+
+	for i := 0; i < 4; i++ {
+		attempt(r, fmt.Sprintf("198.51.100.%d:1234", 70+i), "status=401", body, nil)
+	}
+	if code := attempt(r, "198.51.100.80:1234", "status=200", body, nil); code != http.StatusTooManyRequests {
+		t.Errorf("login after failed logins: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimitThrottlesTOTPPerUser(t *testing.T) {
+	r := rateLimitedEngine(t)
+
+	// Every guess uses a new challenge from a new address, as if the password step was
+	// repeated in between. The failures still add up for the user.
+	for i := 0; i < 4; i++ {
+		challenge, err := util.GenerateChallengeJWT(4242, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := fmt.Sprintf(`{"challenge":%q,"code":"000000"}`, challenge)
+		attempt(r, fmt.Sprintf("198.51.100.%d:1234", i), "status=401", body, nil)
+	}
+
+	challenge, _ := util.GenerateChallengeJWT(4242, "alice")
+	body := fmt.Sprintf(`{"challenge":%q,"code":"000000"}`, challenge)
+	if code := attempt(r, "198.51.100.200:1234", "status=200", body, nil); code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
@@ -58,7 +58,7 @@ func Stats(c *gin.Context) {
 	}
 
 	// D4S books/accounts
-	d4sBooks, err := repo.Digi4SchoolBook.GetList()
+	d4sBooks, err := repo.Digi4SchoolBook.ListDownloaded()
 	if err != nil {
 		routes.JSONError(c, http.StatusInternalServerError, "failed to list d4s books")
 		return
@@ -2,7 +2,9 @@ package auth
 
 import (
 	"net/http"
+	"paperlink/db/entity"
 	"paperlink/db/repo"
+	"paperlink/server/middleware"
 	"paperlink/server/routes"
 	"paperlink/util"
 
@@ -16,12 +18,17 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	AccessToken string `json:"access"`
+	AccessToken string `json:"access,omitempty"`
+	// TOTPRequired is set when the user has two-factor authentication enabled.
+	// The Challenge token has to be exchanged at /api/v1/auth/login/totp.
+	TOTPRequired bool   `json:"totpRequired,omitempty"`
+	Challenge    string `json:"challenge,omitempty"`
 }
 
 // Login godoc
 // @Summary      Login user
 // @Description  Authenticates a user and returns a JWT access token.
+// @Description  If the user has TOTP enabled a challenge token is returned instead.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
@@ -52,13 +59,39 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	if user.TOTPEnabled {
+		challenge, err := util.GenerateChallengeJWT(user.ID, user.Username)
+		if err != nil {
+			log.Errorf("failed to generate challenge for user %s: %v", req.Username, err)
+			routes.JSONError(c, http.StatusInternalServerError, "failed to generate jwt")
+			return
+		}
+		routes.JSONSuccess(c, http.StatusOK, LoginResponse{
+			TOTPRequired: true,
+			Challenge:    challenge,
+		})
+		return
+	}
+
+	issueTokens(c, user)
+}
+
+func issueTokens(c *gin.Context, user *entity.User) {
 	access, refresh, err := util.GenerateJWT(user.ID, user.Username)
 	if err != nil {
-		log.Errorf("failed to generate jwt for user %s: %v", req.Username, err)
+		log.Errorf("failed to generate jwt for user %s: %v", user.Username, err)
 		routes.JSONError(c, http.StatusInternalServerError, "failed to generate jwt")
 		return
 	}
 
+	setRefreshCookie(c, refresh)
+	middleware.ResetRateLimit(c)
+	routes.JSONSuccess(c, http.StatusOK, LoginResponse{
+		AccessToken: access,
+	})
+}
+
+func setRefreshCookie(c *gin.Context, refresh string) {
 	c.SetCookie(
 		"refresh",
 		refresh,
@@ -68,8 +101,4 @@ func Login(c *gin.Context) {
 		false,
 		true,
 	)
-	routes.JSONSuccess(c, http.StatusOK, LoginResponse{
-		AccessToken: access,
-	})
-
 }
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"net/http"
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+	"paperlink/server/routes"
+	"paperlink/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LoginTOTPRequest struct {
+	Challenge string `json:"challenge" binding:"required"`
+	// Code is either the current TOTP code or one of the recovery codes.
+	Code string `json:"code" binding:"required"`
+}
+
+// LoginTOTP godoc
+// @Summary      Complete two-factor login
+// @Description  Exchanges the challenge token from the login endpoint and a TOTP or recovery code for a JWT access token.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      LoginTOTPRequest  true  "TOTP login payload"
+// @Success      200      {object}  LoginResponse
+// @Failure      400      {object}  routes.ErrorResponse "Invalid request body"
+// @Failure      401      {object}  routes.ErrorResponse "Invalid challenge or code"
+// @Failure      500      {object}  routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/auth/login/totp [post]
+func LoginTOTP(c *gin.Context) {
+	var req LoginTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("invalid totp login body: %v", err)
+		routes.JSONError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	claims, err := util.ParseJWT(req.Challenge)
+	if err != nil || claims.Type != "challenge" {
+		routes.JSONError(c, http.StatusUnauthorized, "invalid or expired challenge")
+		return
+	}
+
+	user, err := repo.User.Get(claims.UserID)
+	if err != nil || user == nil || !user.TOTPEnabled {
+		routes.JSONError(c, http.StatusUnauthorized, "invalid or expired challenge")
+		return
+	}
+
+	valid, err := verifyTOTP(user, req.Code)
+	if err != nil {
+		log.Errorf("failed to verify totp code for user %s: %v", user.Username, err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to verify code")
+		return
+	}
+	if !valid {
+		used, err := repo.User.ConsumeRecoveryCode(user, req.Code)
+		if err != nil {
+			log.Errorf("failed to consume recovery code for user %s: %v", user.Username, err)
+			routes.JSONError(c, http.StatusInternalServerError, "failed to verify code")
+			return
+		}
+		if !used {
+			log.Warnf("invalid totp code for user %s", user.Username)
+			routes.JSONError(c, http.StatusUnauthorized, "invalid code")
+			return
+		}
+		log.Infof("user %s logged in with a recovery code", user.Username)
+	}
+
+	issueTokens(c, user)
+}
+
+// verifyTOTP checks a TOTP code of the user and marks its time step as used, so the code
+// cannot be replayed.
+func verifyTOTP(user *entity.User, code string) (bool, error) {
+	secret, err := util.DecryptString(user.TOTPSecret)
+	if err != nil {
+		return false, err
+	}
+	counter, ok := util.MatchTOTP(secret, code, user.TOTPLastCounter)
+	if !ok {
+		return false, nil
+	}
+	return repo.User.ConsumeTOTPCounter(user, counter)
+}
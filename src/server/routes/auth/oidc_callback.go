@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"paperlink/server/routes"
+	"paperlink/service/oidc"
+	"paperlink/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OIDCCallback godoc
+// @Summary      OIDC login callback
+// @Description  Finishes the OIDC login, sets the refresh token cookie and redirects to the frontend.
+// @Description  The frontend obtains its access token through /api/v1/auth/refresh afterwards.
+// @Description  Users with TOTP enabled get no session. The redirect carries a challenge token in the fragment (#totpChallenge=...)
+// @Description  that the frontend completes through /api/v1/auth/login/totp, like a password login.
+// @Description  Flows started through /api/v1/auth/oidc/link link the identity to the user that started them and redirect without a new session.
+// @Description  The flow is only finished in the browser that started it, which holds its oidc_binding cookie.
+// @Tags         auth
+// @Param        code   query  string  true  "Authorization code"
+// @Param        state  query  string  true  "Login state"
+// @Success      302 "Redirect to the frontend"
+// @Failure      400 {object} routes.ErrorResponse "Invalid state, other browser or provider error"
+// @Failure      401 {object} routes.ErrorResponse "Identity not allowed"
+// @Failure      404 {object} routes.ErrorResponse "OIDC not configured"
+// @Failure      409 {object} routes.ErrorResponse "Username already taken or identity linked to another user"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/auth/oidc/callback [get]
+func OIDCCallback(c *gin.Context) {
+	provider := oidc.Default()
+	if !provider.Enabled() {
+		routes.JSONError(c, http.StatusNotFound, "oidc login not configured")
+		return
+	}
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		log.Warnf("identity provider returned error: %s %s", providerErr, c.Query("error_description"))
+		routes.JSONError(c, http.StatusBadRequest, "identity provider returned an error")
+		return
+	}
+
+	binding := takeOIDCBindingCookie(c)
+	login, err := provider.Exchange(c.Request.Context(), c.Query("state"), c.Query("code"), binding)
+	if err != nil {
+		log.Warnf("oidc login failed: %v", err)
+		routes.JSONError(c, http.StatusBadRequest, "oidc login failed")
+		return
+	}
+
+	if login.LinkUserID != 0 {
+		oidcLinkCallback(c, provider, login)
+		return
+	}
+
+	user, err := provider.ResolveUser(login.Claims)
+	switch {
+	case errors.Is(err, oidc.ErrUnknownUser), errors.Is(err, oidc.ErrMissingClaim):
+		log.Warnf("oidc login rejected: %v", err)
+		routes.JSONError(c, http.StatusUnauthorized, "no account is linked to this identity")
+		return
+	case errors.Is(err, oidc.ErrUsernameTaken):
+		routes.JSONError(c, http.StatusConflict, "username already taken, log in and link this identity to your account")
+		return
+	case err != nil:
+		log.Errorf("failed to resolve oidc user: %v", err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to resolve user")
+		return
+	}
+
+	if user.TOTPEnabled {
+		challenge, err := util.GenerateChallengeJWT(user.ID, user.Username)
+		if err != nil {
+			log.Errorf("failed to generate challenge jwt for user %s: %v", user.Username, err)
+			routes.JSONError(c, http.StatusInternalServerError, "failed to generate jwt")
+			return
+		}
+		c.Redirect(http.StatusFound, provider.Config().PostLoginRedirect+"#totpChallenge="+url.QueryEscape(challenge))
+		return
+	}
+
+	_, refresh, err := util.GenerateJWT(user.ID, user.Username)
+	if err != nil {
+		log.Errorf("failed to generate jwt for user %s: %v", user.Username, err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to generate jwt")
+		return
+	}
+
+	setRefreshCookie(c, refresh)
+	c.Redirect(http.StatusFound, provider.Config().PostLoginRedirect)
+}
+
+func oidcLinkCallback(c *gin.Context, provider *oidc.Provider, login *oidc.Login) {
+	_, err := provider.LinkUser(login.LinkUserID, login.Claims)
+	switch {
+	case errors.Is(err, oidc.ErrAlreadyLinked):
+		routes.JSONError(c, http.StatusConflict, "identity is already linked to another user")
+		return
+	case errors.Is(err, oidc.ErrMissingClaim):
+		log.Warnf("oidc link rejected: %v", err)
+		routes.JSONError(c, http.StatusBadRequest, "oidc login failed")
+		return
+	case err != nil:
+		log.Errorf("failed to link oidc identity to user %d: %v", login.LinkUserID, err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to link identity")
+		return
+	}
+
+	c.Redirect(http.StatusFound, provider.Config().PostLoginRedirect)
+}
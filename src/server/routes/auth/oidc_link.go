@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"net/http"
+	"paperlink/server/routes"
+	"paperlink/service/oidc"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OIDCLinkResponse struct {
+	// URL is the identity provider login the browser has to be sent to.
+	URL string `json:"url"`
+}
+
+// OIDCLink godoc
+// @Summary      Link OIDC identity
+// @Description  Starts a login at the identity provider that links the identity to the authenticated user instead of logging in.
+// @Description  Existing local users link their account once, afterwards they can log in through the identity provider.
+// @Tags         auth
+// @Produce      json
+// @Success      200 {object} OIDCLinkResponse
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      403 {object} routes.ErrorResponse "Not allowed with an api token"
+// @Failure      404 {object} routes.ErrorResponse "OIDC not configured"
+// @Failure      502 {object} routes.ErrorResponse "Identity provider unreachable"
+// @Router       /api/v1/auth/oidc/link [post]
+// @Security     BearerAuth
+func OIDCLink(c *gin.Context) {
+	provider := oidc.Default()
+	if !provider.Enabled() {
+		routes.JSONError(c, http.StatusNotFound, "oidc login not configured")
+		return
+	}
+
+	url, binding, err := provider.AuthCodeURL(c.Request.Context(), c.GetInt("userId"))
+	if err != nil {
+		log.Errorf("failed to start oidc link: %v", err)
+		routes.JSONError(c, http.StatusBadGateway, "identity provider unavailable")
+		return
+	}
+
+	// Without it, an attacker could send the URL to a victim and get the identity of the
+	// victim linked to the account of the attacker.
+	setOIDCBindingCookie(c, binding)
+	routes.JSONSuccessOK(c, OIDCLinkResponse{URL: url})
+}
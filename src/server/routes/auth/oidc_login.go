@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"net/http"
+	"paperlink/server/routes"
+	"paperlink/service/oidc"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OIDCLogin godoc
+// @Summary      Start OIDC login
+// @Description  Redirects the browser to the identity provider using the authorization code flow with PKCE.
+// @Tags         auth
+// @Success      302 "Redirect to the identity provider"
+// @Failure      404 {object} routes.ErrorResponse "OIDC not configured"
+// @Failure      502 {object} routes.ErrorResponse "Identity provider unreachable"
+// @Router       /api/v1/auth/oidc/login [get]
+func OIDCLogin(c *gin.Context) {
+	provider := oidc.Default()
+	if !provider.Enabled() {
+		routes.JSONError(c, http.StatusNotFound, "oidc login not configured")
+		return
+	}
+
+	url, binding, err := provider.AuthCodeURL(c.Request.Context(), 0)
+	if err != nil {
+		log.Errorf("failed to start oidc login: %v", err)
+		routes.JSONError(c, http.StatusBadGateway, "identity provider unavailable")
+		return
+	}
+
+	setOIDCBindingCookie(c, binding)
+	c.Redirect(http.StatusFound, url)
+}
+
+const (
+	oidcBindingCookie = "oidc_binding"
+	oidcCookiePath    = "/api/v1/auth/oidc"
+)
+
+// setOIDCBindingCookie ties a started flow to the browser, the callback only finishes it
+// with this cookie. The callback is a top-level navigation from the identity provider,
+// which SameSite=Lax cookies are sent with.
+func setOIDCBindingCookie(c *gin.Context, binding string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcBindingCookie, binding, int(oidc.FlowTTL.Seconds()), oidcCookiePath, "", false, true)
+}
+
+// takeOIDCBindingCookie returns the binding of the browser and clears it, a flow is only
+// finished once.
+func takeOIDCBindingCookie(c *gin.Context) string {
+	binding, _ := c.Cookie(oidcBindingCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcBindingCookie, "", -1, oidcCookiePath, "", false, true)
+	return binding
+}
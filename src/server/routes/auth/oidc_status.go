@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"paperlink/server/routes"
+	"paperlink/service/oidc"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OIDCStatusResponse struct {
+	Enabled bool `json:"enabled"`
+}
+
+// OIDCStatus godoc
+// @Summary      OIDC login availability
+// @Description  Reports whether login through the configured OpenID Connect provider is available.
+// @Tags         auth
+// @Produce      json
+// @Success      200 {object} OIDCStatusResponse
+// @Router       /api/v1/auth/oidc [get]
+func OIDCStatus(c *gin.Context) {
+	routes.JSONSuccessOK(c, OIDCStatusResponse{Enabled: oidc.Default().Enabled()})
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"paperlink/db/entity"
 	"paperlink/db/repo"
+	"paperlink/server/middleware"
 	"paperlink/server/routes"
 	"time"
 )
@@ -81,6 +82,7 @@ func Register(c *gin.Context) {
 		log.Warnf("failed to update invite: %v", err)
 	}
 
+	middleware.ResetRateLimit(c)
 	routes.JSONSuccess(c, http.StatusOK, gin.H{
 		"message": "ok",
 	})
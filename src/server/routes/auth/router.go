@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"paperlink/db/entity"
 	"paperlink/server/middleware"
 	"paperlink/util"
 
@@ -11,10 +12,18 @@ var log = util.GroupLog("AUTH")
 
 func InitAuthRouter(r *gin.Engine) {
 	group := r.Group("/api/v1/auth")
-	group.POST("/register", Register)
-	group.POST("/login", Login)
+	group.POST("/register", middleware.RateLimit, Register)
+	group.POST("/login", middleware.RateLimit, Login)
+	group.POST("/login/totp", middleware.RateLimit, LoginTOTP)
+	group.GET("/oidc", OIDCStatus)
+	group.GET("/oidc/login", OIDCLogin)
+	group.GET("/oidc/callback", OIDCCallback)
+	group.POST("/oidc/link", middleware.Auth, middleware.SessionOnly, OIDCLink)
 	group.POST("/refresh", Refresh)
 	group.POST("/logout", Logout)
-	group.GET("/me", middleware.Auth, Me)
+	group.GET("/me", middleware.Auth, middleware.RequireScope(entity.ScopeRead), Me)
 	group.GET("/hasAdmin", middleware.Auth, middleware.Admin, HasAdmin)
+	group.POST("/totp/setup", middleware.Auth, middleware.SessionOnly, TOTPSetup)
+	group.POST("/totp/enable", middleware.Auth, middleware.SessionOnly, TOTPEnable)
+	group.POST("/totp/disable", middleware.Auth, middleware.SessionOnly, TOTPDisable)
 }
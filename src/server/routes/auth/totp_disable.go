@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"net/http"
+	"paperlink/db/repo"
+	"paperlink/server/routes"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TOTPDisable godoc
+// @Summary      Disable TOTP
+// @Description  Disables two-factor authentication. Requires a valid TOTP or recovery code.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      TOTPCodeRequest  true  "TOTP or recovery code"
+// @Success      200 {object} routes.Response
+// @Failure      400 {object} routes.ErrorResponse "Invalid request body or TOTP not enabled"
+// @Failure      401 {object} routes.ErrorResponse "Invalid code"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/auth/totp/disable [post]
+// @Security     BearerAuth
+func TOTPDisable(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		routes.JSONError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, err := repo.User.Get(c.GetInt("userId"))
+	if err != nil || user == nil {
+		routes.JSONError(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	if !user.TOTPEnabled {
+		routes.JSONError(c, http.StatusBadRequest, "totp not enabled")
+		return
+	}
+
+	valid, err := verifyTOTP(user, req.Code)
+	if err != nil {
+		log.Errorf("failed to verify totp code for user %s: %v", user.Username, err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to verify code")
+		return
+	}
+	if !valid {
+		used, err := repo.User.ConsumeRecoveryCode(user, req.Code)
+		if err != nil {
+			log.Errorf("failed to consume recovery code for user %s: %v", user.Username, err)
+			routes.JSONError(c, http.StatusInternalServerError, "failed to verify code")
+			return
+		}
+		if !used {
+			routes.JSONError(c, http.StatusUnauthorized, "invalid code")
+			return
+		}
+	}
+
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPRecoveryCodes = ""
+	if err := repo.User.Save(user); err != nil {
+		log.Errorf("failed to disable totp for user %s: %v", user.Username, err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to disable totp")
+		return
+	}
+
+	log.Infof("user %s disabled totp", user.Username)
+	routes.JSONSuccessOK(c, gin.H{"message": "ok"})
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"net/http"
+	"paperlink/db/repo"
+	"paperlink/server/routes"
+	"paperlink/util"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const recoveryCodeCount = 10
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TOTPEnableResponse struct {
+	// RecoveryCodes are only returned once and can each be used a single time instead of a TOTP code.
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// TOTPEnable godoc
+// @Summary      Enable TOTP
+// @Description  Verifies a code for the secret from /api/v1/auth/totp/setup and enables two-factor authentication.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      TOTPCodeRequest  true  "TOTP code"
+// @Success      200 {object} TOTPEnableResponse
+// @Failure      400 {object} routes.ErrorResponse "Invalid request body or no pending setup"
+// @Failure      401 {object} routes.ErrorResponse "Invalid code"
+// @Failure      409 {object} routes.ErrorResponse "TOTP already enabled"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/auth/totp/enable [post]
+// @Security     BearerAuth
+func TOTPEnable(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		routes.JSONError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, err := repo.User.Get(c.GetInt("userId"))
+	if err != nil || user == nil {
+		routes.JSONError(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	if user.TOTPEnabled {
+		routes.JSONError(c, http.StatusConflict, "totp already enabled")
+		return
+	}
+	if user.TOTPSecret == "" {
+		routes.JSONError(c, http.StatusBadRequest, "no totp setup in progress")
+		return
+	}
+
+	valid, err := verifyTOTP(user, req.Code)
+	if err != nil {
+		log.Errorf("failed to verify totp code for user %s: %v", user.Username, err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to verify code")
+		return
+	}
+	if !valid {
+		routes.JSONError(c, http.StatusUnauthorized, "invalid code")
+		return
+	}
+
+	codes, err := util.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		log.Errorf("failed to generate recovery codes: %v", err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to generate recovery codes")
+		return
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, util.HashRecoveryCode(code))
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPRecoveryCodes = strings.Join(hashes, ",")
+	if err := repo.User.Save(user); err != nil {
+		log.Errorf("failed to enable totp for user %s: %v", user.Username, err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to enable totp")
+		return
+	}
+
+	log.Infof("user %s enabled totp", user.Username)
+	routes.JSONSuccessOK(c, TOTPEnableResponse{RecoveryCodes: codes})
+}
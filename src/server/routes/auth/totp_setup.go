@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"net/http"
+	"paperlink/db/repo"
+	"paperlink/server/routes"
+	"paperlink/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+const totpIssuer = "PaperLink"
+
+type TOTPSetupResponse struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth:// provisioning URI to render as QR code.
+	URI string `json:"uri"`
+}
+
+// TOTPSetup godoc
+// @Summary      Start TOTP enrollment
+// @Description  Generates a new TOTP secret for the current user. It only becomes active after it was verified with /api/v1/auth/totp/enable.
+// @Tags         auth
+// @Produce      json
+// @Success      200 {object} TOTPSetupResponse
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      409 {object} routes.ErrorResponse "TOTP already enabled"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/auth/totp/setup [post]
+// @Security     BearerAuth
+func TOTPSetup(c *gin.Context) {
+	user, err := repo.User.Get(c.GetInt("userId"))
+	if err != nil || user == nil {
+		routes.JSONError(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	if user.TOTPEnabled {
+		routes.JSONError(c, http.StatusConflict, "totp already enabled")
+		return
+	}
+
+	secret, err := util.GenerateTOTPSecret()
+	if err != nil {
+		log.Errorf("failed to generate totp secret: %v", err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to generate secret")
+		return
+	}
+
+	encrypted, err := util.EncryptString(secret)
+	if err != nil {
+		log.Errorf("failed to encrypt totp secret: %v", err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to save secret")
+		return
+	}
+
+	user.TOTPSecret = encrypted
+	if err := repo.User.Save(user); err != nil {
+		log.Errorf("failed to save totp secret for user %s: %v", user.Username, err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to save secret")
+		return
+	}
+
+	routes.JSONSuccessOK(c, TOTPSetupResponse{
+		Secret: secret,
+		URI:    util.TOTPProvisioningURI(totpIssuer, user.Username, secret),
+	})
+}
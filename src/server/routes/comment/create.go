@@ -0,0 +1,48 @@
+package comment
+
+import (
+	"net/http"
+
+	"paperlink/server/routes"
+	comment_service "paperlink/service/comment"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateRequest struct {
+	Page int64 `json:"page" binding:"required"`
+	// AnnotationID anchors the thread to an annotation on the page.
+	AnnotationID *int   `json:"annotationId"`
+	Text         string `json:"text" binding:"required"`
+}
+
+// Create godoc
+// @Summary      Create comment thread
+// @Description  Starts a comment thread on a page of the document. Users mentioned as @username who can access the document are notified.
+// @Tags         comment
+// @Accept       json
+// @Produce      json
+// @Param        id      path string        true "Document UUID"
+// @Param        request body CreateRequest true "Thread"
+// @Success      200 {object} comment_service.ThreadView
+// @Failure      400 {object} routes.ErrorResponse "Invalid comment or annotation"
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      403 {object} routes.ErrorResponse "Forbidden"
+// @Failure      404 {object} routes.ErrorResponse "Document not found"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/comment/create/{id} [post]
+// @Security     BearerAuth
+func Create(c *gin.Context) {
+	var req CreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		routes.JSONError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	thread, err := comment_service.CreateThread(c.Param("id"), c.GetInt("userId"), req.Page, req.AnnotationID, req.Text)
+	if err != nil {
+		writeError(c, err, "create comment thread")
+		return
+	}
+	routes.JSONSuccessOK(c, thread)
+}
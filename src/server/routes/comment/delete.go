@@ -0,0 +1,36 @@
+package comment
+
+import (
+	"paperlink/server/routes"
+	comment_service "paperlink/service/comment"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Delete godoc
+// @Summary      Delete comment
+// @Description  Deletes a comment of the authenticated user, document owners may delete any comment. The thread is deleted with its last comment and null is returned.
+// @Tags         comment
+// @Produce      json
+// @Param        commentId path int true "Comment ID"
+// @Success      200 {object} comment_service.ThreadView
+// @Failure      400 {object} routes.ErrorResponse "Invalid comment ID"
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      403 {object} routes.ErrorResponse "Forbidden"
+// @Failure      404 {object} routes.ErrorResponse "Comment not found"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/comment/delete/{commentId} [delete]
+// @Security     BearerAuth
+func Delete(c *gin.Context) {
+	commentID, ok := pathID(c, "commentId")
+	if !ok {
+		return
+	}
+
+	thread, err := comment_service.DeleteComment(commentID, c.GetInt("userId"))
+	if err != nil {
+		writeError(c, err, "delete comment")
+		return
+	}
+	routes.JSONSuccessOK(c, thread)
+}
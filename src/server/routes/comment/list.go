@@ -0,0 +1,45 @@
+package comment
+
+import (
+	"net/http"
+	"strconv"
+
+	"paperlink/server/routes"
+	comment_service "paperlink/service/comment"
+
+	"github.com/gin-gonic/gin"
+)
+
+// List godoc
+// @Summary      List comment threads
+// @Description  Returns the comment threads of a document with their comments, optionally only those of one page.
+// @Tags         comment
+// @Produce      json
+// @Param        id    path   string true  "Document UUID"
+// @Param        page  query  int    false "Page"
+// @Success      200 {array}  comment_service.ThreadView
+// @Failure      400 {object} routes.ErrorResponse "Invalid page"
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      403 {object} routes.ErrorResponse "Forbidden"
+// @Failure      404 {object} routes.ErrorResponse "Document not found"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/comment/list/{id} [get]
+// @Security     BearerAuth
+func List(c *gin.Context) {
+	var page *int64
+	if raw := c.Query("page"); raw != "" {
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || value < 1 {
+			routes.JSONError(c, http.StatusBadRequest, "invalid page")
+			return
+		}
+		page = &value
+	}
+
+	threads, err := comment_service.ListThreads(c.Param("id"), c.GetInt("userId"), page)
+	if err != nil {
+		writeError(c, err, "list comments")
+		return
+	}
+	routes.JSONSuccessOK(c, threads)
+}
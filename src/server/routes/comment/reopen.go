@@ -0,0 +1,36 @@
+package comment
+
+import (
+	"paperlink/server/routes"
+	comment_service "paperlink/service/comment"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Reopen godoc
+// @Summary      Reopen comment thread
+// @Description  Marks a resolved thread as open again.
+// @Tags         comment
+// @Produce      json
+// @Param        threadId path int true "Thread ID"
+// @Success      200 {object} comment_service.ThreadView
+// @Failure      400 {object} routes.ErrorResponse "Invalid thread ID"
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      403 {object} routes.ErrorResponse "Forbidden"
+// @Failure      404 {object} routes.ErrorResponse "Thread not found"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/comment/reopen/{threadId} [post]
+// @Security     BearerAuth
+func Reopen(c *gin.Context) {
+	threadID, ok := pathID(c, "threadId")
+	if !ok {
+		return
+	}
+
+	thread, err := comment_service.SetResolved(threadID, c.GetInt("userId"), false)
+	if err != nil {
+		writeError(c, err, "reopen comment thread")
+		return
+	}
+	routes.JSONSuccessOK(c, thread)
+}
@@ -0,0 +1,50 @@
+package comment
+
+import (
+	"net/http"
+
+	"paperlink/server/routes"
+	comment_service "paperlink/service/comment"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReplyRequest struct {
+	Text string `json:"text" binding:"required"`
+}
+
+// Reply godoc
+// @Summary      Reply to comment thread
+// @Description  Adds a comment to the thread and reopens it if it was resolved.
+// @Tags         comment
+// @Accept       json
+// @Produce      json
+// @Param        threadId path int          true "Thread ID"
+// @Param        request  body ReplyRequest true "Reply"
+// @Success      200 {object} comment_service.ThreadView
+// @Failure      400 {object} routes.ErrorResponse "Invalid comment"
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      403 {object} routes.ErrorResponse "Forbidden"
+// @Failure      404 {object} routes.ErrorResponse "Thread not found"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/comment/reply/{threadId} [post]
+// @Security     BearerAuth
+func Reply(c *gin.Context) {
+	threadID, ok := pathID(c, "threadId")
+	if !ok {
+		return
+	}
+
+	var req ReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		routes.JSONError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	thread, err := comment_service.Reply(threadID, c.GetInt("userId"), req.Text)
+	if err != nil {
+		writeError(c, err, "reply to comment thread")
+		return
+	}
+	routes.JSONSuccessOK(c, thread)
+}
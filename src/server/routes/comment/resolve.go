@@ -0,0 +1,36 @@
+package comment
+
+import (
+	"paperlink/server/routes"
+	comment_service "paperlink/service/comment"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Resolve godoc
+// @Summary      Resolve comment thread
+// @Description  Marks the thread as resolved.
+// @Tags         comment
+// @Produce      json
+// @Param        threadId path int true "Thread ID"
+// @Success      200 {object} comment_service.ThreadView
+// @Failure      400 {object} routes.ErrorResponse "Invalid thread ID"
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      403 {object} routes.ErrorResponse "Forbidden"
+// @Failure      404 {object} routes.ErrorResponse "Thread not found"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/comment/resolve/{threadId} [post]
+// @Security     BearerAuth
+func Resolve(c *gin.Context) {
+	threadID, ok := pathID(c, "threadId")
+	if !ok {
+		return
+	}
+
+	thread, err := comment_service.SetResolved(threadID, c.GetInt("userId"), true)
+	if err != nil {
+		writeError(c, err, "resolve comment thread")
+		return
+	}
+	routes.JSONSuccessOK(c, thread)
+}
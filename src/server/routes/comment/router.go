@@ -0,0 +1,54 @@
+package comment
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"paperlink/db/entity"
+	"paperlink/server/middleware"
+	"paperlink/server/routes"
+	comment_service "paperlink/service/comment"
+	"paperlink/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+var log = util.GroupLog("COMMENT")
+
+func InitCommentRouter(r *gin.Engine) {
+	group := r.Group("/api/v1/comment")
+	group.Use(middleware.Auth)
+	group.GET("/list/:id", middleware.RequireScope(entity.ScopeRead), List)
+	group.POST("/create/:id", middleware.SessionOnly, Create)
+	group.POST("/reply/:threadId", middleware.SessionOnly, Reply)
+	group.POST("/resolve/:threadId", middleware.SessionOnly, Resolve)
+	group.POST("/reopen/:threadId", middleware.SessionOnly, Reopen)
+	group.DELETE("/delete/:commentId", middleware.SessionOnly, Delete)
+}
+
+func pathID(c *gin.Context, key string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(key))
+	if err != nil || id < 1 {
+		routes.JSONError(c, http.StatusBadRequest, "invalid "+key)
+		return 0, false
+	}
+	return id, true
+}
+
+func writeError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, comment_service.ErrInvalidComment),
+		errors.Is(err, comment_service.ErrInvalidAnchor):
+		routes.JSONError(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, comment_service.ErrForbidden):
+		routes.JSONError(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, comment_service.ErrDocumentNotFound),
+		errors.Is(err, comment_service.ErrThreadNotFound),
+		errors.Is(err, comment_service.ErrCommentNotFound):
+		routes.JSONError(c, http.StatusNotFound, err.Error())
+	default:
+		log.Errorf("failed to %s: %v", action, err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to "+action)
+	}
+}
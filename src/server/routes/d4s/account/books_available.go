@@ -0,0 +1,48 @@
+package account
+
+import (
+	"errors"
+	"net/http"
+	"paperlink/server/routes"
+	"paperlink/service/d4s"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AvailableBooksResponse struct {
+	Accounts []d4s.AccountBooks `json:"accounts"`
+}
+
+// AvailableBooks godoc
+// @Summary      List available Digi4School books
+// @Description  Lists the books of the accounts that are not downloaded yet, including failed and excluded ones.
+// @Tags         digi4school
+// @Produce      json
+// @Param        ids  query      string  false  "Comma-separated account IDs or 'all' (default)"
+// @Success      200 {object} AvailableBooksResponse
+// @Failure      400 {object} routes.ErrorResponse "Invalid IDs"
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      403 {object} routes.ErrorResponse "Forbidden"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/d4s/account/books [get]
+// @Security     BearerAuth
+func AvailableBooks(c *gin.Context) {
+	accounts, err := d4s.AccountsForSelection(c.DefaultQuery("ids", "all"))
+	if errors.Is(err, d4s.ErrInvalidAccountSelection) {
+		routes.JSONError(c, http.StatusBadRequest, "invalid account IDs")
+		return
+	}
+	if err != nil {
+		log.Errorf("failed to fetch digi4school accounts: %v", err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to fetch accounts")
+		return
+	}
+
+	books, err := d4s.AvailableBooks(accounts)
+	if err != nil {
+		log.Errorf("failed to list available books: %v", err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to list books")
+		return
+	}
+	routes.JSONSuccessOK(c, AvailableBooksResponse{Accounts: books})
+}
@@ -0,0 +1,52 @@
+package account
+
+import (
+	"net/http"
+	"paperlink/db/repo"
+	"paperlink/server/routes"
+	"paperlink/service/d4s"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DownloadBooksRequest struct {
+	AccountID int      `json:"accountId" binding:"required"`
+	BookIDs   []string `json:"bookIds" binding:"required,min=1"`
+}
+
+// DownloadBooks godoc
+// @Summary      Download selected Digi4School books
+// @Description  Queues a task that downloads only the selected books of an account. Excluded books are downloaded as well.
+// @Tags         digi4school
+// @Accept       json
+// @Produce      json
+// @Param        request body DownloadBooksRequest true "Books to download"
+// @Success      200 {object} SyncD4SResponse
+// @Failure      400 {object} routes.ErrorResponse "Invalid request body"
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      403 {object} routes.ErrorResponse "Forbidden"
+// @Failure      404 {object} routes.ErrorResponse "Account not found"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/d4s/account/books/download [post]
+// @Security     BearerAuth
+func DownloadBooks(c *gin.Context) {
+	var req DownloadBooksRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		routes.JSONError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	acc, err := repo.Digi4SchoolAccount.Get(req.AccountID)
+	if err != nil {
+		routes.JSONError(c, http.StatusNotFound, "account not found")
+		return
+	}
+
+	id, err := d4s.StartBookDownloadTask(*acc, req.BookIDs)
+	if err != nil {
+		routes.JSONError(c, http.StatusInternalServerError, "failed to start download task")
+		return
+	}
+
+	routes.JSONSuccessOK(c, SyncD4SResponse{ID: id})
+}
@@ -0,0 +1,61 @@
+package account
+
+import (
+	"errors"
+	"net/http"
+	"paperlink/server/routes"
+	"paperlink/service/d4s"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ExcludeBookRequest struct {
+	AccountID int    `json:"accountId" binding:"required"`
+	BookID    string `json:"bookId" binding:"required"`
+	// Name is stored for books that were never selected for download before.
+	Name string `json:"name"`
+	// Excluded false lifts the exclusion again.
+	Excluded bool `json:"excluded"`
+}
+
+// ExcludeBook godoc
+// @Summary      Exclude a Digi4School book
+// @Description  Excludes a book from every sync or lifts the exclusion.
+// @Tags         digi4school
+// @Accept       json
+// @Produce      json
+// @Param        request body ExcludeBookRequest true "Book to exclude"
+// @Success      200 {object} routes.Response
+// @Failure      400 {object} routes.ErrorResponse "Invalid request body"
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      403 {object} routes.ErrorResponse "Forbidden"
+// @Failure      409 {object} routes.ErrorResponse "Book is downloaded or being downloaded"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/d4s/account/books/exclude [post]
+// @Security     BearerAuth
+func ExcludeBook(c *gin.Context) {
+	var req ExcludeBookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		routes.JSONError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	err := d4s.SetBookExcluded(req.AccountID, req.BookID, req.Name, req.Excluded)
+	switch {
+	case errors.Is(err, d4s.ErrBookNotExcluded):
+		routes.JSONError(c, http.StatusBadRequest, "book is not excluded")
+		return
+	case errors.Is(err, d4s.ErrBookDownloaded):
+		routes.JSONError(c, http.StatusConflict, "book is already downloaded")
+		return
+	case errors.Is(err, d4s.ErrBookDownloading):
+		routes.JSONError(c, http.StatusConflict, "book is being downloaded")
+		return
+	case err != nil:
+		log.Errorf("failed to exclude book %s: %v", req.BookID, err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to exclude book")
+		return
+	}
+
+	routes.JSONSuccessOK(c, gin.H{"message": "ok"})
+}
@@ -0,0 +1,42 @@
+package account
+
+import (
+	"errors"
+	"net/http"
+	"paperlink/server/routes"
+	"paperlink/service/d4s"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RetryBook godoc
+// @Summary      Retry a failed Digi4School book
+// @Description  Queues a task that downloads a single failed book again, without syncing the accounts.
+// @Tags         digi4school
+// @Produce      json
+// @Param        bookId path string true "Digi4School book ID"
+// @Success      200 {object} SyncD4SResponse
+// @Failure      400 {object} routes.ErrorResponse "Book did not fail"
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      403 {object} routes.ErrorResponse "Forbidden"
+// @Failure      404 {object} routes.ErrorResponse "Book not found"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/d4s/account/books/retry/{bookId} [post]
+// @Security     BearerAuth
+func RetryBook(c *gin.Context) {
+	id, err := d4s.RetryBook(c.Param("bookId"))
+	switch {
+	case errors.Is(err, d4s.ErrBookNotFound):
+		routes.JSONError(c, http.StatusNotFound, "book not found")
+		return
+	case errors.Is(err, d4s.ErrBookNotFailed):
+		routes.JSONError(c, http.StatusBadRequest, "only failed books can be retried")
+		return
+	case err != nil:
+		log.Errorf("failed to retry book: %v", err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to start retry task")
+		return
+	}
+
+	routes.JSONSuccessOK(c, SyncD4SResponse{ID: id})
+}
@@ -4,8 +4,11 @@ import (
 	"net/http"
 	"paperlink/db/entity"
 	"paperlink/db/repo"
+	"paperlink/server/middleware"
 	"paperlink/server/routes"
 	"paperlink/service/d4s"
+	"paperlink/util"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -31,6 +34,7 @@ type CreateDigi4SchoolAccountResponse struct {
 // @Failure      401 {object} routes.ErrorResponse "Unauthorized"
 // @Failure      403 {object} routes.ErrorResponse "Forbidden"
 // @Failure      409 {object} routes.ErrorResponse "Failed to create account"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
 // @Router       /api/v1/digi4school/accounts [post]
 // @Security     BearerAuth
 func Create(c *gin.Context) {
@@ -41,9 +45,16 @@ func Create(c *gin.Context) {
 		return
 	}
 
+	password, err := util.EncryptString(req.Password)
+	if err != nil {
+		log.Errorf("failed to encrypt digi4school password: %v", err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to create account")
+		return
+	}
+
 	account := entity.Digi4SchoolAccount{
 		Username: req.Username,
-		Password: req.Password,
+		Password: password,
 	}
 
 	if !d4s.TestLogin(&account) {
@@ -51,6 +62,8 @@ func Create(c *gin.Context) {
 		routes.JSONError(c, http.StatusBadRequest, "invalid credentials for account")
 		return
 	}
+	account.Status = entity.AccountStatusOK
+	account.LastCheckedAt = time.Now().Unix()
 
 	if err := repo.Digi4SchoolAccount.Save(&account); err != nil {
 		log.Errorf("failed to save digi4school account: %v", err)
@@ -58,6 +71,7 @@ func Create(c *gin.Context) {
 		return
 	}
 
+	middleware.ResetRateLimit(c)
 	routes.JSONSuccess(c, http.StatusCreated, CreateDigi4SchoolAccountResponse{
 		ID: account.ID,
 	})
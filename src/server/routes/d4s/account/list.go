@@ -16,7 +16,7 @@ type ListD4SAccountsResponse struct {
 
 // List godoc
 // @Summary      List Digi4School accounts
-// @Description  Lists all stored Digi4School accounts (admin only). Passwords are not returned.
+// @Description  Lists all stored Digi4School accounts (admin only) with the status of their last login check. Passwords are not returned.
 // @Tags         digi4school
 // @Produce      json
 // @Success      200 {object} ListD4SAccountsResponse
@@ -33,10 +33,5 @@ func List(c *gin.Context) {
 		return
 	}
 
-	// Never return passwords.
-	for i := range accounts {
-		accounts[i].Password = ""
-	}
-
 	routes.JSONSuccessOK(c, ListD4SAccountsResponse{Accounts: accounts})
 }
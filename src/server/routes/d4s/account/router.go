@@ -10,10 +10,16 @@ var log = util.GroupLog("DIGI4SCHOOL_ACCOUNT")
 
 func InitDigi4SchoolAccountRouter(r *gin.RouterGroup) {
 	group := r.Group("/account")
-	group.Use(middleware.Admin)
-	group.POST("/create", Create)
+	group.Use(middleware.SessionOnly, middleware.Admin)
+	group.POST("/create", middleware.RateLimit, Create)
 	group.DELETE("/delete/:id", Delete)
 	group.GET("/sync", Sync)
 	group.GET("/list", List)
+	group.GET("/schedule", GetSchedule)
+	group.POST("/schedule", UpdateSchedule)
+	group.GET("/books", AvailableBooks)
+	group.POST("/books/download", DownloadBooks)
+	group.POST("/books/exclude", ExcludeBook)
+	group.POST("/books/retry/:bookId", RetryBook)
 
 }
@@ -0,0 +1,51 @@
+package account
+
+import (
+	"paperlink/db/repo"
+	"paperlink/server/routes"
+	"paperlink/service/d4s"
+	"paperlink/util"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ScheduleResponse struct {
+	// Cron is the schedule of the automatic sync. Empty if it is disabled.
+	Cron string `json:"cron"`
+	// Accounts is "all" or a comma separated list of account ids.
+	Accounts string `json:"accounts"`
+	// NextRunAt is 0 if no sync is scheduled.
+	NextRunAt int64           `json:"nextRunAt"`
+	Outcome   d4s.SyncOutcome `json:"outcome"`
+}
+
+// GetSchedule godoc
+// @Summary      Get Digi4School sync schedule
+// @Description  Returns the automatic sync schedule and the outcome of the last sync.
+// @Tags         digi4school
+// @Produce      json
+// @Success      200 {object} ScheduleResponse
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      403 {object} routes.ErrorResponse "Forbidden"
+// @Router       /api/v1/d4s/account/schedule [get]
+// @Security     BearerAuth
+func GetSchedule(c *gin.Context) {
+	routes.JSONSuccessOK(c, currentSchedule())
+}
+
+func currentSchedule() ScheduleResponse {
+	resp := ScheduleResponse{
+		Cron:     repo.Setting.GetString(d4s.SettingSyncCron, ""),
+		Accounts: repo.Setting.GetString(d4s.SettingSyncAccounts, "all"),
+		Outcome:  d4s.LastSyncOutcome(),
+	}
+	if resp.Cron != "" {
+		if schedule, err := util.ParseCron(resp.Cron); err == nil {
+			if next := schedule.Next(time.Now()); !next.IsZero() {
+				resp.NextRunAt = next.Unix()
+			}
+		}
+	}
+	return resp
+}
@@ -0,0 +1,71 @@
+package account
+
+import (
+	"net/http"
+	"paperlink/db/repo"
+	"paperlink/server/routes"
+	"paperlink/service/d4s"
+	"paperlink/util"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UpdateScheduleRequest struct {
+	// Cron is a 5 field cron expression like "0 3 * * *". An empty string disables the schedule.
+	Cron string `json:"cron"`
+	// Accounts is "all" or a comma separated list of account ids. Defaults to "all".
+	Accounts string `json:"accounts"`
+}
+
+// UpdateSchedule godoc
+// @Summary      Update Digi4School sync schedule
+// @Description  Sets the cron expression and accounts of the automatic sync.
+// @Tags         digi4school
+// @Accept       json
+// @Produce      json
+// @Param        request body UpdateScheduleRequest true "Schedule"
+// @Success      200 {object} ScheduleResponse
+// @Failure      400 {object} routes.ErrorResponse "Invalid cron expression or accounts"
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      403 {object} routes.ErrorResponse "Forbidden"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/d4s/account/schedule [post]
+// @Security     BearerAuth
+func UpdateSchedule(c *gin.Context) {
+	var req UpdateScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		routes.JSONError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	cron := strings.TrimSpace(req.Cron)
+	if cron != "" {
+		if _, err := util.ParseCron(cron); err != nil {
+			routes.JSONError(c, http.StatusBadRequest, "invalid cron expression: "+err.Error())
+			return
+		}
+	}
+
+	accounts := strings.TrimSpace(req.Accounts)
+	if accounts == "" {
+		accounts = "all"
+	}
+	if _, err := d4s.AccountsForSelection(accounts); err != nil {
+		routes.JSONError(c, http.StatusBadRequest, "invalid account IDs")
+		return
+	}
+
+	if err := repo.Setting.SetString(d4s.SettingSyncCron, cron); err != nil {
+		log.Errorf("failed to save sync schedule: %v", err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to save schedule")
+		return
+	}
+	if err := repo.Setting.SetString(d4s.SettingSyncAccounts, accounts); err != nil {
+		log.Errorf("failed to save sync accounts: %v", err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to save schedule")
+		return
+	}
+
+	routes.JSONSuccessOK(c, currentSchedule())
+}
@@ -1,13 +1,10 @@
 package account
 
 import (
+	"errors"
 	"net/http"
-	"paperlink/db/entity"
 	"paperlink/service/d4s"
-	"strconv"
-	"strings"
 
-	"paperlink/db/repo"
 	"paperlink/server/routes"
 
 	"github.com/gin-gonic/gin"
@@ -27,42 +24,27 @@ type SyncD4SResponse struct {
 // @Failure      400  {object}  routes.ErrorResponse "Invalid IDs"
 // @Failure      401 {object} routes.ErrorResponse "Unauthorized"
 // @Failure      403 {object} routes.ErrorResponse "Forbidden"
+// @Failure      409  {object}  routes.ErrorResponse "A sync is already queued or running"
 // @Failure      500  {object}  routes.ErrorResponse "Internal server error"
 // @Router       /api/v1/digi4school/accounts/sync/{ids} [get]
 // @Security     BearerAuth
 func Sync(c *gin.Context) {
-	idsParam := c.Query("ids")
-	var accounts []entity.Digi4SchoolAccount
-	var err error
-
-	if idsParam == "all" {
-		accounts, err = repo.Digi4SchoolAccount.GetList()
-		if err != nil {
-			log.Errorf("failed to fetch all digi4school accounts: %v", err)
-			routes.JSONError(c, http.StatusInternalServerError, "failed to fetch accounts")
-			return
-		}
-	} else {
-		idStrs := strings.Split(idsParam, ",")
-		ids := make([]any, 0, len(idStrs))
-		for _, s := range idStrs {
-			id, convErr := strconv.Atoi(strings.TrimSpace(s))
-			if convErr != nil {
-				routes.JSONError(c, http.StatusBadRequest, "invalid account IDs")
-				return
-			}
-			ids = append(ids, id)
-		}
-
-		accounts, err = repo.Digi4SchoolAccount.GetByIDs(ids)
-		if err != nil {
-			log.Errorf("failed to fetch digi4school accounts: %v", err)
-			routes.JSONError(c, http.StatusInternalServerError, "failed to fetch accounts")
-			return
-		}
+	accounts, err := d4s.AccountsForSelection(c.Query("ids"))
+	if errors.Is(err, d4s.ErrInvalidAccountSelection) {
+		routes.JSONError(c, http.StatusBadRequest, "invalid account IDs")
+		return
+	}
+	if err != nil {
+		log.Errorf("failed to fetch digi4school accounts: %v", err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to fetch accounts")
+		return
 	}
 
 	id, err := d4s.StartSyncTask(accounts)
+	if errors.Is(err, d4s.ErrSyncRunning) {
+		routes.JSONError(c, http.StatusConflict, "a sync is already queued or running")
+		return
+	}
 	if err != nil {
 		routes.JSONError(c, http.StatusInternalServerError, "failed to start sync task")
 		return
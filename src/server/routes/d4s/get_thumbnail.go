@@ -100,18 +100,18 @@ func GetThumbnail(c *gin.Context) {
 		c.String(http.StatusNotFound, "book not found")
 		return
 	}
-	if book.FileUUID == "" {
+	if book.FileUUID == nil {
 		c.String(http.StatusNotFound, "book has no file")
 		return
 	}
 
-	file := repo.FileDocument.GetByUUID(book.FileUUID)
+	file := repo.FileDocument.GetByUUID(*book.FileUUID)
 	if file == nil {
 		c.String(http.StatusNotFound, "file not found")
 		return
 	}
 
-	thumbPath, err := ensureD4SThumbnail(book.FileUUID, file.Path)
+	thumbPath, err := ensureD4SThumbnail(*book.FileUUID, file.Path)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "failed to create thumbnail")
 		return
@@ -24,7 +24,7 @@ type ListBooksResponse struct {
 // @Router       /api/v1/d4s/list [get]
 // @Security     BearerAuth
 func ListBooks(c *gin.Context) {
-	books, err := repo.Digi4SchoolBook.GetList()
+	books, err := repo.Digi4SchoolBook.ListDownloaded()
 	if err != nil {
 		routes.JSONError(c, http.StatusInternalServerError, "failed to list books")
 		return
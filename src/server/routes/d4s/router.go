@@ -2,6 +2,7 @@ package d4s
 
 import (
 	"github.com/gin-gonic/gin"
+	"paperlink/db/entity"
 	"paperlink/server/middleware"
 	"paperlink/server/routes/d4s/account"
 	"paperlink/util"
@@ -15,7 +16,7 @@ func InitDigi4SchoolRouter(r *gin.Engine) {
 
 	account.InitDigi4SchoolAccountRouter(group)
 
-	group.GET("/list", ListBooks)
-	group.GET("/thumbnail/:id", GetThumbnail)
-	group.POST("/takeBook/:id", TakeBook)
+	group.GET("/list", middleware.RequireScope(entity.ScopeRead), ListBooks)
+	group.GET("/thumbnail/:id", middleware.RequireScope(entity.ScopeRead), GetThumbnail)
+	group.POST("/takeBook/:id", middleware.RequireScope(entity.ScopeUpload), TakeBook)
 }
@@ -43,7 +43,7 @@ func TakeBook(c *gin.Context) {
 		return
 	}
 
-	if book.FileUUID == "" {
+	if book.FileUUID == nil {
 		routes.JSONError(c, http.StatusBadRequest, "book has no file")
 		return
 	}
@@ -53,7 +53,7 @@ func TakeBook(c *gin.Context) {
 		Name:        book.BookName,
 		Description: "Digi4School book",
 		UserID:      userID,
-		FileUUID:    book.FileUUID,
+		FileUUID:    *book.FileUUID,
 	}
 
 	if err := repo.Document.Save(&doc); err != nil {
@@ -2,6 +2,7 @@ package directory
 
 import (
 	"github.com/gin-gonic/gin"
+	"paperlink/db/entity"
 	"paperlink/server/middleware"
 	"paperlink/util"
 )
@@ -10,7 +11,7 @@ var log = util.GroupLog("DIRECTORY")
 
 func InitDirectoryRouter(r *gin.Engine) {
 	group := r.Group("/api/v1/directory")
-	group.Use(middleware.Auth)
+	group.Use(middleware.Auth, middleware.RequireScope(entity.ScopeUpload))
 	group.POST("/create", Create)
 	group.DELETE("/delete/:id", Delete)
 	group.PATCH("/update/:id", Update)
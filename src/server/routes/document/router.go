@@ -1,6 +1,7 @@
 package document
 
 import (
+	"paperlink/db/entity"
 	"paperlink/server/middleware"
 	"paperlink/util"
 
@@ -12,10 +13,10 @@ var log = util.GroupLog("DOCUMENT")
 func InitDocumentRouter(r *gin.Engine) {
 	group := r.Group("/api/v1/document")
 	group.Use(middleware.Auth)
-	group.GET("/filter", Filter)
-	group.POST("/update", Update)
-	group.POST("/create", Create)
-	group.POST("/upload", Upload)
-	group.GET("/get/:id", Get)
-	group.DELETE("/delete/:id", Delete)
+	group.GET("/filter", middleware.RequireScope(entity.ScopeRead), Filter)
+	group.POST("/update", middleware.RequireScope(entity.ScopeUpload), Update)
+	group.POST("/create", middleware.RequireScope(entity.ScopeUpload), Create)
+	group.POST("/upload", middleware.RequireScope(entity.ScopeUpload), Upload)
+	group.GET("/get/:id", middleware.RequireScope(entity.ScopeRead), Get)
+	group.DELETE("/delete/:id", middleware.RequireScope(entity.ScopeUpload), Delete)
 }
@@ -2,12 +2,13 @@ package pdf
 
 import (
 	"github.com/gin-gonic/gin"
+	"paperlink/db/entity"
 	"paperlink/server/middleware"
 )
 
 func InitPDFRouter(r *gin.Engine) {
 	group := r.Group("/api/v1/pdf")
-	group.Use(middleware.Auth)
+	group.Use(middleware.Auth, middleware.RequireScope(entity.ScopeRead))
 	group.GET("/thumbnails/:id/:range", GetThumbnailsRange)
 	group.GET("/:id/:page", GetPage)
 }
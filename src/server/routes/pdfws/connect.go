@@ -3,6 +3,7 @@ package pdfws
 import (
 	"errors"
 	"net/http"
+	"strconv"
 
 	"paperlink/server/routes"
 	"paperlink/service/collabedit"
@@ -32,8 +33,19 @@ func Connect(c *gin.Context) {
 		return
 	}
 
+	// A reconnecting client passes the epoch and seq of the last broadcast it received.
+	var resume *collabedit.ResumePoint
+	if seq := c.Query("seq"); seq != "" {
+		value, err := strconv.ParseUint(seq, 10, 64)
+		if err != nil {
+			routes.JSONError(c, http.StatusBadRequest, "invalid seq")
+			return
+		}
+		resume = &collabedit.ResumePoint{Epoch: c.Query("epoch"), Seq: value}
+	}
+
 	websocket.Handler(func(ws *websocket.Conn) {
-		if err := collabedit.PDFCollab.HandleConnection(documentID, token, ws); err != nil {
+		if err := collabedit.PDFCollab.HandleConnection(documentID, token, resume, ws); err != nil {
 			log.Warnf("websocket closed for document %s: %v", documentID, err)
 		}
 	}).ServeHTTP(c.Writer, c.Request)
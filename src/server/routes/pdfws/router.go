@@ -14,6 +14,7 @@ func InitPDFWSRouter(r *gin.Engine) {
 	group.GET("/connect/:id", Connect)
 
 	authGroup := group.Group("")
-	authGroup.Use(middleware.Auth)
+	authGroup.Use(middleware.Auth, middleware.SessionOnly)
 	authGroup.GET("/create/:id", Create)
+	authGroup.POST("/unlock/:id/:annotationId", Unlock)
 }
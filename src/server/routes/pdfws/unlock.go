@@ -0,0 +1,45 @@
+package pdfws
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"paperlink/server/routes"
+	"paperlink/service/collabedit"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Unlock(c *gin.Context) {
+	documentID := c.Param("id")
+	if documentID == "" {
+		routes.JSONError(c, http.StatusBadRequest, "document id required")
+		return
+	}
+	annotationID, err := strconv.Atoi(c.Param("annotationId"))
+	if err != nil {
+		routes.JSONError(c, http.StatusBadRequest, "invalid annotation id")
+		return
+	}
+
+	userID := c.GetInt("userId")
+	lock, err := collabedit.PDFCollab.ForceUnlock(documentID, annotationID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, collabedit.ErrUnlockForwarded):
+			// The node holding the document releases the lock and tells its clients.
+			routes.JSONSuccess(c, http.StatusAccepted, nil)
+		case errors.Is(err, collabedit.ErrDocumentNotFound), errors.Is(err, collabedit.ErrAnnotationNotLocked):
+			routes.JSONError(c, http.StatusNotFound, err.Error())
+		case errors.Is(err, collabedit.ErrForbidden), errors.Is(err, collabedit.ErrUserNotFound):
+			routes.JSONError(c, http.StatusForbidden, err.Error())
+		default:
+			log.Errorf("failed to unlock annotation %d of document %s: %v", annotationID, documentID, err)
+			routes.JSONError(c, http.StatusInternalServerError, "failed to unlock annotation")
+		}
+		return
+	}
+
+	routes.JSONSuccessOK(c, lock)
+}
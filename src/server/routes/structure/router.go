@@ -2,6 +2,7 @@ package structure
 
 import (
 	"github.com/gin-gonic/gin"
+	"paperlink/db/entity"
 	"paperlink/server/middleware"
 	"paperlink/util"
 )
@@ -10,6 +11,6 @@ var log = util.GroupLog("STRUCTURE")
 
 func InitStructureRoutes(r *gin.Engine) {
 	group := r.Group("/api/v1/structure")
-	group.Use(middleware.Auth)
+	group.Use(middleware.Auth, middleware.RequireScope(entity.ScopeRead))
 	group.GET("/tree", Tree)
 }
@@ -2,6 +2,8 @@ package task
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 
 	"paperlink/db/entity"
 	"paperlink/db/repo"
@@ -10,28 +12,68 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
 type ListTasksResponse struct {
 	Tasks []entity.Task `json:"tasks"`
+	// Total is the number of tasks matching the filter.
+	Total int64 `json:"total"`
 }
 
 // List godoc
 // @Summary      List tasks
-// @Description  Lists all stored tasks.
+// @Description  Lists the stored tasks page by page, queued tasks first and then the newest ones.
 // @Tags         tasks
 // @Produce      json
+// @Param        status  query  string  false  "Comma separated statuses, e.g. RUNNING,QUEUED"
+// @Param        name    query  string  false  "Part of the task name"
+// @Param        limit   query  int     false  "Page size, default 50, at most 200"
+// @Param        offset  query  int     false  "Number of tasks to skip"
 // @Success      200 {object} ListTasksResponse
+// @Failure      400 {object} routes.ErrorResponse "Invalid query"
 // @Failure      401 {object} routes.ErrorResponse "Unauthorized"
 // @Failure      403 {object} routes.ErrorResponse "Forbidden"
 // @Failure      500 {object} routes.ErrorResponse "Internal server error"
 // @Router       /api/v1/tasks/lists [get]
 // @Security     BearerAuth
 func List(c *gin.Context) {
-	tasks, err := repo.Task.GetList()
+	limit, err := queryInt(c, "limit", defaultListLimit)
+	if err != nil || limit <= 0 {
+		routes.JSONError(c, http.StatusBadRequest, "invalid limit")
+		return
+	}
+	limit = min(limit, maxListLimit)
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		routes.JSONError(c, http.StatusBadRequest, "invalid offset")
+		return
+	}
+
+	var statuses []entity.TaskStatus
+	for _, s := range strings.Split(c.Query("status"), ",") {
+		s = strings.ToUpper(strings.TrimSpace(s))
+		if s != "" {
+			statuses = append(statuses, entity.TaskStatus(s))
+		}
+	}
+
+	tasks, total, err := repo.Task.ListFiltered(statuses, strings.TrimSpace(c.Query("name")), limit, offset)
 	if err != nil {
 		log.Errorf("failed to fetch tasks: %v", err)
 		routes.JSONError(c, http.StatusInternalServerError, "failed to fetch tasks")
 		return
 	}
 
-	routes.JSONSuccessOK(c, ListTasksResponse{Tasks: tasks})
+	routes.JSONSuccessOK(c, ListTasksResponse{Tasks: tasks, Total: total})
+}
+
+func queryInt(c *gin.Context, key string, fallback int) (int, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(raw)
 }
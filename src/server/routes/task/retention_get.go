@@ -0,0 +1,22 @@
+package task
+
+import (
+	"paperlink/server/routes"
+	task_service "paperlink/service/task"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRetention godoc
+// @Summary      Get task retention
+// @Description  Returns how long finished tasks and their logs are kept. 0 disables a limit.
+// @Tags         tasks
+// @Produce      json
+// @Success      200 {object} task_service.Retention
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      403 {object} routes.ErrorResponse "Forbidden"
+// @Router       /api/v1/task/retention [get]
+// @Security     BearerAuth
+func GetRetention(c *gin.Context) {
+	routes.JSONSuccessOK(c, task_service.CurrentRetention())
+}
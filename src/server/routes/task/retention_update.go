@@ -0,0 +1,61 @@
+package task
+
+import (
+	"net/http"
+
+	"paperlink/db/repo"
+	"paperlink/server/routes"
+	task_service "paperlink/service/task"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UpdateRetentionRequest struct {
+	// MaxAgeDays removes finished tasks older than the number of days. 0 keeps them.
+	MaxAgeDays int64 `json:"maxAgeDays"`
+	// MaxCount keeps only the newest finished tasks. 0 keeps all of them.
+	MaxCount int64 `json:"maxCount"`
+}
+
+// UpdateRetention godoc
+// @Summary      Update task retention
+// @Description  Sets how long finished tasks and their logs are kept and prunes the tasks that exceed it.
+// @Tags         tasks
+// @Accept       json
+// @Produce      json
+// @Param        request body UpdateRetentionRequest true "Retention"
+// @Success      200 {object} task_service.Retention
+// @Failure      400 {object} routes.ErrorResponse "Invalid retention"
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      403 {object} routes.ErrorResponse "Forbidden"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/task/retention [post]
+// @Security     BearerAuth
+func UpdateRetention(c *gin.Context) {
+	var req UpdateRetentionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		routes.JSONError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.MaxAgeDays < 0 || req.MaxCount < 0 {
+		routes.JSONError(c, http.StatusBadRequest, "retention must not be negative")
+		return
+	}
+
+	if err := repo.Setting.SetInt64(task_service.SettingRetentionMaxAgeDays, req.MaxAgeDays); err != nil {
+		log.Errorf("failed to save task retention: %v", err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to save retention")
+		return
+	}
+	if err := repo.Setting.SetInt64(task_service.SettingRetentionMaxCount, req.MaxCount); err != nil {
+		log.Errorf("failed to save task retention: %v", err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to save retention")
+		return
+	}
+
+	retention := task_service.CurrentRetention()
+	if _, err := task_service.Prune(retention); err != nil {
+		log.Errorf("failed to prune tasks: %v", err)
+	}
+	routes.JSONSuccessOK(c, retention)
+}
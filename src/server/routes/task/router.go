@@ -14,5 +14,8 @@ func InitTasksTasks(r *gin.Engine) {
 	group.Use(middleware.Auth, middleware.Admin)
 	group.GET("/list", List)
 	group.GET("/view/:id", View)
+	group.GET("/stream/:id", Stream)
 	group.POST("/stop/:id", Stop)
+	group.GET("/retention", GetRetention)
+	group.POST("/retention", UpdateRetention)
 }
@@ -12,7 +12,7 @@ import (
 
 // Stop godoc
 // @Summary      Stop running task
-// @Description  Stops a running task by ID.
+// @Description  Stops a running task or cancels a queued one by ID.
 // @Tags         tasks
 // @Produce      json
 // @Param        id   path      string  true  "Task ID"
@@ -0,0 +1,94 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"paperlink/server/routes"
+	task_service "paperlink/service/task"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stream godoc
+// @Summary      Stream task log
+// @Description  Streams the log, status and details of a task as Server-Sent Events. Every "update" event carries the lines from its cursor on, its id is the cursor to resume from. The cursor is taken from the Last-Event-ID header or the cursor query parameter. Finished tasks are sent as a single update from their stored log.
+// @Tags         tasks
+// @Produce      text/event-stream
+// @Param        id      path   string  true   "Task ID"
+// @Param        cursor  query  int     false  "Index of the first log line to send"
+// @Success      200  {object}  task_service.TaskUpdate
+// @Failure      400  {object}  routes.ErrorResponse "Invalid cursor"
+// @Failure      401  {object}  routes.ErrorResponse "Unauthorized"
+// @Failure      403  {object}  routes.ErrorResponse "Forbidden"
+// @Failure      404  {object}  routes.ErrorResponse "Not found"
+// @Router       /api/v1/task/stream/{id} [get]
+// @Security     BearerAuth
+func Stream(c *gin.Context) {
+	id := c.Param("id")
+	cursor, err := streamCursor(c)
+	if err != nil {
+		routes.JSONError(c, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+
+	started := false
+	err = task_service.StreamTask(c.Request.Context(), id, cursor, func(update task_service.TaskUpdate) error {
+		if !started {
+			started = true
+			c.Header("Content-Type", "text/event-stream")
+			c.Header("Cache-Control", "no-cache")
+			c.Header("Connection", "keep-alive")
+			// Keeps nginx from buffering the stream.
+			c.Header("X-Accel-Buffering", "no")
+			c.Status(http.StatusOK)
+		}
+		return writeUpdate(c, update)
+	})
+	if err == nil || started {
+		return
+	}
+	if errors.Is(err, task_service.ErrTaskNotFound) {
+		routes.JSONError(c, http.StatusNotFound, "task not found")
+		return
+	}
+	log.Errorf("failed to stream task %s: %v", id, err)
+	routes.JSONError(c, http.StatusInternalServerError, "failed to stream task")
+}
+
+func streamCursor(c *gin.Context) (int, error) {
+	raw := c.GetHeader("Last-Event-ID")
+	if raw == "" {
+		raw = c.Query("cursor")
+	}
+	if raw == "" {
+		return 0, nil
+	}
+	cursor, err := strconv.Atoi(raw)
+	if err != nil || cursor < 0 {
+		return 0, fmt.Errorf("invalid cursor %q", raw)
+	}
+	return cursor, nil
+}
+
+func writeUpdate(c *gin.Context, update task_service.TaskUpdate) error {
+	var err error
+	if update.Heartbeat {
+		_, err = fmt.Fprint(c.Writer, ": heartbeat\n\n")
+	} else {
+		var data []byte
+		data, err = json.Marshal(update)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(c.Writer, "id: %d\nevent: update\ndata: %s\n\n", update.Cursor+len(update.Lines), data)
+	}
+	if err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
@@ -17,6 +17,9 @@ type GetTaskResponse struct {
 	StartTime int64             `json:"startTime"`
 	EndTime   int64             `json:"endTime"`
 	Content   []string          `json:"content"`
+	Details   any               `json:"details,omitempty"`
+	// Progress is the live progress while the task is running.
+	Progress entity.TaskProgress `json:"progress"`
 }
 
 // View godoc
@@ -54,5 +57,7 @@ func View(c *gin.Context) {
 		StartTime: task.StartTime,
 		EndTime:   task.EndTime,
 		Content:   t.Lines,
+		Details:   t.Details,
+		Progress:  t.Progress,
 	})
 }
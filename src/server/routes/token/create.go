@@ -0,0 +1,99 @@
+package token
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+	"paperlink/server/routes"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateTokenRequest struct {
+	Name string `json:"name" binding:"required"`
+	// Scopes is a list of "read", "upload" and "admin".
+	Scopes []string `json:"scopes" binding:"required"`
+	// ExpiresInDays is how long the token stays valid. 0 creates a token that never expires.
+	ExpiresInDays int `json:"expiresInDays"`
+}
+
+type CreateTokenResponse struct {
+	Token  string          `json:"token"`
+	Detail entity.APIToken `json:"detail"`
+}
+
+// Create godoc
+// @Summary      Create personal API token
+// @Description  Creates a long-lived API token for scripts. The token is only returned once.
+// @Tags         token
+// @Accept       json
+// @Produce      json
+// @Param        request body CreateTokenRequest true "Token options"
+// @Success      201 {object} CreateTokenResponse
+// @Failure      400 {object} routes.ErrorResponse "Invalid request body or scope"
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      403 {object} routes.ErrorResponse "Admin scope requires an admin"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/token/create [post]
+// @Security     BearerAuth
+func Create(c *gin.Context) {
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		routes.JSONError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || req.ExpiresInDays < 0 {
+		routes.JSONError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, err := repo.User.Get(c.GetInt("userId"))
+	if err != nil || user == nil {
+		routes.JSONError(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	scopes := make([]entity.APITokenScope, 0, len(req.Scopes))
+	for _, s := range req.Scopes {
+		scope := entity.APITokenScope(strings.ToLower(strings.TrimSpace(s)))
+		switch scope {
+		case entity.ScopeRead, entity.ScopeUpload:
+		case entity.ScopeAdmin:
+			if !user.IsAdmin {
+				routes.JSONError(c, http.StatusForbidden, "admin scope requires admin permission")
+				return
+			}
+		default:
+			routes.JSONError(c, http.StatusBadRequest, "unknown scope "+s)
+			return
+		}
+		scopes = append(scopes, scope)
+	}
+	if len(scopes) == 0 {
+		routes.JSONError(c, http.StatusBadRequest, "at least one scope is required")
+		return
+	}
+
+	var expiresAt int64
+	if req.ExpiresInDays > 0 {
+		expiresAt = time.Now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour).Unix()
+	}
+
+	token, plain, err := repo.APIToken.Create(user.ID, name, scopes, expiresAt)
+	if err != nil {
+		log.Errorf("failed to create api token: %v", err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to create token")
+		return
+	}
+
+	log.Infof("user %s created api token %q with scopes %s", user.Username, name, token.Scopes)
+	routes.JSONSuccess(c, http.StatusCreated, CreateTokenResponse{
+		Token:  plain,
+		Detail: *token,
+	})
+}
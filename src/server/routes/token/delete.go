@@ -0,0 +1,45 @@
+package token
+
+import (
+	"net/http"
+	"strconv"
+
+	"paperlink/db/repo"
+	"paperlink/server/routes"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Delete godoc
+// @Summary      Revoke personal API token
+// @Description  Revokes one of the current user's API tokens.
+// @Tags         token
+// @Produce      json
+// @Param        id   path      int  true  "Token ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  routes.ErrorResponse "Invalid token ID"
+// @Failure      401  {object}  routes.ErrorResponse "Unauthorized"
+// @Failure      404  {object}  routes.ErrorResponse "Token not found"
+// @Failure      500  {object}  routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/token/delete/{id} [delete]
+// @Security     BearerAuth
+func Delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		routes.JSONError(c, http.StatusBadRequest, "invalid token id")
+		return
+	}
+
+	deleted, err := repo.APIToken.DeleteForUser(id, c.GetInt("userId"))
+	if err != nil {
+		log.Errorf("failed to delete api token %d: %v", id, err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to delete token")
+		return
+	}
+	if !deleted {
+		routes.JSONError(c, http.StatusNotFound, "token not found")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
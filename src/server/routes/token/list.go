@@ -0,0 +1,36 @@
+package token
+
+import (
+	"net/http"
+
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+	"paperlink/server/routes"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ListTokensResponse struct {
+	Tokens []entity.APIToken `json:"tokens"`
+}
+
+// List godoc
+// @Summary      List personal API tokens
+// @Description  Lists the API tokens of the current user. The token values are never returned.
+// @Tags         token
+// @Produce      json
+// @Success      200 {object} ListTokensResponse
+// @Failure      401 {object} routes.ErrorResponse "Unauthorized"
+// @Failure      500 {object} routes.ErrorResponse "Internal server error"
+// @Router       /api/v1/token/list [get]
+// @Security     BearerAuth
+func List(c *gin.Context) {
+	tokens, err := repo.APIToken.ListForUser(c.GetInt("userId"))
+	if err != nil {
+		log.Errorf("failed to fetch api tokens: %v", err)
+		routes.JSONError(c, http.StatusInternalServerError, "failed to fetch tokens")
+		return
+	}
+
+	routes.JSONSuccessOK(c, ListTokensResponse{Tokens: tokens})
+}
@@ -0,0 +1,18 @@
+package token
+
+import (
+	"paperlink/server/middleware"
+	"paperlink/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+var log = util.GroupLog("TOKEN")
+
+func InitTokenRouter(r *gin.Engine) {
+	group := r.Group("/api/v1/token")
+	group.Use(middleware.Auth, middleware.SessionOnly)
+	group.GET("/list", List)
+	group.POST("/create", Create)
+	group.DELETE("/delete/:id", Delete)
+}
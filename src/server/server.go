@@ -5,6 +5,7 @@ import (
 	"os"
 	"paperlink/server/routes/admin"
 	"paperlink/server/routes/auth"
+	"paperlink/server/routes/comment"
 	"paperlink/server/routes/d4s"
 	"paperlink/server/routes/directory"
 	"paperlink/server/routes/document"
@@ -13,6 +14,7 @@ import (
 	"paperlink/server/routes/pdfws"
 	"paperlink/server/routes/structure"
 	"paperlink/server/routes/task"
+	"paperlink/server/routes/token"
 	"paperlink/util"
 	"path/filepath"
 	"strings"
@@ -62,6 +64,11 @@ func serveFile(c *gin.Context, path string, allowBrotli bool) {
 
 func Start() {
 	r := gin.New()
+	// ClientIP only honors X-Forwarded-For from these proxies. Trusting every peer would let
+	// anybody pick the address the rate limits are keyed on.
+	if err := r.SetTrustedProxies(util.EnvList("PAPERLINK_TRUSTED_PROXIES", nil)); err != nil {
+		log.Fatalf("invalid PAPERLINK_TRUSTED_PROXIES: %v", err)
+	}
 
 	r.GET("/assets/*filepath", func(c *gin.Context) {
 		path := "./dist/assets" + c.Param("filepath")
@@ -94,11 +101,13 @@ func Start() {
 	pdf.InitPDFRouter(r)
 	pdfws.InitPDFWSRouter(r)
 	document.InitDocumentRouter(r)
+	comment.InitCommentRouter(r)
 	invite.InitInviteRouter(r)
 	directory.InitDirectoryRouter(r)
 	structure.InitStructureRoutes(r)
 	d4s.InitDigi4SchoolRouter(r)
 	task.InitTasksTasks(r)
+	token.InitTokenRouter(r)
 	log.Info("starting server at port 8080")
 	err := r.Run(":8080")
 	if err != nil {
@@ -21,6 +21,7 @@ var (
 	ErrAnnotationLocked       = errors.New("annotation locked by another user")
 	ErrAnnotationLockRequired = errors.New("annotation lock required")
 	ErrAnnotationLockOwned    = errors.New("annotation lock owned by another client")
+	ErrAnnotationNotLocked    = errors.New("annotation is not locked")
 )
 
 type annotationMessage struct {
@@ -44,6 +45,15 @@ type annotationLockState struct {
 	User          User
 	OwnerClientID string
 	LockedAt      time.Time
+	// ExpiresAt is pushed back by every heartbeat of the owner. A lock whose owner
+	// stopped sending heartbeats, e.g. a frozen tab, is released once it passed.
+	ExpiresAt time.Time
+}
+
+// expired reports whether the lease of the lock passed. Expired locks are not held by
+// anyone, even before expireLocks released them.
+func (l *annotationLockState) expired(now time.Time) bool {
+	return !l.ExpiresAt.IsZero() && !now.Before(l.ExpiresAt)
 }
 
 type documentAnnotationState struct {
@@ -57,22 +67,49 @@ type documentAnnotationState struct {
 	RoomActive      bool
 	LastTouchedAt   time.Time
 	LastRoomLeftAt  time.Time
+	// LeaseValidUntil is when the lease of the document may expire, counted from the
+	// last successful claim. Past it the document is neither changed nor flushed.
+	LeaseValidUntil time.Time
+}
+
+// leaseHeld reports whether the node still holds the lease of the document.
+func (d *documentAnnotationState) leaseHeld(now time.Time) bool {
+	return now.Before(d.LeaseValidUntil)
+}
+
+// leaseValidUntil returns until when a lease claimed at claimedAt is held for sure.
+func leaseValidUntil(claimedAt time.Time) time.Time {
+	return claimedAt.Add(documentLeaseTTL - documentLeaseMargin)
 }
 
 type AnnotationStore struct {
 	mu            sync.Mutex
 	flushInterval time.Duration
 	idleTTL       time.Duration
+	lockTTL       time.Duration
 	documents     map[string]*documentAnnotationState
-	nextID        int
-	nextIDLoaded  bool
+	// broker hands out the annotation ids and the leases of the cached documents, held
+	// as nodeID.
+	broker Broker
+	nodeID string
+	// idFloor is the highest annotation id in the database when the store started.
+	idFloor       int
+	idFloorLoaded bool
+	// onLocksExpired is called with the locks of a document that expired, outside of mu.
+	onLocksExpired func(documentUUID string, locks []annotationLockMessage)
+	// onDocumentLost is called outside of mu for a document evicted because another node
+	// took its lease or it could not be renewed.
+	onDocumentLost func(documentUUID string)
 }
 
-func NewAnnotationStore() *AnnotationStore {
+func NewAnnotationStore(broker Broker, nodeID string) *AnnotationStore {
 	store := &AnnotationStore{
 		flushInterval: 15 * time.Second,
 		idleTTL:       2 * time.Minute,
+		lockTTL:       30 * time.Second,
 		documents:     make(map[string]*documentAnnotationState),
+		broker:        broker,
+		nodeID:        nodeID,
 	}
 
 	go store.flushLoop()
@@ -88,13 +125,24 @@ func (s *AnnotationStore) EnsureDocumentLoaded(documentUUID string) error {
 	}
 	s.mu.Unlock()
 
+	claimedAt := time.Now()
+	claimed, err := s.broker.ClaimLease(documentLeaseKey(documentUUID), s.nodeID, documentLeaseTTL)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return ErrDocumentBusy
+	}
+
 	doc := repo.Document.GetByUUIDWithFile(documentUUID)
 	if doc == nil {
+		s.releaseDocumentLease(documentUUID)
 		return ErrDocumentNotFound
 	}
 
 	annotations, err := repo.Document.GetAnnotationsById(doc.ID)
 	if err != nil {
+		s.releaseDocumentLease(documentUUID)
 		return err
 	}
 
@@ -107,6 +155,7 @@ func (s *AnnotationStore) EnsureDocumentLoaded(documentUUID string) error {
 		PendingActions:  make([]entity.AnnotationAction, 0),
 		Dirty:           false,
 		LastTouchedAt:   time.Now(),
+		LeaseValidUntil: leaseValidUntil(claimedAt),
 	}
 
 	for _, annotation := range annotations {
@@ -126,6 +175,32 @@ func (s *AnnotationStore) EnsureDocumentLoaded(documentUUID string) error {
 	return nil
 }
 
+// IsDocumentCached reports whether the annotations of the document are cached, they may
+// not be flushed to the database yet.
+func (s *AnnotationStore) IsDocumentCached(documentUUID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.documents[documentUUID]
+	return ok
+}
+
+// GetCachedAnnotation returns a copy of the annotation of a cached document, nil if the
+// document has no such annotation. cached is false if the document is not cached, its
+// annotations are all in the database then.
+func (s *AnnotationStore) GetCachedAnnotation(documentUUID string, annotationID int) (annotation *entity.Annotation, cached bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.documents[documentUUID]
+	if state == nil {
+		return nil, false
+	}
+	if current := state.Annotations[annotationID]; current != nil {
+		return cloneAnnotation(current), true
+	}
+	return nil, true
+}
+
 func (s *AnnotationStore) MarkRoomActive(documentUUID string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -203,20 +278,34 @@ func (s *AnnotationStore) CreateAnnotation(documentUUID string, input annotation
 	}
 
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	if err := s.ensureIDFloorLocked(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	floor := s.idFloor
+	_, cached := s.documents[documentUUID]
+	s.mu.Unlock()
+	if !cached {
+		return nil, ErrDocumentNotFound
+	}
 
-	if err := s.ensureNextIDLocked(); err != nil {
+	// The broker is asked without mu, it may be a network round trip.
+	id, err := s.broker.NextID(annotationIDKey, floor)
+	if err != nil {
 		return nil, err
 	}
 
-	state := s.documents[documentUUID]
-	if state == nil {
-		return nil, ErrDocumentNotFound
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, err := s.writableDocumentLocked(documentUUID)
+	if err != nil {
+		return nil, err
 	}
 
 	now := time.Now().Unix()
 	annotation := &entity.Annotation{
-		ID:         s.nextID,
+		ID:         id,
 		Type:       input.Type,
 		Data:       input.Data,
 		Page:       input.Page,
@@ -226,7 +315,6 @@ func (s *AnnotationStore) CreateAnnotation(documentUUID string, input annotation
 		PositionY:  input.PositionY,
 		DocumentID: state.DocumentID,
 	}
-	s.nextID++
 
 	state.Annotations[annotation.ID] = annotation
 	delete(state.DeletedIDs, annotation.ID)
@@ -249,9 +337,9 @@ func (s *AnnotationStore) UpdateAnnotation(documentUUID, ownerClientID string, i
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	state := s.documents[documentUUID]
-	if state == nil {
-		return nil, ErrDocumentNotFound
+	state, err := s.writableDocumentLocked(documentUUID)
+	if err != nil {
+		return nil, err
 	}
 
 	annotation := state.Annotations[input.ID]
@@ -286,9 +374,9 @@ func (s *AnnotationStore) MoveAnnotation(documentUUID, ownerClientID string, inp
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	state := s.documents[documentUUID]
-	if state == nil {
-		return nil, ErrDocumentNotFound
+	state, err := s.writableDocumentLocked(documentUUID)
+	if err != nil {
+		return nil, err
 	}
 
 	annotation := state.Annotations[input.ID]
@@ -321,9 +409,9 @@ func (s *AnnotationStore) DeleteAnnotation(documentUUID, ownerClientID string, a
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	state := s.documents[documentUUID]
-	if state == nil {
-		return ErrDocumentNotFound
+	state, err := s.writableDocumentLocked(documentUUID)
+	if err != nil {
+		return err
 	}
 
 	annotation := state.Annotations[annotationID]
@@ -345,6 +433,18 @@ func (s *AnnotationStore) DeleteAnnotation(documentUUID, ownerClientID string, a
 	return nil
 }
 
+// writableDocumentLocked returns the cached document if its annotations may be changed.
+func (s *AnnotationStore) writableDocumentLocked(documentUUID string) (*documentAnnotationState, error) {
+	state := s.documents[documentUUID]
+	if state == nil {
+		return nil, ErrDocumentNotFound
+	}
+	if !state.leaseHeld(time.Now()) {
+		return nil, ErrLeaseExpired
+	}
+	return state, nil
+}
+
 func (s *AnnotationStore) AcquireAnnotationLock(documentUUID string, annotationID int, ownerClientID string, user User) (*annotationLockMessage, error) {
 	if annotationID == 0 {
 		return nil, ErrInvalidAnnotation
@@ -362,13 +462,14 @@ func (s *AnnotationStore) AcquireAnnotationLock(documentUUID string, annotationI
 		return nil, ErrAnnotationNotFound
 	}
 
-	if existing := state.AnnotationLocks[annotationID]; existing != nil {
+	if existing := state.AnnotationLocks[annotationID]; existing != nil && !existing.expired(time.Now()) {
 		state.LastTouchedAt = time.Now()
 		if existing.OwnerClientID != ownerClientID {
 			return nil, ErrAnnotationLocked
 		}
 
 		existing.LockedAt = time.Now()
+		existing.ExpiresAt = time.Now().Add(s.lockTTL)
 		lock := toAnnotationLockMessage(existing)
 		return &lock, nil
 	}
@@ -378,6 +479,7 @@ func (s *AnnotationStore) AcquireAnnotationLock(documentUUID string, annotationI
 		User:          user,
 		OwnerClientID: ownerClientID,
 		LockedAt:      time.Now(),
+		ExpiresAt:     time.Now().Add(s.lockTTL),
 	}
 	state.AnnotationLocks[annotationID] = lock
 	state.LastTouchedAt = time.Now()
@@ -415,6 +517,76 @@ func (s *AnnotationStore) ReleaseAnnotationLock(documentUUID string, annotationI
 	return &result, nil
 }
 
+// RefreshAnnotationLocks extends the leases of the locks the client holds. If
+// annotationID is set only that lock is refreshed and it has to be held by the client.
+func (s *AnnotationStore) RefreshAnnotationLocks(documentUUID, ownerClientID string, annotationID *int) ([]annotationLockMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.documents[documentUUID]
+	if state == nil {
+		return nil, ErrDocumentNotFound
+	}
+	if annotationID != nil {
+		if err := ensureAnnotationLockHeldLocked(state, *annotationID, ownerClientID); err != nil {
+			return nil, err
+		}
+	}
+
+	expiresAt := time.Now().Add(s.lockTTL)
+	refreshed := make([]annotationLockMessage, 0)
+	for id, lock := range state.AnnotationLocks {
+		if lock.OwnerClientID != ownerClientID || (annotationID != nil && id != *annotationID) || lock.expired(time.Now()) {
+			continue
+		}
+		lock.ExpiresAt = expiresAt
+		refreshed = append(refreshed, toAnnotationLockMessage(lock))
+	}
+	state.LastTouchedAt = time.Now()
+
+	slices.SortFunc(refreshed, func(a, b annotationLockMessage) int {
+		return a.AnnotationID - b.AnnotationID
+	})
+	return refreshed, nil
+}
+
+// ForceReleaseAnnotationLock releases a lock regardless of the client holding it.
+func (s *AnnotationStore) ForceReleaseAnnotationLock(documentUUID string, annotationID int) (*annotationLockMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.documents[documentUUID]
+	if state == nil {
+		return nil, ErrAnnotationNotLocked
+	}
+	lock := state.AnnotationLocks[annotationID]
+	if lock == nil {
+		return nil, ErrAnnotationNotLocked
+	}
+
+	delete(state.AnnotationLocks, annotationID)
+	state.LastTouchedAt = time.Now()
+
+	result := toAnnotationLockMessage(lock)
+	return &result, nil
+}
+
+// OnDocumentLost sets the callback that is told about documents evicted because another
+// node took their lease or it could not be renewed, so their rooms can be closed.
+func (s *AnnotationStore) OnDocumentLost(callback func(documentUUID string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onDocumentLost = callback
+}
+
+// OnLocksExpired sets the callback that is told about expired locks, so the rooms can
+// broadcast them.
+func (s *AnnotationStore) OnLocksExpired(callback func(documentUUID string, locks []annotationLockMessage)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onLocksExpired = callback
+}
+
 func (s *AnnotationStore) ReleaseLocksByOwner(documentUUID, ownerClientID string) []annotationLockMessage {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -459,8 +631,21 @@ func (s *AnnotationStore) FlushDocument(documentUUID string) error {
 func (s *AnnotationStore) flushLoop() {
 	ticker := time.NewTicker(s.flushInterval)
 	defer ticker.Stop()
+	// Locks are checked more often than the annotations are flushed, so an expired
+	// lock does not block the others for much longer than its TTL.
+	lockTicker := time.NewTicker(s.lockTTL / 3)
+	defer lockTicker.Stop()
+
+	for {
+		select {
+		case <-lockTicker.C:
+			s.expireLocks(time.Now())
+			s.renewDocumentLeases()
+			continue
+		case <-ticker.C:
+		}
 
-	for range ticker.C {
+		s.expireLocks(time.Now())
 		s.mu.Lock()
 		for _, state := range s.documents {
 			if state.Dirty {
@@ -471,6 +656,7 @@ func (s *AnnotationStore) flushLoop() {
 		}
 
 		now := time.Now()
+		var evicted []string
 		for documentUUID, state := range s.documents {
 			if state.RoomActive {
 				continue
@@ -485,8 +671,114 @@ func (s *AnnotationStore) flushLoop() {
 				continue
 			}
 			delete(s.documents, documentUUID)
+			evicted = append(evicted, documentUUID)
 		}
 		s.mu.Unlock()
+
+		for _, documentUUID := range evicted {
+			s.releaseDocumentLease(documentUUID)
+		}
+	}
+}
+
+// renewDocumentLeases keeps the leases of the cached documents, they are released once
+// a document is evicted from the cache. A document whose lease went to another node is
+// evicted without flushing, that node serves it now and a flush would overwrite it. So
+// is a document whose lease could not be renewed before it may have expired, e.g. while
+// the broker is unreachable.
+func (s *AnnotationStore) renewDocumentLeases() {
+	s.mu.Lock()
+	documentUUIDs := make([]string, 0, len(s.documents))
+	for documentUUID := range s.documents {
+		documentUUIDs = append(documentUUIDs, documentUUID)
+	}
+	s.mu.Unlock()
+
+	type renewal struct {
+		claimed   bool
+		claimedAt time.Time
+	}
+	renewals := make(map[string]renewal, len(documentUUIDs))
+	for _, documentUUID := range documentUUIDs {
+		claimedAt := time.Now()
+		ok, err := s.broker.ClaimLease(documentLeaseKey(documentUUID), s.nodeID, documentLeaseTTL)
+		if err != nil {
+			log.Warnf("failed to renew lease of %s: %v", documentUUID, err)
+			continue
+		}
+		renewals[documentUUID] = renewal{claimed: ok, claimedAt: claimedAt}
+	}
+
+	var lost, stale []string
+	now := time.Now()
+	s.mu.Lock()
+	for documentUUID, renewal := range renewals {
+		state := s.documents[documentUUID]
+		switch {
+		case state == nil && renewal.claimed:
+			// Evicted while the lease was renewed.
+			stale = append(stale, documentUUID)
+		case state != nil && renewal.claimed:
+			state.LeaseValidUntil = leaseValidUntil(renewal.claimedAt)
+		case state != nil:
+			log.Errorf("lost lease of %s to another node, dropping %d unflushed changes", documentUUID, len(state.PendingActions))
+			delete(s.documents, documentUUID)
+			lost = append(lost, documentUUID)
+		}
+	}
+	for documentUUID, state := range s.documents {
+		if state.leaseHeld(now) {
+			continue
+		}
+		log.Errorf("lease of %s could not be renewed in time, dropping %d unflushed changes", documentUUID, len(state.PendingActions))
+		delete(s.documents, documentUUID)
+		lost = append(lost, documentUUID)
+	}
+	callback := s.onDocumentLost
+	s.mu.Unlock()
+
+	for _, documentUUID := range stale {
+		s.releaseDocumentLease(documentUUID)
+	}
+	if callback == nil {
+		return
+	}
+	for _, documentUUID := range lost {
+		callback(documentUUID)
+	}
+}
+
+func (s *AnnotationStore) releaseDocumentLease(documentUUID string) {
+	if err := s.broker.ReleaseLease(documentLeaseKey(documentUUID), s.nodeID); err != nil {
+		log.Warnf("failed to release lease of %s: %v", documentUUID, err)
+	}
+}
+
+// expireLocks releases the locks whose lease passed and reports them per document.
+func (s *AnnotationStore) expireLocks(now time.Time) {
+	s.mu.Lock()
+	expired := make(map[string][]annotationLockMessage)
+	for documentUUID, state := range s.documents {
+		for annotationID, lock := range state.AnnotationLocks {
+			if !lock.expired(now) {
+				continue
+			}
+			expired[documentUUID] = append(expired[documentUUID], toAnnotationLockMessage(lock))
+			delete(state.AnnotationLocks, annotationID)
+		}
+	}
+	callback := s.onLocksExpired
+	s.mu.Unlock()
+
+	if callback == nil {
+		return
+	}
+	for documentUUID, locks := range expired {
+		slices.SortFunc(locks, func(a, b annotationLockMessage) int {
+			return a.AnnotationID - b.AnnotationID
+		})
+		log.Infof("released %d expired annotation locks of %s", len(locks), documentUUID)
+		callback(documentUUID, locks)
 	}
 }
 
@@ -494,6 +786,9 @@ func (s *AnnotationStore) flushDocumentLocked(state *documentAnnotationState) er
 	if !state.Dirty {
 		return nil
 	}
+	if !state.leaseHeld(time.Now()) {
+		return ErrLeaseExpired
+	}
 
 	return db.DB().Transaction(func(tx *gorm.DB) error {
 		for annotationID := range state.DeletedIDs {
@@ -574,7 +869,7 @@ func validateAnnotationInput(input annotationMessage, isCreate bool) error {
 
 func ensureAnnotationLockHeldLocked(state *documentAnnotationState, annotationID int, ownerClientID string) error {
 	lock := state.AnnotationLocks[annotationID]
-	if lock == nil {
+	if lock == nil || lock.expired(time.Now()) {
 		return ErrAnnotationLockRequired
 	}
 	if lock.OwnerClientID != ownerClientID {
@@ -618,12 +913,17 @@ func toAnnotationLockMessage(lock *annotationLockState) annotationLockMessage {
 		User:          lock.User,
 		OwnerClientID: lock.OwnerClientID,
 		LockedAt:      lock.LockedAt.Unix(),
+		ExpiresAt:     lock.ExpiresAt.Unix(),
 	}
 }
 
 func listAnnotationLocks(state *documentAnnotationState) []annotationLockMessage {
 	locks := make([]annotationLockMessage, 0, len(state.AnnotationLocks))
+	now := time.Now()
 	for _, lock := range state.AnnotationLocks {
+		if lock.expired(now) {
+			continue
+		}
 		locks = append(locks, toAnnotationLockMessage(lock))
 	}
 
@@ -634,8 +934,8 @@ func listAnnotationLocks(state *documentAnnotationState) []annotationLockMessage
 	return locks
 }
 
-func (s *AnnotationStore) ensureNextIDLocked() error {
-	if s.nextIDLoaded {
+func (s *AnnotationStore) ensureIDFloorLocked() error {
+	if s.idFloorLoaded {
 		return nil
 	}
 
@@ -644,7 +944,7 @@ func (s *AnnotationStore) ensureNextIDLocked() error {
 		return err
 	}
 
-	s.nextID = maxID + 1
-	s.nextIDLoaded = true
+	s.idFloor = maxID
+	s.idFloorLoaded = true
 	return nil
 }
@@ -0,0 +1,136 @@
+package collabedit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"paperlink/db/entity"
+)
+
+// newTestStore returns a store with one cached document holding annotation 1. It runs
+// no flush loop, so locks only expire by their ExpiresAt.
+func newTestStore() *AnnotationStore {
+	store := &AnnotationStore{
+		lockTTL:   30 * time.Second,
+		documents: make(map[string]*documentAnnotationState),
+		broker:    NewMemoryBroker(),
+		nodeID:    "test",
+	}
+	store.documents["doc"] = &documentAnnotationState{
+		DocumentUUID:    "doc",
+		Annotations:     map[int]*entity.Annotation{1: {ID: 1, Type: entity.Note, Page: 1}},
+		AnnotationLocks: make(map[int]*annotationLockState),
+		DeletedIDs:      make(map[int]struct{}),
+		LeaseValidUntil: time.Now().Add(time.Hour),
+	}
+	return store
+}
+
+func expireLock(store *AnnotationStore, annotationID int) {
+	store.documents["doc"].AnnotationLocks[annotationID].ExpiresAt = time.Now().Add(-time.Second)
+}
+
+func TestExpiredLockIsNotHeld(t *testing.T) {
+	store := newTestStore()
+	alice := User{UserID: 1, Username: "alice"}
+	bob := User{UserID: 2, Username: "bob"}
+
+	if _, err := store.AcquireAnnotationLock("doc", 1, "node-1", alice); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.AcquireAnnotationLock("doc", 1, "node-2", bob); !errors.Is(err, ErrAnnotationLocked) {
+		t.Fatalf("live lock: got %v, want ErrAnnotationLocked", err)
+	}
+
+	expireLock(store, 1)
+	update := annotationMessage{ID: 1, Type: entity.Note, Page: 1, Data: "{}"}
+	if _, err := store.UpdateAnnotation("doc", "node-1", update); !errors.Is(err, ErrAnnotationLockRequired) {
+		t.Fatalf("update with expired lock: got %v, want ErrAnnotationLockRequired", err)
+	}
+	if _, err := store.RefreshAnnotationLocks("doc", "node-1", nil); err != nil {
+		t.Fatal(err)
+	} else if !store.documents["doc"].AnnotationLocks[1].expired(time.Now()) {
+		t.Fatal("heartbeat revived an expired lock")
+	}
+	if locks, _ := store.GetDocumentLocks("doc"); len(locks) != 0 {
+		t.Fatalf("expired lock listed: %v", locks)
+	}
+
+	lock, err := store.AcquireAnnotationLock("doc", 1, "node-2", bob)
+	if err != nil {
+		t.Fatalf("acquire of expired lock: %v", err)
+	}
+	if lock.OwnerClientID != "node-2" {
+		t.Fatalf("lock owned by %s, want node-2", lock.OwnerClientID)
+	}
+	if _, err := store.UpdateAnnotation("doc", "node-2", update); err != nil {
+		t.Fatalf("update by new owner: %v", err)
+	}
+}
+
+func TestLostLeaseEvictsDocument(t *testing.T) {
+	store := newTestStore()
+	var lost []string
+	store.OnDocumentLost(func(documentUUID string) {
+		lost = append(lost, documentUUID)
+	})
+
+	if claimed, err := store.broker.ClaimLease(documentLeaseKey("doc"), "other", time.Minute); err != nil || !claimed {
+		t.Fatalf("other node could not claim the lease: %v", err)
+	}
+	store.renewDocumentLeases()
+
+	if store.IsDocumentCached("doc") {
+		t.Fatal("document still cached after its lease was lost")
+	}
+	if len(lost) != 1 || lost[0] != "doc" {
+		t.Fatalf("lost documents %v, want [doc]", lost)
+	}
+}
+
+// unreachableBroker fails to renew leases, like a broker the node lost its connection to.
+type unreachableBroker struct {
+	*MemoryBroker
+}
+
+func (unreachableBroker) ClaimLease(string, string, time.Duration) (bool, error) {
+	return false, errors.New("broker unreachable")
+}
+
+func TestUnrenewedLeaseEvictsDocument(t *testing.T) {
+	store := newTestStore()
+	store.broker = unreachableBroker{NewMemoryBroker()}
+	var lost []string
+	store.OnDocumentLost(func(documentUUID string) {
+		lost = append(lost, documentUUID)
+	})
+	alice := User{UserID: 1, Username: "alice"}
+	if _, err := store.AcquireAnnotationLock("doc", 1, "node-1", alice); err != nil {
+		t.Fatal(err)
+	}
+
+	store.renewDocumentLeases()
+	if !store.IsDocumentCached("doc") {
+		t.Fatal("document evicted while its lease was still held")
+	}
+
+	state := store.documents["doc"]
+	state.LeaseValidUntil = time.Now().Add(-time.Second)
+	state.Dirty = true
+	update := annotationMessage{ID: 1, Type: entity.Note, Page: 1, Data: "{}"}
+	if _, err := store.UpdateAnnotation("doc", "node-1", update); !errors.Is(err, ErrLeaseExpired) {
+		t.Fatalf("update after the lease expired: got %v, want ErrLeaseExpired", err)
+	}
+	if err := store.FlushDocument("doc"); !errors.Is(err, ErrLeaseExpired) {
+		t.Fatalf("flush after the lease expired: got %v, want ErrLeaseExpired", err)
+	}
+
+	store.renewDocumentLeases()
+	if store.IsDocumentCached("doc") {
+		t.Fatal("document still cached after its lease expired")
+	}
+	if len(lost) != 1 || lost[0] != "doc" {
+		t.Fatalf("lost documents %v, want [doc]", lost)
+	}
+}
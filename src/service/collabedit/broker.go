@@ -0,0 +1,95 @@
+package collabedit
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrDocumentBusy is returned if another node holds the lease of the document.
+var ErrDocumentBusy = errors.New("document is open on another node")
+
+// ErrLeaseExpired is returned for changes to a document whose lease could not be renewed
+// in time, another node may serve it already.
+var ErrLeaseExpired = errors.New("lease of the document expired")
+
+// Broker shares the state of the collab service between the nodes serving it: the
+// broadcasts, the single-use tokens, the annotation ids and the document leases.
+// The MemoryBroker keeps everything in the process and serves a single node, the
+// RedisBroker shares it between the nodes using the same Redis server.
+//
+// A document is edited on one node at a time: the node caching its annotations holds
+// the lease of the document. Annotations and their locks are kept by that node only,
+// not in the broker, so they never diverge. Other nodes refuse connections to the
+// document with ErrDocumentBusy until the lease is released, the load balancer should
+// route by document. Requests for the document served by another node, like a forced
+// unlock, reach the lease holder as a Command.
+type Broker interface {
+	// Publish delivers the envelope to the subscribers of the document on every node.
+	// Envelopes of a document are delivered in the order they were published.
+	Publish(documentID string, envelope Envelope) error
+	// Subscribe calls deliver for every envelope published for the document until the
+	// returned function is called.
+	Subscribe(documentID string, deliver func(Envelope)) (func(), error)
+
+	// ClaimLease takes the lease of the key for the holder or renews it if the holder
+	// has it already. It returns false if another holder has a lease that did not
+	// expire yet.
+	ClaimLease(key, holder string, ttl time.Duration) (bool, error)
+	// ReleaseLease drops the lease of the key if the holder has it.
+	ReleaseLease(key, holder string) error
+
+	// NextID returns the next value of the counter, it is always above floor.
+	NextID(key string, floor int) (int, error)
+
+	// PutToken stores a single-use token. The broker may drop it after expiresAt.
+	PutToken(token string, value []byte, expiresAt time.Time) error
+	// GetToken returns the value of the token, consume removes it in the same step.
+	GetToken(token string, consume bool) ([]byte, bool, error)
+}
+
+// Envelope is a room broadcast on its way through the broker.
+type Envelope struct {
+	// ExcludeClientID is the client that does not receive the message, usually the
+	// sender.
+	ExcludeClientID string `json:"excludeClientId,omitempty"`
+	// Volatile messages carry state that is sent in full on reconnect, they are neither
+	// sequenced nor replayed.
+	Volatile bool            `json:"volatile,omitempty"`
+	Message  json.RawMessage `json:"message,omitempty"`
+	// Command envelopes are handled by the node holding the document, they are not sent
+	// to clients.
+	Command *Command `json:"command,omitempty"`
+}
+
+// Command asks the node holding the lease of a document to change the state it keeps.
+type Command struct {
+	Type         string `json:"type"`
+	AnnotationID int    `json:"annotationId,omitempty"`
+	UserID       int    `json:"userId,omitempty"`
+}
+
+const commandForceUnlock = "force_unlock"
+
+const (
+	documentLeaseTTL = 30 * time.Second
+	// documentLeaseMargin is taken off the TTL of a claimed lease, so the node stops
+	// writing before another node could take the lease, despite clock drift and the
+	// latency of the claim.
+	documentLeaseMargin = 5 * time.Second
+	annotationIDKey     = "collab:annotation-id"
+)
+
+func documentLeaseKey(documentUUID string) string {
+	return "collab:document:" + documentUUID
+}
+
+// newNodeID identifies the process as lease holder and prefixes its client ids, so they
+// are unique across nodes.
+func newNodeID() string {
+	token, err := generateToken()
+	if err != nil {
+		return "node"
+	}
+	return token[:8]
+}
@@ -0,0 +1,178 @@
+package collabedit
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// brokerHarness is a broker under test, advance lets the leases it keeps expire.
+type brokerHarness struct {
+	broker  Broker
+	advance func(time.Duration)
+}
+
+func TestMemoryBroker(t *testing.T) {
+	testBrokerContract(t, func(t *testing.T) brokerHarness {
+		return brokerHarness{broker: NewMemoryBroker(), advance: time.Sleep}
+	})
+}
+
+func TestRedisBroker(t *testing.T) {
+	testBrokerContract(t, func(t *testing.T) brokerHarness {
+		server := miniredis.RunT(t)
+		broker, err := NewRedisBroker("redis://" + server.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = broker.client.Close() })
+		return brokerHarness{broker: broker, advance: server.FastForward}
+	})
+}
+
+// testBrokerContract checks the guarantees of the Broker interface the service relies
+// on, every implementation has to pass it.
+func testBrokerContract(t *testing.T, newHarness func(t *testing.T) brokerHarness) {
+	t.Run("publish in order", func(t *testing.T) {
+		broker := newHarness(t).broker
+		received := make(chan Envelope, 16)
+		unsubscribe, err := broker.Subscribe("doc", func(envelope Envelope) {
+			received <- envelope
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		other := make(chan Envelope, 16)
+		unsubscribeOther, err := broker.Subscribe("other", func(envelope Envelope) {
+			other <- envelope
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unsubscribeOther()
+
+		for i := range 10 {
+			envelope := Envelope{ExcludeClientID: "client", Message: []byte(strconv.Itoa(i))}
+			if err := broker.Publish("doc", envelope); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := range 10 {
+			envelope := receiveEnvelope(t, received)
+			if !bytes.Equal(envelope.Message, []byte(strconv.Itoa(i))) || envelope.ExcludeClientID != "client" {
+				t.Fatalf("envelope %d: got %+v", i, envelope)
+			}
+		}
+		if len(other) != 0 {
+			t.Fatal("envelope delivered to the subscriber of another document")
+		}
+
+		command := Envelope{Command: &Command{Type: commandForceUnlock, AnnotationID: 3, UserID: 1}}
+		if err := broker.Publish("doc", command); err != nil {
+			t.Fatal(err)
+		}
+		if envelope := receiveEnvelope(t, received); envelope.Command == nil || *envelope.Command != *command.Command {
+			t.Fatalf("command: got %+v", envelope)
+		}
+
+		unsubscribe()
+		if err := broker.Publish("doc", Envelope{Message: []byte(`"late"`)}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case envelope := <-received:
+			t.Fatalf("envelope delivered after unsubscribe: %+v", envelope)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("leases", func(t *testing.T) {
+		harness := newHarness(t)
+		broker := harness.broker
+		claim := func(holder string) bool {
+			t.Helper()
+			claimed, err := broker.ClaimLease("lease", holder, 50*time.Millisecond)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return claimed
+		}
+
+		if !claim("a") {
+			t.Fatal("free lease not claimed")
+		}
+		if !claim("a") {
+			t.Fatal("lease not renewed by its holder")
+		}
+		if claim("b") {
+			t.Fatal("lease claimed while another holder has it")
+		}
+		if err := broker.ReleaseLease("lease", "b"); err != nil {
+			t.Fatal(err)
+		}
+		if claim("b") {
+			t.Fatal("lease released by a node not holding it")
+		}
+
+		harness.advance(100 * time.Millisecond)
+		if !claim("b") {
+			t.Fatal("expired lease not claimed")
+		}
+		if err := broker.ReleaseLease("lease", "b"); err != nil {
+			t.Fatal(err)
+		}
+		if !claim("a") {
+			t.Fatal("released lease not claimed")
+		}
+	})
+
+	t.Run("next id", func(t *testing.T) {
+		broker := newHarness(t).broker
+		for _, test := range []struct{ floor, want int }{{0, 1}, {0, 2}, {10, 11}, {5, 12}} {
+			id, err := broker.NextID("counter", test.floor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != test.want {
+				t.Fatalf("next id above %d: got %d, want %d", test.floor, id, test.want)
+			}
+		}
+	})
+
+	t.Run("tokens", func(t *testing.T) {
+		broker := newHarness(t).broker
+		if err := broker.PutToken("token", []byte("value"), time.Now().Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, consume := range []bool{false, true} {
+			value, ok, err := broker.GetToken("token", consume)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok || string(value) != "value" {
+				t.Fatalf("get with consume %v: got %q, %v", consume, value, ok)
+			}
+		}
+		if _, ok, err := broker.GetToken("token", true); err != nil || ok {
+			t.Fatalf("consumed token returned again: %v, %v", ok, err)
+		}
+		if _, ok, err := broker.GetToken("unknown", false); err != nil || ok {
+			t.Fatalf("unknown token returned: %v, %v", ok, err)
+		}
+	})
+}
+
+func receiveEnvelope(t *testing.T, received <-chan Envelope) Envelope {
+	t.Helper()
+	select {
+	case envelope := <-received:
+		return envelope
+	case <-time.After(time.Second):
+		t.Fatal("no envelope delivered")
+		return Envelope{}
+	}
+}
@@ -0,0 +1,137 @@
+package collabedit
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryLease struct {
+	holder    string
+	expiresAt time.Time
+}
+
+type memoryToken struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+type memorySubscription struct {
+	deliver func(Envelope)
+}
+
+// MemoryBroker is the Broker of a single node.
+type MemoryBroker struct {
+	// publishMu keeps the order of the envelopes, they are delivered while it is held.
+	publishMu   sync.Mutex
+	mu          sync.Mutex
+	subscribers map[string][]*memorySubscription
+	leases      map[string]memoryLease
+	counters    map[string]int
+	tokens      map[string]memoryToken
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		subscribers: make(map[string][]*memorySubscription),
+		leases:      make(map[string]memoryLease),
+		counters:    make(map[string]int),
+		tokens:      make(map[string]memoryToken),
+	}
+}
+
+func (b *MemoryBroker) Publish(documentID string, envelope Envelope) error {
+	b.publishMu.Lock()
+	defer b.publishMu.Unlock()
+
+	b.mu.Lock()
+	subscribers := append([]*memorySubscription(nil), b.subscribers[documentID]...)
+	b.mu.Unlock()
+
+	for _, subscription := range subscribers {
+		subscription.deliver(envelope)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(documentID string, deliver func(Envelope)) (func(), error) {
+	subscription := &memorySubscription{deliver: deliver}
+
+	b.mu.Lock()
+	b.subscribers[documentID] = append(b.subscribers[documentID], subscription)
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		remaining := make([]*memorySubscription, 0, len(b.subscribers[documentID]))
+		for _, current := range b.subscribers[documentID] {
+			if current != subscription {
+				remaining = append(remaining, current)
+			}
+		}
+		if len(remaining) == 0 {
+			delete(b.subscribers, documentID)
+			return
+		}
+		b.subscribers[documentID] = remaining
+	}, nil
+}
+
+func (b *MemoryBroker) ClaimLease(key, holder string, ttl time.Duration) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if lease, ok := b.leases[key]; ok && lease.holder != holder && now.Before(lease.expiresAt) {
+		return false, nil
+	}
+	b.leases[key] = memoryLease{holder: holder, expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (b *MemoryBroker) ReleaseLease(key, holder string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lease, ok := b.leases[key]; ok && lease.holder == holder {
+		delete(b.leases, key)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) NextID(key string, floor int) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	next := max(b.counters[key], floor) + 1
+	b.counters[key] = next
+	return next, nil
+}
+
+func (b *MemoryBroker) PutToken(token string, value []byte, expiresAt time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for current, entry := range b.tokens {
+		if now.After(entry.expiresAt) {
+			delete(b.tokens, current)
+		}
+	}
+	b.tokens[token] = memoryToken{value: value, expiresAt: expiresAt}
+	return nil
+}
+
+func (b *MemoryBroker) GetToken(token string, consume bool) ([]byte, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry, ok := b.tokens[token]
+	if !ok {
+		return nil, false, nil
+	}
+	if consume {
+		delete(b.tokens, token)
+	}
+	return entry.value, true, nil
+}
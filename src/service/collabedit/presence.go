@@ -0,0 +1,124 @@
+package collabedit
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// presenceThrottle is the minimum interval between two presence broadcasts of a room.
+// Updates in between are merged, only the latest state of every client is sent.
+const presenceThrottle = 100 * time.Millisecond
+
+var ErrInvalidPresence = errors.New("invalid presence")
+
+type cursorMessage struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// viewportMessage is the visible area of the page, relative to the page size, so it
+// does not depend on the zoom level of the viewer.
+type viewportMessage struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Zoom   float64 `json:"zoom,omitempty"`
+}
+
+type presenceMessage struct {
+	ClientID string           `json:"clientId"`
+	User     User             `json:"user"`
+	Page     int64            `json:"page"`
+	Cursor   *cursorMessage   `json:"cursor,omitempty"`
+	Viewport *viewportMessage `json:"viewport,omitempty"`
+	// FollowingClientID is the client whose viewport this client follows.
+	FollowingClientID string `json:"followingClientId,omitempty"`
+	UpdatedAt         int64  `json:"updatedAt"`
+}
+
+// updatePresence stores the presence of the client and schedules a broadcast.
+func (r *room) updatePresence(c *client, input presenceMessage) error {
+	if err := validatePresenceInput(input); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.clients[c]; !ok {
+		return nil
+	}
+	if input.FollowingClientID == c.id {
+		input.FollowingClientID = ""
+	}
+	input.ClientID = c.id
+	input.User = c.user
+	input.UpdatedAt = time.Now().UnixMilli()
+	r.presence[c.id] = &input
+	r.dirtyPresence[c.id] = struct{}{}
+
+	if !r.presenceScheduled {
+		r.presenceScheduled = true
+		delay := presenceThrottle - time.Since(r.lastPresenceAt)
+		time.AfterFunc(max(delay, 0), r.flushPresence)
+	}
+	return nil
+}
+
+// flushPresence broadcasts the presence of the clients that changed since the last
+// broadcast. The sender receives its own presence as well, so all clients share one
+// ordering.
+func (r *room) flushPresence() {
+	r.mu.Lock()
+	r.presenceScheduled = false
+	r.lastPresenceAt = time.Now()
+	updates := make([]presenceMessage, 0, len(r.dirtyPresence))
+	for clientID := range r.dirtyPresence {
+		if presence, ok := r.presence[clientID]; ok {
+			updates = append(updates, *presence)
+		}
+	}
+	clear(r.dirtyPresence)
+	r.mu.Unlock()
+
+	if len(updates) == 0 {
+		return
+	}
+	r.broadcastVolatile(outboundMessage{
+		Type:       "presence:updated",
+		DocumentID: r.documentID,
+		Presence:   updates,
+	}, nil)
+}
+
+// listPresenceLocked returns the presence of every client that reported one.
+func (r *room) listPresenceLocked() []presenceMessage {
+	list := make([]presenceMessage, 0, len(r.presence))
+	for _, presence := range r.presence {
+		list = append(list, *presence)
+	}
+	return list
+}
+
+func validatePresenceInput(input presenceMessage) error {
+	if input.Page < 1 {
+		return ErrInvalidPresence
+	}
+	values := make([]float64, 0, 7)
+	if input.Cursor != nil {
+		values = append(values, input.Cursor.X, input.Cursor.Y)
+	}
+	if input.Viewport != nil {
+		if input.Viewport.Width < 0 || input.Viewport.Height < 0 || input.Viewport.Zoom < 0 {
+			return ErrInvalidPresence
+		}
+		values = append(values, input.Viewport.X, input.Viewport.Y, input.Viewport.Width, input.Viewport.Height, input.Viewport.Zoom)
+	}
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return ErrInvalidPresence
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package collabedit
+
+import (
+	"strconv"
+	"time"
+)
+
+// replayBufferSize is the number of broadcasts a room keeps for clients that resume
+// after a reconnect. A client that missed more has to resync.
+const replayBufferSize = 512
+
+type replayEvent struct {
+	seq     uint64
+	payload []byte
+}
+
+func newRoomEpoch() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// sequenceLocked assigns the next sequence number of the room to the message and keeps
+// it for replay. The caller has to queue the payload before releasing mu, so every
+// client receives the broadcasts in sequence order.
+func (r *room) sequenceLocked(message outboundMessage) []byte {
+	r.seq++
+	message.Seq = r.seq
+	payload := mustMarshal(message)
+
+	if len(r.history) == replayBufferSize {
+		r.history = r.history[1:]
+	}
+	r.history = append(r.history, replayEvent{seq: r.seq, payload: payload})
+	return payload
+}
+
+// ResumePoint is the last broadcast a reconnecting client received, it is passed when
+// the client connects again.
+type ResumePoint struct {
+	Epoch string
+	Seq   uint64
+}
+
+// missedLocked returns the broadcasts the client missed since the resume point. It
+// returns false if the client has to resync: the room was recreated in between, so the
+// epoch differs, or the buffer no longer holds all missed broadcasts.
+func (r *room) missedLocked(resume ResumePoint) ([][]byte, bool) {
+	oldest := r.seq + 1
+	if len(r.history) > 0 {
+		oldest = r.history[0].seq
+	}
+	if resume.Epoch != r.epoch || resume.Seq > r.seq || resume.Seq+1 < oldest {
+		return nil, false
+	}
+
+	missed := make([][]byte, 0, r.seq-resume.Seq)
+	for _, event := range r.history {
+		if event.seq > resume.Seq {
+			missed = append(missed, event.payload)
+		}
+	}
+	return missed, true
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"sync"
+	"time"
 
 	"golang.org/x/net/websocket"
 )
@@ -17,42 +18,53 @@ type client struct {
 	send chan []byte
 }
 
+// clientSendBuffer is the number of messages queued for a client before it is dropped.
+// A resuming client gets room for the replayed broadcasts on top.
+const clientSendBuffer = 32
+
 type room struct {
 	documentID string
 	mu         sync.RWMutex
 	clients    map[*client]struct{}
+	// broker delivers the broadcasts of every node to the room, unsubscribe stops it.
+	broker      Broker
+	unsubscribe func()
+	// epoch identifies this instance of the room. Sequence numbers only compare within
+	// one epoch, the room is recreated once every client left.
+	epoch   string
+	seq     uint64
+	history []replayEvent
+	// presence holds the last reported page, cursor and viewport per client id.
+	presence          map[string]*presenceMessage
+	dirtyPresence     map[string]struct{}
+	presenceScheduled bool
+	lastPresenceAt    time.Time
 }
 
-func newRoom(documentID string) *room {
+func newRoom(documentID string, broker Broker) *room {
 	return &room{
-		documentID: documentID,
-		clients:    make(map[*client]struct{}),
+		documentID:    documentID,
+		broker:        broker,
+		epoch:         newRoomEpoch(),
+		clients:       make(map[*client]struct{}),
+		presence:      make(map[string]*presenceMessage),
+		dirtyPresence: make(map[string]struct{}),
 	}
 }
 
-func (r *room) handleConnection(s *Service, ws *websocket.Conn, clientID string, user User) error {
-	client, users := r.join(ws, clientID, user)
-	defer r.disconnect(s, client)
-
-	go client.writePump()
-
-	locks, err := s.annotations.GetDocumentLocks(r.documentID)
+func (r *room) handleConnection(s *Service, ws *websocket.Conn, clientID string, user User, resume *ResumePoint) error {
+	client, err := r.join(s.annotations, ws, clientID, user, resume)
 	if err != nil {
 		return err
 	}
+	defer r.disconnect(s, client)
 
-	client.queue(outboundMessage{
-		Type:            "room_state",
-		DocumentID:      r.documentID,
-		ClientID:        client.id,
-		User:            &user,
-		Users:           users,
-		AnnotationLocks: locks,
-	})
+	go client.writePump()
 
 	r.broadcast(outboundMessage{
 		Type:       "user_joined",
 		DocumentID: r.documentID,
+		ClientID:   client.id,
 		User:       &user,
 	}, client)
 
@@ -74,16 +86,32 @@ func (r *room) handleConnection(s *Service, ws *websocket.Conn, clientID string,
 	}
 }
 
-func (r *room) join(ws *websocket.Conn, clientID string, user User) (*client, []User) {
+// join adds the client to the room and queues its room_state. A resuming client gets the
+// broadcasts it missed after it, followed by "resumed", or "resync" if they are gone.
+// Everything is queued under mu, so live broadcasts are only queued after it.
+func (r *room) join(annotations *AnnotationStore, ws *websocket.Conn, clientID string, user User, resume *ResumePoint) (*client, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	// Read under mu: a lock change is stored before its broadcast is delivered, so the
+	// room_state never misses a change whose broadcast is not queued after it.
+	locks, err := annotations.GetDocumentLocks(r.documentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var missed [][]byte
+	resumed := false
+	if resume != nil {
+		missed, resumed = r.missedLocked(*resume)
+	}
+
 	currentClient := &client{
 		id:   clientID,
 		conn: ws,
 		room: r,
 		user: user,
-		send: make(chan []byte, 32),
+		send: make(chan []byte, clientSendBuffer+len(missed)+2),
 	}
 	r.clients[currentClient] = struct{}{}
 
@@ -92,7 +120,35 @@ func (r *room) join(ws *websocket.Conn, clientID string, user User) (*client, []
 		users = append(users, member.user)
 	}
 
-	return currentClient, users
+	currentClient.queue(outboundMessage{
+		Type:            "room_state",
+		DocumentID:      r.documentID,
+		ClientID:        currentClient.id,
+		User:            &user,
+		Users:           users,
+		AnnotationLocks: locks,
+		Presence:        r.listPresenceLocked(),
+		Epoch:           r.epoch,
+		Seq:             r.seq,
+	})
+	if resume == nil {
+		return currentClient, nil
+	}
+
+	resumeType := "resync"
+	if resumed {
+		for _, payload := range missed {
+			currentClient.queueBytes(payload)
+		}
+		resumeType = "resumed"
+	}
+	currentClient.queue(outboundMessage{
+		Type:       resumeType,
+		DocumentID: r.documentID,
+		Epoch:      r.epoch,
+		Seq:        r.seq,
+	})
+	return currentClient, nil
 }
 
 func (r *room) disconnect(s *Service, currentClient *client) {
@@ -107,6 +163,12 @@ func (r *room) disconnect(s *Service, currentClient *client) {
 	}
 
 	if !r.leave(currentClient) {
+		r.broadcast(outboundMessage{
+			Type:       "user_left",
+			DocumentID: r.documentID,
+			ClientID:   currentClient.id,
+			User:       &currentClient.user,
+		}, nil)
 		return
 	}
 	if s.removeRoomIfEmpty(r) {
@@ -119,38 +181,75 @@ func (r *room) leave(currentClient *client) bool {
 	defer r.mu.Unlock()
 
 	delete(r.clients, currentClient)
-	if len(r.clients) == 0 {
-		close(currentClient.send)
-		return true
-	}
+	delete(r.presence, currentClient.id)
+	delete(r.dirtyPresence, currentClient.id)
+	close(currentClient.send)
+	return len(r.clients) == 0
+}
 
-	payload := mustMarshal(outboundMessage{
-		Type:       "user_left",
-		DocumentID: r.documentID,
-		User:       &currentClient.user,
-	})
+// broadcast sends the message to the clients of the room on every node, each room gives
+// it its next sequence number.
+func (r *room) broadcast(message outboundMessage, exclude *client) {
+	r.publish(message, exclude, false)
+}
 
-	for member := range r.clients {
-		member.queueBytes(payload)
+// broadcastVolatile sends the message without a sequence number. It is for state that
+// is sent in full to clients that reconnect, like the presence.
+func (r *room) broadcastVolatile(message outboundMessage, exclude *client) {
+	r.publish(message, exclude, true)
+}
+
+func (r *room) publish(message outboundMessage, exclude *client, volatile bool) {
+	envelope := Envelope{
+		Volatile: volatile,
+		Message:  mustMarshal(message),
+	}
+	if exclude != nil {
+		envelope.ExcludeClientID = exclude.id
+	}
+	if err := r.broker.Publish(r.documentID, envelope); err != nil {
+		log.Errorf("failed to publish %s for %s: %v", message.Type, r.documentID, err)
 	}
-	close(currentClient.send)
-	return false
 }
 
-func (r *room) broadcast(message outboundMessage, exclude *client) {
-	payload := mustMarshal(message)
+// deliver queues a broadcast received from the broker for the clients of the room.
+func (r *room) deliver(envelope Envelope) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	payload := []byte(envelope.Message)
+	if !envelope.Volatile {
+		var message outboundMessage
+		if err := json.Unmarshal(envelope.Message, &message); err != nil {
+			log.Warnf("dropping malformed broadcast for %s: %v", r.documentID, err)
+			return
+		}
+		payload = r.sequenceLocked(message)
+	}
 
 	for member := range r.clients {
-		if member == exclude {
+		if member.id == envelope.ExcludeClientID {
 			continue
 		}
 		member.queueBytes(payload)
 	}
 }
 
+// closeConnections closes the websockets of the clients, they leave the room as their
+// connections end.
+func (r *room) closeConnections() {
+	r.mu.RLock()
+	conns := make([]*websocket.Conn, 0, len(r.clients))
+	for member := range r.clients {
+		conns = append(conns, member.conn)
+	}
+	r.mu.RUnlock()
+
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+}
+
 func (r *room) isEmpty() bool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -0,0 +1,259 @@
+package collabedit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func deliverEvent(r *room, n int) {
+	r.deliver(Envelope{Message: mustMarshal(outboundMessage{Type: "annotation:updated", Reason: fmt.Sprint(n)})})
+}
+
+// drain returns the messages queued for the client.
+func drain(t *testing.T, c *client) []outboundMessage {
+	t.Helper()
+	var messages []outboundMessage
+	for {
+		select {
+		case payload := <-c.send:
+			var message outboundMessage
+			if err := json.Unmarshal(payload, &message); err != nil {
+				t.Fatal(err)
+			}
+			messages = append(messages, message)
+		default:
+			return messages
+		}
+	}
+}
+
+func TestJoinResumesBeforeLiveBroadcasts(t *testing.T) {
+	store := newTestStore()
+	r := newRoom("doc", store.broker)
+	for i := 1; i <= 5; i++ {
+		deliverEvent(r, i)
+	}
+
+	c, err := r.join(store, nil, "node-1", User{UserID: 1}, &ResumePoint{Epoch: r.epoch, Seq: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliverEvent(r, 6)
+
+	messages := drain(t, c)
+	var types []string
+	var seqs []uint64
+	for _, message := range messages {
+		types = append(types, message.Type)
+		seqs = append(seqs, message.Seq)
+	}
+	want := []string{"room_state", "annotation:updated", "annotation:updated", "annotation:updated", "resumed", "annotation:updated"}
+	if fmt.Sprint(types) != fmt.Sprint(want) {
+		t.Fatalf("got %v, want %v", types, want)
+	}
+	if fmt.Sprint(seqs) != fmt.Sprint([]uint64{5, 3, 4, 5, 5, 6}) {
+		t.Fatalf("got seqs %v, want [5 3 4 5 5 6]", seqs)
+	}
+}
+
+func TestJoinResyncs(t *testing.T) {
+	store := newTestStore()
+	r := newRoom("doc", store.broker)
+	for i := 1; i <= replayBufferSize+2; i++ {
+		deliverEvent(r, i)
+	}
+
+	tests := []struct {
+		name   string
+		resume ResumePoint
+	}{
+		{"other epoch", ResumePoint{Epoch: "old", Seq: r.seq}},
+		{"missed more than the buffer", ResumePoint{Epoch: r.epoch, Seq: 1}},
+		{"ahead of the room", ResumePoint{Epoch: r.epoch, Seq: r.seq + 1}},
+	}
+	for _, tt := range tests {
+		c, err := r.join(store, nil, tt.name, User{UserID: 1}, &tt.resume)
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages := drain(t, c)
+		if len(messages) != 2 || messages[0].Type != "room_state" || messages[1].Type != "resync" {
+			t.Errorf("%s: got %v, want room_state and resync", tt.name, messages)
+		}
+	}
+}
+
+// TestJoinOrderWithConcurrentBroadcasts checks that a resuming client sees every
+// broadcast once and in order while others are delivered during the join.
+func TestJoinOrderWithConcurrentBroadcasts(t *testing.T) {
+	store := newTestStore()
+	r := newRoom("doc", store.broker)
+	for i := 1; i <= 10; i++ {
+		deliverEvent(r, i)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 11; i <= 30; i++ {
+			deliverEvent(r, i)
+		}
+	}()
+	c, err := r.join(store, nil, "node-1", User{UserID: 1}, &ResumePoint{Epoch: r.epoch, Seq: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	messages := drain(t, c)
+	if messages[0].Type != "room_state" {
+		t.Fatalf("first message is %s, want room_state", messages[0].Type)
+	}
+	next := uint64(5)
+	sawResumed := false
+	for _, message := range messages[1:] {
+		if message.Type == "resumed" {
+			if message.Seq != next-1 {
+				t.Fatalf("resumed at %d, want %d", message.Seq, next-1)
+			}
+			sawResumed = true
+			continue
+		}
+		if message.Seq != next {
+			t.Fatalf("got seq %d, want %d", message.Seq, next)
+		}
+		next++
+	}
+	if !sawResumed || next != 31 {
+		t.Fatalf("resumed %t, last seq %d, want resumed and 30", sawResumed, next-1)
+	}
+}
+
+// addClient puts a client without connection into the room.
+func addClient(r *room, id string, userID int) *client {
+	c := &client{id: id, room: r, user: User{UserID: userID}, send: make(chan []byte, 16)}
+	r.mu.Lock()
+	r.clients[c] = struct{}{}
+	r.mu.Unlock()
+	return c
+}
+
+// nextMessage waits for the next message queued for the client.
+func nextMessage(t *testing.T, c *client) outboundMessage {
+	t.Helper()
+	select {
+	case payload := <-c.send:
+		var message outboundMessage
+		if err := json.Unmarshal(payload, &message); err != nil {
+			t.Fatal(err)
+		}
+		return message
+	case <-time.After(time.Second):
+		t.Fatal("no message")
+		return outboundMessage{}
+	}
+}
+
+func TestPresenceUpdatesAreMerged(t *testing.T) {
+	store := newTestStore()
+	r := newRoom("doc", store.broker)
+	if _, err := store.broker.Subscribe("doc", r.deliver); err != nil {
+		t.Fatal(err)
+	}
+	alice := addClient(r, "alice", 1)
+	bob := addClient(r, "bob", 2)
+
+	if err := r.updatePresence(alice, presenceMessage{Page: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if message := nextMessage(t, bob); message.Type != "presence:updated" || len(message.Presence) != 1 {
+		t.Fatalf("first update: got %+v", message)
+	}
+
+	// Sent within the throttle of the first broadcast, only the latest state of every
+	// client goes out, in one broadcast.
+	for page := int64(2); page <= 4; page++ {
+		if err := r.updatePresence(alice, presenceMessage{Page: page}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.updatePresence(bob, presenceMessage{Page: 9}); err != nil {
+		t.Fatal(err)
+	}
+
+	message := nextMessage(t, bob)
+	pages := map[string]int64{}
+	for _, presence := range message.Presence {
+		pages[presence.ClientID] = presence.Page
+	}
+	if len(message.Presence) != 2 || pages["alice"] != 4 || pages["bob"] != 9 {
+		t.Fatalf("merged update: got %+v", message.Presence)
+	}
+	if extra := drain(t, bob); len(extra) != 0 {
+		t.Fatalf("updates were not merged, also got %+v", extra)
+	}
+}
+
+func TestPresenceDropsSelfFollow(t *testing.T) {
+	store := newTestStore()
+	r := newRoom("doc", store.broker)
+	alice := addClient(r, "alice", 1)
+	addClient(r, "bob", 2)
+
+	tests := []struct {
+		following string
+		want      string
+	}{
+		{"alice", ""},
+		{"bob", "bob"},
+	}
+	for _, test := range tests {
+		if err := r.updatePresence(alice, presenceMessage{Page: 1, FollowingClientID: test.following}); err != nil {
+			t.Fatal(err)
+		}
+		r.mu.RLock()
+		got := r.presence["alice"].FollowingClientID
+		r.mu.RUnlock()
+		if got != test.want {
+			t.Errorf("following %q: stored %q, want %q", test.following, got, test.want)
+		}
+	}
+}
+
+func TestValidatePresenceInput(t *testing.T) {
+	viewport := func(x, width, height, zoom float64) *viewportMessage {
+		return &viewportMessage{X: x, Width: width, Height: height, Zoom: zoom}
+	}
+
+	tests := []struct {
+		name  string
+		input presenceMessage
+		valid bool
+	}{
+		{"page only", presenceMessage{Page: 1}, true},
+		{"cursor and viewport", presenceMessage{Page: 2, Cursor: &cursorMessage{X: 0.5, Y: 0.5}, Viewport: viewport(0, 1, 1, 1.5)}, true},
+		{"no page", presenceMessage{Page: 0}, false},
+		{"NaN cursor", presenceMessage{Page: 1, Cursor: &cursorMessage{X: math.NaN()}}, false},
+		{"infinite cursor", presenceMessage{Page: 1, Cursor: &cursorMessage{Y: math.Inf(-1)}}, false},
+		{"infinite viewport", presenceMessage{Page: 1, Viewport: viewport(math.Inf(1), 1, 1, 1)}, false},
+		{"negative width", presenceMessage{Page: 1, Viewport: viewport(0, -1, 1, 1)}, false},
+		{"negative height", presenceMessage{Page: 1, Viewport: viewport(0, 1, -1, 1)}, false},
+		{"negative zoom", presenceMessage{Page: 1, Viewport: viewport(0, 1, 1, -1)}, false},
+		{"NaN zoom", presenceMessage{Page: 1, Viewport: viewport(0, 1, 1, math.NaN())}, false},
+	}
+	for _, test := range tests {
+		err := validatePresenceInput(test.input)
+		if test.valid && err != nil {
+			t.Errorf("%s: got %v, want valid", test.name, err)
+		}
+		if !test.valid && !errors.Is(err, ErrInvalidPresence) {
+			t.Errorf("%s: got %v, want ErrInvalidPresence", test.name, err)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"paperlink/db/entity"
 	"paperlink/db/repo"
 	"paperlink/util"
 
@@ -23,6 +24,9 @@ var (
 	ErrTokenInvalid     = errors.New("token invalid")
 	ErrTokenExpired     = errors.New("token expired")
 	ErrUserNotFound     = errors.New("user not found")
+	// ErrUnlockForwarded is returned by ForceUnlock if the document is not open on this
+	// node. The unlock is sent to the node holding it.
+	ErrUnlockForwarded = errors.New("unlock forwarded to the node holding the document")
 )
 
 type User struct {
@@ -40,6 +44,7 @@ type annotationLockMessage struct {
 	User          User   `json:"user"`
 	OwnerClientID string `json:"ownerClientId"`
 	LockedAt      int64  `json:"lockedAt"`
+	ExpiresAt     int64  `json:"expiresAt"`
 }
 
 type outboundMessage struct {
@@ -54,7 +59,16 @@ type outboundMessage struct {
 	AnnotationID    *int                    `json:"annotationId,omitempty"`
 	AnnotationLock  *annotationLockMessage  `json:"annotationLock,omitempty"`
 	AnnotationLocks []annotationLockMessage `json:"annotationLocks,omitempty"`
-	Error           string                  `json:"error,omitempty"`
+	Presence        []presenceMessage       `json:"presence,omitempty"`
+	CommentThread   json.RawMessage         `json:"commentThread,omitempty"`
+	CommentID       *int                    `json:"commentId,omitempty"`
+	// Epoch and Seq identify a broadcast within the room, see ResumePoint.
+	Epoch string `json:"epoch,omitempty"`
+	Seq   uint64 `json:"seq,omitempty"`
+	// Reason tells why a lock was released if it was not released by its owner,
+	// "expired" or "forced".
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
 }
 
 type inboundMessage struct {
@@ -62,26 +76,67 @@ type inboundMessage struct {
 	Page         *int64             `json:"page,omitempty"`
 	Annotation   *annotationMessage `json:"annotation,omitempty"`
 	AnnotationID *int               `json:"annotationId,omitempty"`
+	Presence     *presenceMessage   `json:"presence,omitempty"`
 }
 
 type Service struct {
 	mu           sync.RWMutex
 	rooms        map[string]*room
+	broker       Broker
+	nodeID       string
 	tokens       *tokenStore
 	annotations  *AnnotationStore
 	nextClientID uint64
 }
 
+// NewService creates the service with a RedisBroker if PAPERLINK_COLLAB_REDIS_URL is
+// set, so several nodes can serve it, and with a MemoryBroker otherwise.
 func NewService() *Service {
-	return &Service{
+	redisURL := util.EnvString("PAPERLINK_COLLAB_REDIS_URL", "")
+	if redisURL == "" {
+		return NewServiceWithBroker(NewMemoryBroker())
+	}
+
+	broker, err := NewRedisBroker(redisURL)
+	if err != nil {
+		log.Fatalf("Error connecting to the collab broker: %v", err)
+	}
+	log.Infof("sharing collab state through redis")
+	return NewServiceWithBroker(broker)
+}
+
+// NewServiceWithBroker creates a service that shares its rooms, tokens and documents
+// with the other nodes using the broker.
+func NewServiceWithBroker(broker Broker) *Service {
+	nodeID := newNodeID()
+	s := &Service{
 		rooms:       make(map[string]*room),
-		tokens:      newTokenStore(2 * time.Minute),
-		annotations: NewAnnotationStore(),
+		broker:      broker,
+		nodeID:      nodeID,
+		tokens:      newTokenStore(broker, 2*time.Minute),
+		annotations: NewAnnotationStore(broker, nodeID),
 	}
+	s.annotations.OnLocksExpired(func(documentID string, locks []annotationLockMessage) {
+		s.broadcastUnlocked(documentID, locks, "expired")
+	})
+	s.annotations.OnDocumentLost(s.closeRoom)
+	return s
 }
 
 var PDFCollab = NewService()
 
+// IsDocumentOpen reports whether the document is edited on this node, its annotations
+// may not be in the database yet.
+func (s *Service) IsDocumentOpen(documentID string) bool {
+	return s.annotations.IsDocumentCached(documentID)
+}
+
+// GetOpenAnnotation returns an annotation of a document edited on this node, including
+// changes not flushed yet. open is false if the document is not edited here.
+func (s *Service) GetOpenAnnotation(documentID string, annotationID int) (annotation *entity.Annotation, open bool) {
+	return s.annotations.GetCachedAnnotation(documentID, annotationID)
+}
+
 func (s *Service) CreateSingleUseToken(documentID string, userID int) (*TokenResult, error) {
 	user, err := s.authorizeOwner(documentID, userID)
 	if err != nil {
@@ -98,7 +153,9 @@ func (s *Service) ValidateConnection(documentID, token string) error {
 	return s.tokens.validate(documentID, token)
 }
 
-func (s *Service) HandleConnection(documentID, token string, ws *websocket.Conn) error {
+// HandleConnection serves the websocket of a client. A client that reconnects passes the
+// last broadcast it received as resume and gets the ones it missed after its room_state.
+func (s *Service) HandleConnection(documentID, token string, resume *ResumePoint, ws *websocket.Conn) error {
 	user, err := s.tokens.consume(documentID, token)
 	if err != nil {
 		s.sendError(ws, err.Error())
@@ -111,8 +168,12 @@ func (s *Service) HandleConnection(documentID, token string, ws *websocket.Conn)
 	}
 	s.annotations.MarkRoomActive(documentID)
 
-	currentRoom := s.getOrCreateRoom(documentID)
-	return currentRoom.handleConnection(s, ws, s.allocateClientID(), user)
+	currentRoom, err := s.getOrCreateRoom(documentID)
+	if err != nil {
+		s.sendError(ws, err.Error())
+		return err
+	}
+	return currentRoom.handleConnection(s, ws, s.allocateClientID(), user, resume)
 }
 
 func (s *Service) handleIncomingPayload(currentRoom *room, client *client, payload []byte) error {
@@ -258,11 +319,148 @@ func (s *Service) handleClientMessage(currentRoom *room, client *client, message
 		}, nil)
 		return nil
 
+	case "annotation:heartbeat":
+		locks, err := s.annotations.RefreshAnnotationLocks(documentID, client.id, message.AnnotationID)
+		if err != nil {
+			return err
+		}
+
+		client.queue(outboundMessage{
+			Type:            "annotation:lock_renewed",
+			DocumentID:      documentID,
+			AnnotationLocks: locks,
+		})
+		return nil
+
+	case "annotation:force_unlock":
+		if message.AnnotationID == nil {
+			return ErrInvalidAnnotation
+		}
+		_, err := s.ForceUnlock(documentID, *message.AnnotationID, client.user.UserID)
+		if errors.Is(err, ErrUnlockForwarded) {
+			return nil
+		}
+		return err
+
+	case "presence:update":
+		if message.Presence == nil {
+			return ErrInvalidPresence
+		}
+		return currentRoom.updatePresence(client, *message.Presence)
+
 	default:
 		return errors.New("unknown message type")
 	}
 }
 
+// ForceUnlock releases the lock of an annotation held by any client. Only the owner of
+// the document and admins may do so. If another node holds the document, the unlock is
+// sent to it as a command and ErrUnlockForwarded is returned.
+func (s *Service) ForceUnlock(documentID string, annotationID, userID int) (*annotationLockMessage, error) {
+	doc := repo.Document.GetByUUIDWithFile(documentID)
+	if doc == nil {
+		return nil, ErrDocumentNotFound
+	}
+	if doc.UserID != userID {
+		user, err := repo.User.Get(userID)
+		if err != nil || user == nil {
+			return nil, ErrUserNotFound
+		}
+		if !user.IsAdmin {
+			return nil, ErrForbidden
+		}
+	}
+
+	if !s.annotations.IsDocumentCached(documentID) {
+		err := s.broker.Publish(documentID, Envelope{Command: &Command{
+			Type:         commandForceUnlock,
+			AnnotationID: annotationID,
+			UserID:       userID,
+		}})
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrUnlockForwarded
+	}
+	return s.forceRelease(documentID, annotationID, userID)
+}
+
+func (s *Service) forceRelease(documentID string, annotationID, userID int) (*annotationLockMessage, error) {
+	lock, err := s.annotations.ForceReleaseAnnotationLock(documentID, annotationID)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("user %d force-unlocked annotation %d of %s held by %s", userID, annotationID, documentID, lock.User.Username)
+	s.broadcastUnlocked(documentID, []annotationLockMessage{*lock}, "forced")
+	return lock, nil
+}
+
+// handleCommand runs a command of another node. Every node with a room of the document
+// receives it, only the one caching the document has state to change.
+func (s *Service) handleCommand(documentID string, command Command) {
+	if !s.annotations.IsDocumentCached(documentID) {
+		return
+	}
+	switch command.Type {
+	case commandForceUnlock:
+		if _, err := s.forceRelease(documentID, command.AnnotationID, command.UserID); err != nil && !errors.Is(err, ErrAnnotationNotLocked) {
+			log.Warnf("failed to force-unlock annotation %d of %s: %v", command.AnnotationID, documentID, err)
+		}
+	default:
+		log.Warnf("ignoring unknown command %q for %s", command.Type, documentID)
+	}
+}
+
+// closeRoom disconnects the clients of a document that another node serves now, they
+// reconnect to it through the load balancer.
+func (s *Service) closeRoom(documentID string) {
+	s.mu.RLock()
+	currentRoom := s.rooms[documentID]
+	s.mu.RUnlock()
+	if currentRoom != nil {
+		currentRoom.closeConnections()
+	}
+}
+
+// PublishCommentEvent sends a comment:* message with the current state of the thread to
+// the room of the document on every node.
+func (s *Service) PublishCommentEvent(documentID, messageType string, thread any, commentID *int) error {
+	payload, err := json.Marshal(thread)
+	if err != nil {
+		return err
+	}
+
+	return s.broker.Publish(documentID, Envelope{
+		Message: mustMarshal(outboundMessage{
+			Type:          messageType,
+			DocumentID:    documentID,
+			CommentThread: payload,
+			CommentID:     commentID,
+		}),
+	})
+}
+
+// broadcastUnlocked tells the room of the document about locks that were released
+// without their owner.
+func (s *Service) broadcastUnlocked(documentID string, locks []annotationLockMessage, reason string) {
+	s.mu.RLock()
+	currentRoom := s.rooms[documentID]
+	s.mu.RUnlock()
+	if currentRoom == nil {
+		return
+	}
+
+	for index := range locks {
+		lock := locks[index]
+		currentRoom.broadcast(outboundMessage{
+			Type:           "annotation:unlocked",
+			DocumentID:     documentID,
+			AnnotationLock: &lock,
+			Reason:         reason,
+		}, nil)
+	}
+}
+
 func (s *Service) authorizeOwner(documentID string, userID int) (*repoUser, error) {
 	doc := repo.Document.GetByUUIDWithFile(documentID)
 	if doc == nil {
@@ -289,17 +487,30 @@ type repoUser struct {
 	Username string
 }
 
-func (s *Service) getOrCreateRoom(documentID string) *room {
+func (s *Service) getOrCreateRoom(documentID string) (*room, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	currentRoom, ok := s.rooms[documentID]
 	if !ok {
-		currentRoom = newRoom(documentID)
+		currentRoom = newRoom(documentID, s.broker)
+		deliver := currentRoom.deliver
+		unsubscribe, err := s.broker.Subscribe(documentID, func(envelope Envelope) {
+			if envelope.Command != nil {
+				// Not run during the delivery, the command publishes broadcasts itself.
+				go s.handleCommand(documentID, *envelope.Command)
+				return
+			}
+			deliver(envelope)
+		})
+		if err != nil {
+			return nil, err
+		}
+		currentRoom.unsubscribe = unsubscribe
 		s.rooms[documentID] = currentRoom
 	}
 
-	return currentRoom
+	return currentRoom, nil
 }
 
 func (s *Service) removeRoomIfEmpty(currentRoom *room) bool {
@@ -314,12 +525,13 @@ func (s *Service) removeRoomIfEmpty(currentRoom *room) bool {
 	}
 
 	delete(s.rooms, currentRoom.documentID)
+	currentRoom.unsubscribe()
 	return true
 }
 
 func (s *Service) allocateClientID() string {
 	id := atomic.AddUint64(&s.nextClientID, 1)
-	return strconv.FormatUint(id, 10)
+	return s.nodeID + "-" + strconv.FormatUint(id, 10)
 }
 
 func (s *Service) sendError(ws *websocket.Conn, message string) {
@@ -3,7 +3,7 @@ package collabedit
 import (
 	"crypto/rand"
 	"encoding/base64"
-	"sync"
+	"encoding/json"
 	"time"
 )
 
@@ -13,16 +13,17 @@ type singleUseToken struct {
 	ExpiresAt  time.Time
 }
 
+// tokenStore keeps the single-use tokens in the broker, so a token created on one node
+// can be used on another one.
 type tokenStore struct {
-	mu     sync.Mutex
+	broker Broker
 	ttl    time.Duration
-	tokens map[string]singleUseToken
 }
 
-func newTokenStore(ttl time.Duration) *tokenStore {
+func newTokenStore(broker Broker, ttl time.Duration) *tokenStore {
 	return &tokenStore{
+		broker: broker,
 		ttl:    ttl,
-		tokens: make(map[string]singleUseToken),
 	}
 }
 
@@ -33,15 +34,16 @@ func (s *tokenStore) create(documentID string, user User) (*TokenResult, error)
 	}
 
 	expiresAt := time.Now().Add(s.ttl)
-
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	s.cleanupExpiredLocked(time.Now())
-	s.tokens[token] = singleUseToken{
+	value, err := json.Marshal(singleUseToken{
 		DocumentID: documentID,
 		User:       user,
 		ExpiresAt:  expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.broker.PutToken(token, value, expiresAt); err != nil {
+		return nil, err
 	}
 
 	return &TokenResult{
@@ -51,62 +53,57 @@ func (s *tokenStore) create(documentID string, user User) (*TokenResult, error)
 }
 
 func (s *tokenStore) validate(documentID, token string) error {
-	if token == "" {
-		return ErrTokenRequired
-	}
-
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	_, err := s.lookup(documentID, token)
+	return err
+}
 
-	entry, ok := s.tokens[token]
-	if !ok {
-		return ErrTokenInvalid
+// consume removes the token in the same step as it is read, so it is used at most once
+// even if two nodes receive it at the same time. The token is checked before, a token
+// presented for another document stays usable for its own.
+func (s *tokenStore) consume(documentID, token string) (User, error) {
+	entry, err := s.lookup(documentID, token)
+	if err != nil {
+		return User{}, err
 	}
 
-	if time.Now().After(entry.ExpiresAt) {
-		delete(s.tokens, token)
-		return ErrTokenExpired
+	_, ok, err := s.broker.GetToken(token, true)
+	if err != nil {
+		return User{}, err
 	}
-
-	if entry.DocumentID != documentID {
-		return ErrTokenInvalid
+	if !ok {
+		return User{}, ErrTokenInvalid
 	}
-
-	return nil
+	return entry.User, nil
 }
 
-func (s *tokenStore) consume(documentID, token string) (User, error) {
+// lookup returns the token if it is valid for the document, without consuming it.
+func (s *tokenStore) lookup(documentID, token string) (*singleUseToken, error) {
 	if token == "" {
-		return User{}, ErrTokenRequired
+		return nil, ErrTokenRequired
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	entry, ok := s.tokens[token]
+	value, ok, err := s.broker.GetToken(token, false)
+	if err != nil {
+		return nil, err
+	}
 	if !ok {
-		return User{}, ErrTokenInvalid
+		return nil, ErrTokenInvalid
+	}
+
+	var entry singleUseToken
+	if err := json.Unmarshal(value, &entry); err != nil {
+		return nil, ErrTokenInvalid
 	}
 
 	if time.Now().After(entry.ExpiresAt) {
-		delete(s.tokens, token)
-		return User{}, ErrTokenExpired
+		return nil, ErrTokenExpired
 	}
 
 	if entry.DocumentID != documentID {
-		return User{}, ErrTokenInvalid
+		return nil, ErrTokenInvalid
 	}
 
-	delete(s.tokens, token)
-	return entry.User, nil
-}
-
-func (s *tokenStore) cleanupExpiredLocked(now time.Time) {
-	for token, entry := range s.tokens {
-		if now.After(entry.ExpiresAt) {
-			delete(s.tokens, token)
-		}
-	}
+	return &entry, nil
 }
 
 func generateToken() (string, error) {
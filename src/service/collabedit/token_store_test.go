@@ -0,0 +1,31 @@
+package collabedit
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConsumeTokenOfOtherDocument(t *testing.T) {
+	store := newTokenStore(NewMemoryBroker(), time.Minute)
+	alice := User{UserID: 1, Username: "alice"}
+
+	result, err := store.create("doc-a", alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.consume("doc-b", result.Token); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("consume for another document: got %v, want ErrTokenInvalid", err)
+	}
+	user, err := store.consume("doc-a", result.Token)
+	if err != nil {
+		t.Fatalf("consume after it was presented for another document: %v", err)
+	}
+	if user != alice {
+		t.Fatalf("token of %+v, want %+v", user, alice)
+	}
+	if _, err := store.consume("doc-a", result.Token); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("second consume: got %v, want ErrTokenInvalid", err)
+	}
+}
@@ -0,0 +1,370 @@
+package comment
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+	"paperlink/service/collabedit"
+	"paperlink/util"
+
+	"gorm.io/gorm"
+)
+
+var log = util.GroupLog("COMMENT")
+
+const maxTextLength = 5000
+
+var (
+	ErrDocumentNotFound = errors.New("document not found")
+	ErrThreadNotFound   = errors.New("comment thread not found")
+	ErrCommentNotFound  = errors.New("comment not found")
+	ErrForbidden        = errors.New("forbidden")
+	ErrInvalidComment   = errors.New("invalid comment")
+	ErrInvalidAnchor    = errors.New("annotation not found on this page")
+)
+
+type Author struct {
+	UserID   int    `json:"userId"`
+	Username string `json:"username"`
+}
+
+type CommentView struct {
+	ID        int    `json:"id"`
+	ThreadID  int    `json:"threadId"`
+	Author    Author `json:"author"`
+	Text      string `json:"text"`
+	CreatedAt int64  `json:"createdAt"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+type ThreadView struct {
+	ID           int           `json:"id"`
+	DocumentID   string        `json:"documentId"`
+	Page         int64         `json:"page"`
+	AnnotationID *int          `json:"annotationId,omitempty"`
+	CreatedBy    Author        `json:"createdBy"`
+	Resolved     bool          `json:"resolved"`
+	ResolvedBy   *Author       `json:"resolvedBy,omitempty"`
+	ResolvedAt   int64         `json:"resolvedAt,omitempty"`
+	CreatedAt    int64         `json:"createdAt"`
+	UpdatedAt    int64         `json:"updatedAt"`
+	Comments     []CommentView `json:"comments"`
+}
+
+// ListThreads returns the threads of the document, only those of one page if page is
+// set.
+func ListThreads(documentUUID string, userID int, page *int64) ([]ThreadView, error) {
+	doc, err := authorize(documentUUID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	threads, err := repo.CommentThread.ListByDocument(doc.ID, page)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]ThreadView, 0, len(threads))
+	for i := range threads {
+		views = append(views, toThreadView(&threads[i], documentUUID))
+	}
+	return views, nil
+}
+
+// CreateThread starts a thread on the page of the document with its first comment.
+func CreateThread(documentUUID string, userID int, page int64, annotationID *int, text string) (*ThreadView, error) {
+	text, err := validateText(text)
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 || (annotationID != nil && *annotationID < 1) {
+		return nil, ErrInvalidComment
+	}
+
+	doc, err := authorize(documentUUID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if annotationID != nil {
+		if err := validateAnchor(doc, page, *annotationID); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().Unix()
+	thread := &entity.CommentThread{
+		DocumentID:   doc.ID,
+		Page:         page,
+		AnnotationID: annotationID,
+		CreatedByID:  userID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		Comments: []entity.Comment{{
+			UserID:    userID,
+			Text:      text,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}},
+	}
+	if err := repo.CommentThread.Save(thread); err != nil {
+		return nil, err
+	}
+
+	view, err := loadThread(thread.ID, documentUUID)
+	if err != nil {
+		return nil, err
+	}
+	notifyMentions(doc, view, &view.Comments[0])
+	publish(documentUUID, "comment:thread_created", view, &view.Comments[0].ID)
+	return view, nil
+}
+
+// Reply adds a comment to the thread. Replying to a resolved thread reopens it.
+func Reply(threadID, userID int, text string) (*ThreadView, error) {
+	text, err := validateText(text)
+	if err != nil {
+		return nil, err
+	}
+
+	thread, doc, err := authorizeThread(threadID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	comment := &entity.Comment{
+		ThreadID:  thread.ID,
+		UserID:    userID,
+		Text:      text,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := repo.Comment.Save(comment); err != nil {
+		return nil, err
+	}
+	if err := reopenAt(thread, now); err != nil {
+		return nil, err
+	}
+
+	view, err := loadThread(thread.ID, doc.UUID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range view.Comments {
+		if view.Comments[i].ID == comment.ID {
+			notifyMentions(doc, view, &view.Comments[i])
+		}
+	}
+	publish(doc.UUID, "comment:created", view, &comment.ID)
+	return view, nil
+}
+
+// SetResolved resolves or reopens the thread.
+func SetResolved(threadID, userID int, resolved bool) (*ThreadView, error) {
+	thread, doc, err := authorizeThread(threadID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	messageType := "comment:thread_reopened"
+	if resolved {
+		messageType = "comment:thread_resolved"
+		thread.Resolved = true
+		thread.ResolvedByID = &userID
+		thread.ResolvedAt = now
+		thread.UpdatedAt = now
+		if err := repo.CommentThread.UpdateResolution(thread); err != nil {
+			return nil, err
+		}
+	} else if err := reopenAt(thread, now); err != nil {
+		return nil, err
+	}
+
+	view, err := loadThread(thread.ID, doc.UUID)
+	if err != nil {
+		return nil, err
+	}
+	publish(doc.UUID, messageType, view, nil)
+	return view, nil
+}
+
+// DeleteComment removes a comment. Only its author and the owner of the document may do
+// so. The thread is removed with its last comment, the returned thread is nil then.
+func DeleteComment(commentID, userID int) (*ThreadView, error) {
+	comment, err := repo.Comment.Get(commentID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, err
+	}
+
+	thread, doc, err := authorizeThread(comment.ThreadID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if comment.UserID != userID && doc.UserID != userID {
+		return nil, ErrForbidden
+	}
+
+	threadDeleted, err := repo.Comment.DeleteFromThread(comment.ID, thread.ID)
+	if err != nil {
+		return nil, err
+	}
+	if threadDeleted {
+		deleted := toThreadView(thread, doc.UUID)
+		publish(doc.UUID, "comment:thread_deleted", &deleted, &comment.ID)
+		return nil, nil
+	}
+
+	view, err := loadThread(thread.ID, doc.UUID)
+	if err != nil {
+		return nil, err
+	}
+	publish(doc.UUID, "comment:deleted", view, &comment.ID)
+	return view, nil
+}
+
+// validateAnchor checks that the annotation belongs to the document and sits on the
+// page. A document edited right now has its current annotations in the collab cache.
+func validateAnchor(doc *entity.Document, page int64, annotationID int) error {
+	annotation, open := collabedit.PDFCollab.GetOpenAnnotation(doc.UUID, annotationID)
+	if !open {
+		var err error
+		annotation, err = repo.Annotation.GetInDocument(doc.ID, annotationID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidAnchor
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if annotation == nil || annotation.Page != page {
+		return ErrInvalidAnchor
+	}
+	return nil
+}
+
+func reopenAt(thread *entity.CommentThread, now int64) error {
+	thread.Resolved = false
+	thread.ResolvedByID = nil
+	thread.ResolvedAt = 0
+	thread.UpdatedAt = now
+	return repo.CommentThread.UpdateResolution(thread)
+}
+
+// authorize returns the document if the user owns it or it is shared with them.
+func authorize(documentUUID string, userID int) (*entity.Document, error) {
+	doc := repo.Document.GetByUUIDWithFile(documentUUID)
+	if doc == nil {
+		return nil, ErrDocumentNotFound
+	}
+	ok, err := hasAccess(doc, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrForbidden
+	}
+	return doc, nil
+}
+
+func authorizeThread(threadID, userID int) (*entity.CommentThread, *entity.Document, error) {
+	thread, err := repo.CommentThread.GetWithComments(threadID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrThreadNotFound
+		}
+		return nil, nil, err
+	}
+
+	doc, err := repo.Document.Get(thread.DocumentID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrThreadNotFound
+		}
+		return nil, nil, err
+	}
+	ok, err := hasAccess(doc, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, ErrForbidden
+	}
+	return thread, doc, nil
+}
+
+func hasAccess(doc *entity.Document, userID int) (bool, error) {
+	if doc.UserID == userID {
+		return true, nil
+	}
+	return repo.DocumentUser.IsMember(doc.ID, userID)
+}
+
+func validateText(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || utf8.RuneCountInString(text) > maxTextLength {
+		return "", ErrInvalidComment
+	}
+	return text, nil
+}
+
+func loadThread(threadID int, documentUUID string) (*ThreadView, error) {
+	thread, err := repo.CommentThread.GetWithComments(threadID)
+	if err != nil {
+		return nil, err
+	}
+	view := toThreadView(thread, documentUUID)
+	return &view, nil
+}
+
+// publish tells the collab room of the document about the change. The change is stored
+// already, so a failure is only logged.
+func publish(documentUUID, messageType string, thread *ThreadView, commentID *int) {
+	if err := collabedit.PDFCollab.PublishCommentEvent(documentUUID, messageType, thread, commentID); err != nil {
+		log.Warnf("failed to publish %s for %s: %v", messageType, documentUUID, err)
+	}
+}
+
+func toThreadView(thread *entity.CommentThread, documentUUID string) ThreadView {
+	view := ThreadView{
+		ID:           thread.ID,
+		DocumentID:   documentUUID,
+		Page:         thread.Page,
+		AnnotationID: thread.AnnotationID,
+		CreatedBy:    toAuthor(thread.CreatedBy),
+		Resolved:     thread.Resolved,
+		ResolvedAt:   thread.ResolvedAt,
+		CreatedAt:    thread.CreatedAt,
+		UpdatedAt:    thread.UpdatedAt,
+		Comments:     make([]CommentView, 0, len(thread.Comments)),
+	}
+	if thread.Resolved && thread.ResolvedBy != nil {
+		author := toAuthor(*thread.ResolvedBy)
+		view.ResolvedBy = &author
+	}
+	for _, comment := range thread.Comments {
+		view.Comments = append(view.Comments, CommentView{
+			ID:        comment.ID,
+			ThreadID:  comment.ThreadID,
+			Author:    toAuthor(comment.User),
+			Text:      comment.Text,
+			CreatedAt: comment.CreatedAt,
+			UpdatedAt: comment.UpdatedAt,
+		})
+	}
+	return view
+}
+
+func toAuthor(user entity.User) Author {
+	return Author{
+		UserID:   user.ID,
+		Username: user.Username,
+	}
+}
@@ -0,0 +1,92 @@
+package comment
+
+import (
+	"errors"
+	"testing"
+
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+
+	"github.com/google/uuid"
+)
+
+// newTestDocument stores a document of a new user with one annotation on page 2.
+func newTestDocument(t *testing.T) (*entity.Document, *entity.Annotation) {
+	t.Helper()
+
+	user := &entity.User{Username: "comment-" + uuid.NewString(), Password: "x"}
+	if err := repo.User.Save(user); err != nil {
+		t.Fatal(err)
+	}
+	file := &entity.FileDocument{UUID: uuid.NewString(), Path: uuid.NewString() + ".pdf", Pages: 3}
+	if err := repo.FileDocument.Save(file); err != nil {
+		t.Fatal(err)
+	}
+	doc := &entity.Document{UUID: uuid.NewString(), Name: "test", UserID: user.ID, FileUUID: file.UUID}
+	if err := repo.Document.Save(doc); err != nil {
+		t.Fatal(err)
+	}
+	annotation := &entity.Annotation{Type: entity.Note, Page: 2, DocumentID: doc.ID}
+	if err := repo.Annotation.Save(annotation); err != nil {
+		t.Fatal(err)
+	}
+	return doc, annotation
+}
+
+func TestCreateThreadValidatesAnchor(t *testing.T) {
+	doc, annotation := newTestDocument(t)
+	_, foreign := newTestDocument(t)
+
+	tests := []struct {
+		name         string
+		page         int64
+		annotationID int
+		err          error
+	}{
+		{"annotation of the document", 2, annotation.ID, nil},
+		{"other page", 1, annotation.ID, ErrInvalidAnchor},
+		{"annotation of another document", 2, foreign.ID, ErrInvalidAnchor},
+		{"unknown annotation", 2, foreign.ID + 1000, ErrInvalidAnchor},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			annotationID := test.annotationID
+			_, err := CreateThread(doc.UUID, doc.UserID, test.page, &annotationID, "anchored")
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestDeleteLastCommentRemovesThread(t *testing.T) {
+	doc, _ := newTestDocument(t)
+
+	thread, err := CreateThread(doc.UUID, doc.UserID, 1, nil, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	thread, err = Reply(thread.ID, doc.UserID, "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	view, err := DeleteComment(thread.Comments[0].ID, doc.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if view == nil || len(view.Comments) != 1 {
+		t.Fatalf("thread after deleting one of two comments: %+v", view)
+	}
+
+	view, err = DeleteComment(thread.Comments[1].ID, doc.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if view != nil {
+		t.Fatalf("thread kept after its last comment: %+v", view)
+	}
+	if _, err := repo.CommentThread.Get(thread.ID); err == nil {
+		t.Fatal("thread still stored")
+	}
+}
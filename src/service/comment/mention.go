@@ -0,0 +1,80 @@
+package comment
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+)
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.-]+)`)
+
+type mentionActionData struct {
+	DocumentID string `json:"documentId"`
+	ThreadID   int    `json:"threadId"`
+	CommentID  int    `json:"commentId"`
+	Page       int64  `json:"page"`
+}
+
+// parseMentions returns the usernames mentioned as @username, each once.
+func parseMentions(text string) []string {
+	seen := make(map[string]struct{})
+	var names []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		if _, ok := seen[match[1]]; ok {
+			continue
+		}
+		seen[match[1]] = struct{}{}
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// notifyMentions creates a notification for every user mentioned in the comment. Users
+// without access to the document and the author are skipped, a mention must not reveal
+// the document to someone who cannot open it.
+func notifyMentions(doc *entity.Document, thread *ThreadView, comment *CommentView) {
+	names := parseMentions(comment.Text)
+	if len(names) == 0 {
+		return
+	}
+
+	actionData, err := json.Marshal(mentionActionData{
+		DocumentID: doc.UUID,
+		ThreadID:   thread.ID,
+		CommentID:  comment.ID,
+		Page:       thread.Page,
+	})
+	if err != nil {
+		log.Errorf("failed to encode mention of comment %d: %v", comment.ID, err)
+		return
+	}
+
+	for _, name := range names {
+		user, err := repo.User.GetUserByName(name)
+		if err != nil || user == nil || user.ID == 0 || user.ID == comment.Author.UserID {
+			continue
+		}
+		ok, err := hasAccess(doc, user.ID)
+		if err != nil {
+			log.Warnf("failed to check access of %s to %s: %v", name, doc.UUID, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		notification := &entity.Notification{
+			Title:      "You were mentioned in a comment",
+			Text:       fmt.Sprintf("%s mentioned you on page %d of %s", comment.Author.Username, thread.Page, doc.Name),
+			Action:     entity.Mention,
+			ActionData: string(actionData),
+			UserID:     user.ID,
+		}
+		if err := repo.Notification.Save(notification); err != nil {
+			log.Errorf("failed to notify %s about comment %d: %v", name, comment.ID, err)
+		}
+	}
+}
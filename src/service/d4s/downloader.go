@@ -0,0 +1,32 @@
+package d4s
+
+import (
+	"context"
+	"fmt"
+	"paperlink/db/entity"
+	"paperlink/util"
+	"paperlink_d4s/digi4school"
+	"paperlink_d4s/downloader"
+	"paperlink_d4s/progress"
+	"paperlink_d4s/structs"
+)
+
+// Downloader is the part of the d4s integration the server uses. It runs in-process,
+// cancelling the context stops a running download.
+type Downloader interface {
+	TestLogin(ctx context.Context, username, password string) error
+	ListBooks(ctx context.Context, username, password string) ([]structs.Book, error)
+	Metadata(ctx context.Context, username, password string, ids []string) ([]downloader.Metadata, error)
+	Download(ctx context.Context, username, password string, targets map[string]string, sink progress.Sink) error
+}
+
+var integration Downloader = digi4school.New(downloader.OptionsFromEnv())
+
+// accountPassword decrypts the stored password of the account.
+func accountPassword(acc *entity.Digi4SchoolAccount) (string, error) {
+	password, err := util.DecryptString(acc.Password)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt password of account %s: %w", acc.Username, err)
+	}
+	return password, nil
+}
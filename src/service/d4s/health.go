@@ -0,0 +1,67 @@
+package d4s
+
+import (
+	"fmt"
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+	"paperlink/service/task"
+	"paperlink/util"
+	"time"
+)
+
+// StartHealthChecks checks the login of every account in the background, every
+// PAPERLINK_D4S_HEALTH_INTERVAL (default 6h). A value of 0 disables the checks.
+func StartHealthChecks() {
+	interval := util.EnvDuration("PAPERLINK_D4S_HEALTH_INTERVAL", 6*time.Hour)
+	if interval <= 0 {
+		log.Info("digi4school account health checks are disabled")
+		return
+	}
+	go func() {
+		for {
+			CheckAccounts()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// CheckAccounts checks the login of every account and stores the status.
+func CheckAccounts() {
+	accounts, err := repo.Digi4SchoolAccount.GetList()
+	if err != nil {
+		log.Errorf("failed to list accounts for health check: %v", err)
+		return
+	}
+	for i := range accounts {
+		status := RecordLoginStatus(&accounts[i])
+		if status != entity.AccountStatusOK {
+			log.Warnf("digi4school account %s is unhealthy: %s", accounts[i].Username, status)
+		}
+	}
+}
+
+// RecordLoginStatus checks the login of the account and persists the outcome.
+func RecordLoginStatus(acc *entity.Digi4SchoolAccount) entity.Digi4SchoolAccountStatus {
+	status := CheckLogin(acc)
+	now := time.Now().Unix()
+	if err := repo.Digi4SchoolAccount.UpdateStatus(acc.ID, status, now); err != nil {
+		log.Errorf("failed to store status of account %s: %v", acc.Username, err)
+	}
+	acc.Status = status
+	acc.LastCheckedAt = now
+	return status
+}
+
+// healthyAccounts drops the accounts whose last check found bad credentials or a lock,
+// a sync with them would only fail again or lock the account for longer.
+func healthyAccounts(l *task.TaskRunner, accs []entity.Digi4SchoolAccount) []entity.Digi4SchoolAccount {
+	healthy := make([]entity.Digi4SchoolAccount, 0, len(accs))
+	for _, acc := range accs {
+		if !acc.Healthy() {
+			l.Warn(fmt.Sprintf("Skip account %s, its status is %s", acc.Username, acc.Status))
+			continue
+		}
+		healthy = append(healthy, acc)
+	}
+	return healthy
+}
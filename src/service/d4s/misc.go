@@ -2,15 +2,34 @@ package d4s
 
 import (
 	"paperlink/db/entity"
+	"paperlink/db/repo"
 	"paperlink/util"
+
+	"github.com/google/uuid"
 )
 
 type Book struct {
-	Name     string                     `json:"name"`
-	DataCode string                     `json:"dataCode"`
-	DataId   string                     `json:"dataId"`
-	UUID     string                     `json:"-"`
+	Name     string `json:"name"`
+	DataCode string `json:"dataCode"`
+	DataId   string `json:"dataId"`
+	UUID     string `json:"-"`
+	// FileUUID is the file the book is downloaded to. It differs from UUID when an
+	// updated edition replaces an earlier download.
+	FileUUID string                     `json:"-"`
 	Account  *entity.Digi4SchoolAccount `json:"-"`
 }
 
 var log = util.GroupLog("SERVICE_DIGI4SCHOOL")
+
+// bookNamespace is the namespace the book UUIDs are derived in.
+var bookNamespace = uuid.MustParse("6f0c5a3e-9a41-4c7e-8d0b-2f3a8c1d4e57")
+
+// bookUUID returns the UUID of the book with the given D4S id. Books that are already
+// known keep the UUID of their row, new books get one derived from the id, so every
+// sync run targets the same file in data/d4s.
+func bookUUID(dataID string) string {
+	if book := repo.Digi4SchoolBook.GetByBookID(dataID); book != nil {
+		return book.UUID
+	}
+	return uuid.NewSHA1(bookNamespace, []byte(dataID)).String()
+}
@@ -0,0 +1,136 @@
+package d4s
+
+import (
+	"fmt"
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+	"paperlink/service/task"
+	"paperlink_d4s/progress"
+	"sync"
+	"time"
+)
+
+type BookProgressStatus string
+
+const (
+	BookDownloading BookProgressStatus = "DOWNLOADING"
+	BookFinished    BookProgressStatus = "FINISHED"
+	BookFailed      BookProgressStatus = "FAILED"
+)
+
+type BookProgress struct {
+	BookID string             `json:"bookId"`
+	Name   string             `json:"name"`
+	Status BookProgressStatus `json:"status"`
+	Page   int                `json:"page"`
+	// Total is 0 if the publisher does not report the page count up front.
+	Total     int    `json:"total"`
+	Error     string `json:"error,omitempty"`
+	StartedAt int64  `json:"startedAt"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+// SyncDetails is published as task details of a sync task.
+type SyncDetails struct {
+	Books []BookProgress `json:"books"`
+}
+
+type syncProgress struct {
+	mu     sync.Mutex
+	runner *task.TaskRunner
+	books  []*BookProgress
+	byID   map[string]*BookProgress
+	// done counts the finished and failed books for the task progress.
+	done int
+}
+
+func newSyncProgress(runner *task.TaskRunner, total int) *syncProgress {
+	runner.SetStage("Downloading books", total)
+	return &syncProgress{
+		runner: runner,
+		byID:   make(map[string]*BookProgress),
+	}
+}
+
+// handleEvent consumes one progress event of the downloader. It is called from the
+// download workers, so it may run concurrently.
+func (p *syncProgress) handleEvent(event progress.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now().Unix()
+	book := p.byID[event.BookID]
+
+	switch event.Type {
+	case progress.BookStarted:
+		book = &BookProgress{
+			BookID:    event.BookID,
+			Name:      event.Name,
+			Status:    BookDownloading,
+			StartedAt: now,
+		}
+		p.byID[event.BookID] = book
+		p.books = append(p.books, book)
+		p.runner.Info(fmt.Sprintf("Downloading book: %s", event.Name))
+		p.setBookState(event.BookID, entity.BookDownloading, "")
+	case progress.PageDownloaded:
+		if book == nil {
+			return
+		}
+		book.Page = event.Page
+		book.Total = event.Total
+	case progress.BookFinished:
+		if book == nil {
+			return
+		}
+		book.Status = BookFinished
+		if book.Total == 0 {
+			book.Total = book.Page
+		}
+		p.done++
+		p.runner.SetProgress(p.done, 0)
+		p.runner.Info(fmt.Sprintf("Finished book %s with %d pages (%s)", book.Name, book.Page,
+			time.Duration(now-book.StartedAt)*time.Second))
+	case progress.Warning:
+		p.runner.Warn(p.prefix(book) + event.Message)
+	case progress.Fatal:
+		if book != nil {
+			book.Status = BookFailed
+			book.Error = event.Message
+			p.setBookState(event.BookID, entity.BookFailed, event.Message)
+			p.done++
+			p.runner.SetProgress(p.done, 0)
+		}
+		p.runner.Err(p.prefix(book) + event.Message)
+	default:
+		return
+	}
+
+	if book != nil {
+		book.UpdatedAt = now
+	}
+	p.publishLocked()
+}
+
+// setBookState mirrors the download state to the book row. DONE is only set by the
+// rescan once the file is stored.
+func (p *syncProgress) setBookState(bookID string, state entity.Digi4SchoolBookState, errMsg string) {
+	if err := repo.Digi4SchoolBook.SetState(bookID, state, errMsg); err != nil {
+		p.runner.Err(fmt.Sprintf("failed to update state of book %s: %v", bookID, err))
+	}
+}
+
+func (p *syncProgress) prefix(book *BookProgress) string {
+	if book == nil {
+		return ""
+	}
+	return book.Name + ": "
+}
+
+func (p *syncProgress) publishLocked() {
+	details := SyncDetails{Books: make([]BookProgress, 0, len(p.books))}
+	for _, book := range p.books {
+		details.Books = append(details.Books, *book)
+	}
+	p.runner.SetDetails(details)
+}
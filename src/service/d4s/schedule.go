@@ -0,0 +1,140 @@
+package d4s
+
+import (
+	"errors"
+	"fmt"
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+	"paperlink/service/task"
+	"paperlink/util"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SettingSyncCron holds the cron expression of the automatic sync. Empty disables it.
+	SettingSyncCron = "d4s.sync.cron"
+	// SettingSyncAccounts holds "all" or a comma separated list of account ids.
+	SettingSyncAccounts = "d4s.sync.accounts"
+
+	settingLastRunAt      = "d4s.sync.last_run_at"
+	settingLastTaskID     = "d4s.sync.last_task_id"
+	settingLastStatus     = "d4s.sync.last_status"
+	settingLastNewBooks   = "d4s.sync.last_new_books"
+	settingLastNewBooksAt = "d4s.sync.last_new_books_at"
+)
+
+var ErrInvalidAccountSelection = errors.New("invalid account selection")
+
+type SyncOutcome struct {
+	LastRunAt      int64             `json:"lastRunAt"`
+	LastTaskID     string            `json:"lastTaskId"`
+	LastStatus     entity.TaskStatus `json:"lastStatus"`
+	LastNewBooks   int64             `json:"lastNewBooks"`
+	LastNewBooksAt int64             `json:"lastNewBooksAt"`
+}
+
+// StartScheduler checks the sync schedule at the start of every minute.
+func StartScheduler() {
+	go func() {
+		for {
+			next := time.Now().Truncate(time.Minute).Add(time.Minute)
+			time.Sleep(time.Until(next))
+			runScheduledSync(next)
+		}
+	}()
+}
+
+func runScheduledSync(now time.Time) {
+	expr := repo.Setting.GetString(SettingSyncCron, "")
+	if expr == "" {
+		return
+	}
+
+	schedule, err := util.ParseCron(expr)
+	if err != nil {
+		log.Warnf("invalid sync schedule %q: %v", expr, err)
+		return
+	}
+	if !schedule.Matches(now) {
+		return
+	}
+
+	accounts, err := AccountsForSelection(repo.Setting.GetString(SettingSyncAccounts, "all"))
+	if err != nil {
+		log.Errorf("failed to resolve accounts for scheduled sync: %v", err)
+		return
+	}
+
+	// Scheduled syncs make way for downloads an admin started by hand.
+	id, err := startSyncTask(accounts, task.PriorityLow)
+	if errors.Is(err, ErrSyncRunning) {
+		log.Warn("skipping scheduled sync, the previous sync is still queued or running")
+		return
+	}
+	if err != nil {
+		log.Errorf("failed to start scheduled sync: %v", err)
+		return
+	}
+	log.Infof("queued scheduled sync %s for %d accounts", id, len(accounts))
+}
+
+// AccountsForSelection resolves "all" or a comma separated list of account ids.
+func AccountsForSelection(selection string) ([]entity.Digi4SchoolAccount, error) {
+	selection = strings.TrimSpace(selection)
+	if selection == "all" {
+		return repo.Digi4SchoolAccount.GetList()
+	}
+
+	idStrs := strings.Split(selection, ",")
+	ids := make([]any, 0, len(idStrs))
+	for _, s := range idStrs {
+		id, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidAccountSelection, s)
+		}
+		ids = append(ids, id)
+	}
+	return repo.Digi4SchoolAccount.GetByIDs(ids)
+}
+
+func recordSyncOutcome(l *task.TaskRunner, control *syncControl, booksBefore int64) {
+	status := l.Status()
+	if control.IsStopRequested() {
+		status = entity.STOPPED
+	}
+
+	booksAfter, err := repo.Digi4SchoolBook.CountDownloaded()
+	if err != nil {
+		log.Errorf("failed to count books after sync: %v", err)
+		booksAfter = booksBefore
+	}
+	newBooks := booksAfter - booksBefore
+	now := time.Now().Unix()
+
+	values := map[string]string{
+		settingLastRunAt:    strconv.FormatInt(now, 10),
+		settingLastTaskID:   l.Task.ID,
+		settingLastStatus:   string(status),
+		settingLastNewBooks: strconv.FormatInt(newBooks, 10),
+	}
+	if newBooks > 0 {
+		values[settingLastNewBooksAt] = strconv.FormatInt(now, 10)
+	}
+	for key, value := range values {
+		if err := repo.Setting.SetString(key, value); err != nil {
+			log.Errorf("failed to record sync outcome: %v", err)
+		}
+	}
+}
+
+func LastSyncOutcome() SyncOutcome {
+	return SyncOutcome{
+		LastRunAt:      repo.Setting.GetInt64(settingLastRunAt, 0),
+		LastTaskID:     repo.Setting.GetString(settingLastTaskID, ""),
+		LastStatus:     entity.TaskStatus(repo.Setting.GetString(settingLastStatus, "")),
+		LastNewBooks:   repo.Setting.GetInt64(settingLastNewBooks, 0),
+		LastNewBooksAt: repo.Setting.GetInt64(settingLastNewBooksAt, 0),
+	}
+}
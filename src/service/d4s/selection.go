@@ -0,0 +1,145 @@
+package d4s
+
+import (
+	"errors"
+	"fmt"
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+	"paperlink/service/task"
+)
+
+var (
+	ErrBookNotFound    = errors.New("book not found")
+	ErrBookNotFailed   = errors.New("book did not fail")
+	ErrBookDownloaded  = errors.New("book is already downloaded")
+	ErrBookDownloading = errors.New("book is being downloaded")
+	ErrBookNotExcluded = errors.New("book is not excluded")
+)
+
+type AvailableBook struct {
+	BookID string `json:"bookId"`
+	Name   string `json:"name"`
+	// State is empty for books that were never selected for download.
+	State entity.Digi4SchoolBookState `json:"state,omitempty"`
+	Error string                      `json:"error,omitempty"`
+}
+
+type AccountBooks struct {
+	AccountID int             `json:"accountId"`
+	Username  string          `json:"username"`
+	Books     []AvailableBook `json:"books"`
+	// Error is set if the books of the account could not be listed.
+	Error string `json:"error,omitempty"`
+}
+
+// AvailableBooks lists the books of every account that are not downloaded yet.
+func AvailableBooks(accs []entity.Digi4SchoolAccount) ([]AccountBooks, error) {
+	dbBooks, err := repo.Digi4SchoolBook.GetList()
+	if err != nil {
+		return nil, err
+	}
+	dbBooksMap := make(map[string]entity.Digi4SchoolBook)
+	for _, book := range dbBooks {
+		dbBooksMap[book.BookID] = book
+	}
+
+	result := make([]AccountBooks, 0, len(accs))
+	for _, acc := range accs {
+		accountBooks := AccountBooks{AccountID: acc.ID, Username: acc.Username, Books: make([]AvailableBook, 0)}
+		books, err := ListBooksForAccount(&acc)
+		if err != nil {
+			accountBooks.Error = "failed to list books"
+			result = append(result, accountBooks)
+			continue
+		}
+		for _, book := range books {
+			dbBook, ok := dbBooksMap[book.DataId]
+			if ok && dbBook.State == entity.BookDone {
+				continue
+			}
+			available := AvailableBook{BookID: book.DataId, Name: book.Name}
+			if ok {
+				available.State = dbBook.State
+				available.Error = dbBook.Error
+			}
+			accountBooks.Books = append(accountBooks.Books, available)
+		}
+		result = append(result, accountBooks)
+	}
+	return result, nil
+}
+
+// StartBookDownloadTask downloads the selected books of an account. Excluded books are
+// downloaded as well, selecting them explicitly lifts the exclusion.
+func StartBookDownloadTask(acc entity.Digi4SchoolAccount, bookIDs []string) (string, error) {
+	selected := make(map[string]bool, len(bookIDs))
+	for _, id := range bookIDs {
+		selected[id] = true
+	}
+	name := fmt.Sprintf("Digi4School Download (%d books)", len(selected))
+	return startSync(task.Spec{Kind: KindDownload, Name: name, Priority: task.PriorityHigh}, func(l *task.TaskRunner, control *syncControl) {
+		books, ok := listAccountBooks(l, []entity.Digi4SchoolAccount{acc}, control)
+		if !ok {
+			return
+		}
+		downloadSelected(l, books, selected, control)
+	})
+}
+
+// RetryBook downloads a single failed book again. The book is already known, so the
+// account does not have to be listed again.
+func RetryBook(bookID string) (string, error) {
+	dbBook := repo.Digi4SchoolBook.GetByBookID(bookID)
+	if dbBook == nil {
+		return "", ErrBookNotFound
+	}
+	if dbBook.State != entity.BookFailed {
+		return "", ErrBookNotFailed
+	}
+	acc, err := repo.Digi4SchoolAccount.Get(dbBook.AccountID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load account of book %s: %w", bookID, err)
+	}
+
+	book := Book{
+		Name:    dbBook.BookName,
+		DataId:  dbBook.BookID,
+		UUID:    dbBook.UUID,
+		Account: acc,
+	}
+	return startSync(task.Spec{Kind: KindRetry, Name: "Digi4School Retry: " + book.Name, Priority: task.PriorityHigh}, func(l *task.TaskRunner, control *syncControl) {
+		downloadSelected(l, []Book{book}, map[string]bool{book.DataId: true}, control)
+	})
+}
+
+// SetBookExcluded excludes a book of the account from the sync or lifts the exclusion.
+// The name is only used if the book has no row yet.
+func SetBookExcluded(accountID int, bookID, name string, excluded bool) error {
+	dbBook := repo.Digi4SchoolBook.GetByBookID(bookID)
+	if !excluded {
+		if dbBook == nil || dbBook.State != entity.BookExcluded {
+			return ErrBookNotExcluded
+		}
+		return repo.Digi4SchoolBook.SetState(bookID, entity.BookPending, "")
+	}
+
+	if dbBook == nil {
+		if _, err := repo.Digi4SchoolAccount.Get(accountID); err != nil {
+			return fmt.Errorf("failed to load account %d: %w", accountID, err)
+		}
+		return repo.Digi4SchoolBook.Save(&entity.Digi4SchoolBook{
+			UUID:      bookUUID(bookID),
+			BookName:  name,
+			BookID:    bookID,
+			AccountID: accountID,
+			State:     entity.BookExcluded,
+		})
+	}
+	switch dbBook.State {
+	case entity.BookDone:
+		return ErrBookDownloaded
+	case entity.BookDownloading:
+		return ErrBookDownloading
+	}
+	return repo.Digi4SchoolBook.SetState(bookID, entity.BookExcluded, "")
+}
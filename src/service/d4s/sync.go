@@ -1,13 +1,11 @@
 package d4s
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-
-	"github.com/google/uuid"
 	"os"
-	"os/exec"
 	"paperlink/db/entity"
 	"paperlink/db/repo"
 	"paperlink/ptf"
@@ -16,38 +14,143 @@ import (
 	"paperlink/util"
 	"path/filepath"
 	"slices"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+var ErrSyncRunning = errors.New("a digi4school sync is already queued or running")
+
+// Task kinds of the d4s service. Only full syncs are resumed after a restart, the
+// books of an interrupted download or retry are picked up by the next sync.
+const (
+	KindSync     = "d4s.sync"
+	KindDownload = "d4s.download"
+	KindRetry    = "d4s.retry"
+)
+
+// syncParams are stored with a sync task so it can be resumed.
+type syncParams struct {
+	AccountIDs []int `json:"accountIds"`
+}
+
+// syncGroup is the concurrency group of every d4s task. Syncs, selected downloads and
+// retries share the data dir, so only one of them runs at a time.
+const syncGroup = "d4s"
+
+// startSyncMu makes checking for an active sync and queueing a new one atomic.
+var startSyncMu sync.Mutex
+
+// StartSyncTask queues a sync of the given accounts. Only one sync can be queued or
+// running at a time, ErrSyncRunning is returned otherwise.
 func StartSyncTask(accs []entity.Digi4SchoolAccount) (string, error) {
-	control := &syncControl{}
-	l, err := task.CreateNewTask("Digi4School Sync", control.Stop)
+	return startSyncTask(accs, task.PriorityNormal)
+}
+
+func startSyncTask(accs []entity.Digi4SchoolAccount, priority int) (string, error) {
+	startSyncMu.Lock()
+	defer startSyncMu.Unlock()
+	if task.HasActive(KindSync) {
+		return "", ErrSyncRunning
+	}
+
+	params := syncParams{AccountIDs: make([]int, 0, len(accs))}
+	for _, acc := range accs {
+		params.AccountIDs = append(params.AccountIDs, acc.ID)
+	}
+	spec := task.Spec{Kind: KindSync, Name: "Digi4School Sync", Params: params, Priority: priority}
+	return startSync(spec, func(l *task.TaskRunner, control *syncControl) {
+		booksBefore, err := repo.Digi4SchoolBook.CountDownloaded()
+		if err != nil {
+			l.Err(fmt.Sprintf("Failed to count downloaded books: %s", err.Error()))
+		}
+		syncAccounts(l, accs, control)
+		recordSyncOutcome(l, control, booksBefore)
+	})
+}
+
+// RegisterTaskKinds limits the d4s tasks to one at a time and lets syncs interrupted by
+// a restart start again.
+func RegisterTaskKinds() {
+	task.SetConcurrency(syncGroup, 1)
+	task.RegisterResumable(KindSync, resumeSync)
+}
+
+func resumeSync(raw string) (string, error) {
+	var params syncParams
+	if err := json.Unmarshal([]byte(raw), &params); err != nil {
+		return "", fmt.Errorf("invalid sync params: %w", err)
+	}
+	ids := make([]any, 0, len(params.AccountIDs))
+	for _, id := range params.AccountIDs {
+		ids = append(ids, id)
+	}
+	accs, err := repo.Digi4SchoolAccount.GetByIDs(ids)
+	if err != nil {
+		return "", fmt.Errorf("failed to load accounts: %w", err)
+	}
+	return StartSyncTask(accs)
+}
+
+// startSync queues a task that downloads books in the d4s group.
+func startSync(spec task.Spec, run func(l *task.TaskRunner, control *syncControl)) (string, error) {
+	spec.Group = syncGroup
+	control := newSyncControl()
+	l, err := task.Enqueue(spec, func(l *task.TaskRunner) {
+		defer control.cancel()
+		run(l, control)
+	}, control.Stop)
 	if err != nil {
 		return "", err
 	}
-	go syncAccounts(l, accs, control)
 	return l.Task.ID, nil
 }
 
+// RecoverInterruptedBooks resets books that were still downloading when the server
+// stopped. Their downloads resume from the work dir on the next sync.
+func RecoverInterruptedBooks() {
+	if err := repo.Digi4SchoolBook.ResetInterrupted(); err != nil {
+		log.Errorf("failed to reset interrupted books: %v", err)
+	}
+}
+
 func syncAccounts(l *task.TaskRunner, accs []entity.Digi4SchoolAccount, control *syncControl) {
 	l.Info(fmt.Sprintf("Sync %d accounts", len(accs)))
+	accountBooks, ok := listAccountBooks(l, accs, control)
+	if !ok {
+		return
+	}
+	checkForUpdates(l, accountBooks, control)
+	downloadSelected(l, accountBooks, nil, control)
+}
+
+func listAccountBooks(l *task.TaskRunner, accs []entity.Digi4SchoolAccount, control *syncControl) ([]Book, bool) {
 	accountBooks := make([]Book, 0)
-	for _, acc := range accs {
+	healthy := healthyAccounts(l, accs)
+	l.SetStage("Listing books", len(healthy))
+	for i, acc := range healthy {
 		if !l.IsRunning() || control.IsStopRequested() {
 			l.Warn("task stopped by user")
-			return
+			return nil, false
 		}
 		l.Info(fmt.Sprintf("Search books for account: %s", acc.Username))
 		books, err := ListBooksForAccount(&acc)
 		if err != nil {
-			l.Err(fmt.Sprintf("Failed to list books for account: %s", acc.Username))
+			// Find out why, so the account is skipped next time if the credentials broke.
+			status := RecordLoginStatus(&acc)
+			l.Err(fmt.Sprintf("Failed to list books for account: %s (status %s)", acc.Username, status))
 		}
 		l.Info(fmt.Sprintf("Found %d books for account: %s", len(books), acc.Username))
 		accountBooks = append(accountBooks, books...)
+		l.SetProgress(i+1, 0)
 	}
+	return accountBooks, true
+}
+
+// downloadSelected downloads the books that are not done yet and finishes the task.
+// If selected is nil every book is downloaded except the excluded ones, otherwise only
+// the selected ids are, even if they were excluded.
+func downloadSelected(l *task.TaskRunner, accountBooks []Book, selected map[string]bool, control *syncControl) {
 	dbBooks, err := repo.Digi4SchoolBook.GetList()
 	if err != nil {
 		l.Critical(fmt.Sprintf("Failed to list books for account: %s", err.Error()))
@@ -57,7 +160,15 @@ func syncAccounts(l *task.TaskRunner, accs []entity.Digi4SchoolAccount, control
 		}
 		return
 	}
-	l.Info(fmt.Sprintf("Found %d Books in %d accounts. %d Books are already in the db", len(accountBooks), len(accs), len(dbBooks)))
+	dbBooksMap := make(map[string]entity.Digi4SchoolBook)
+	doneBooks := 0
+	for _, book := range dbBooks {
+		dbBooksMap[book.BookID] = book
+		if book.State == entity.BookDone {
+			doneBooks++
+		}
+	}
+	l.Info(fmt.Sprintf("Found %d Books. %d Books are already in the db", len(accountBooks), doneBooks))
 	unqiueAccountBooksMap := make(map[string]Book)
 	for _, book := range accountBooks {
 		unqiueAccountBooksMap[book.DataId] = book
@@ -66,18 +177,34 @@ func syncAccounts(l *task.TaskRunner, accs []entity.Digi4SchoolAccount, control
 	for _, book := range unqiueAccountBooksMap {
 		uniqueAccountBooks = append(uniqueAccountBooks, book)
 	}
-	dbBooksMap := make(map[string]entity.Digi4SchoolBook)
-	for _, book := range dbBooks {
-		dbBooksMap[book.BookID] = book
-	}
 	neededBooks := make([]Book, 0)
 	for _, book := range uniqueAccountBooks {
-		if _, ok := dbBooksMap[book.DataId]; !ok {
-			neededBooks = append(neededBooks, book)
+		if selected != nil && !selected[book.DataId] {
+			continue
+		}
+		dbBook, ok := dbBooksMap[book.DataId]
+		if ok && dbBook.State == entity.BookDone {
+			continue
+		}
+		if ok && dbBook.State == entity.BookExcluded && selected == nil {
+			continue
 		}
+		book.FileUUID = fileUUIDFor(book, dbBook)
+		if err := markBookPending(book, dbBook.ID); err != nil {
+			l.Err(fmt.Sprintf("Failed to store book %s: %s", book.Name, err.Error()))
+			continue
+		}
+		neededBooks = append(neededBooks, book)
+	}
+	if selected != nil && len(neededBooks) < len(selected) {
+		l.Warn(fmt.Sprintf("%d of the selected books are not available or already downloaded", len(selected)-len(neededBooks)))
 	}
 	l.Info(fmt.Sprintf("Found %d needed books. Start downloading", len(neededBooks)))
 	err = downloadBooks(l, neededBooks, control)
+	// Books the downloader did not finish are picked up again by the next sync.
+	if resetErr := repo.Digi4SchoolBook.ResetInterrupted(); resetErr != nil {
+		l.Err(fmt.Sprintf("Failed to reset interrupted books: %s", resetErr.Error()))
+	}
 	if control.IsStopRequested() {
 		l.Warn("sync task stopped by user")
 		return
@@ -94,6 +221,7 @@ func syncAccounts(l *task.TaskRunner, accs []entity.Digi4SchoolAccount, control
 		log.Error("Failed to complete the sync task")
 	}
 }
+
 func downloadBooks(l *task.TaskRunner, books []Book, control *syncControl) error {
 	copyBooks := slices.Clone(books)
 	wd, err := os.Getwd()
@@ -108,6 +236,15 @@ func downloadBooks(l *task.TaskRunner, books []Book, control *syncControl) error
 		}
 	}
 	control.SetRescanContext(baseDir, copyBooks)
+	// Files finished by an earlier, aborted run only have to be inserted.
+	if err := rescanForDBInsert(baseDir, copyBooks); err != nil {
+		l.Err(fmt.Sprintf("Failed to rescan for books: %s", err.Error()))
+	}
+	books = slices.DeleteFunc(books, func(book Book) bool {
+		dbBook := repo.Digi4SchoolBook.GetByBookID(book.DataId)
+		return dbBook != nil && dbBook.State == entity.BookDone
+	})
+	progress := newSyncProgress(l, len(books))
 	for len(books) > 0 {
 		if !l.IsRunning() || control.IsStopRequested() {
 			return nil
@@ -127,72 +264,27 @@ func downloadBooks(l *task.TaskRunner, books []Book, control *syncControl) error
 			break
 		}
 		l.Info(fmt.Sprintf("Download %d books for account %s", len(sameAccountBooks), sameAccountBooks[0].Account.Username))
-		var downloadIdString strings.Builder
+		targets := make(map[string]string, len(sameAccountBooks))
 		for _, book := range sameAccountBooks {
-			if downloadIdString.Len() > 0 {
-				downloadIdString.WriteString(",")
-			}
-			downloadIdString.WriteString(book.DataId)
-			downloadIdString.WriteString("=")
-			downloadIdString.WriteString(filepath.Join(baseDir, book.UUID+".pvf"))
+			targets[book.DataId] = filepath.Join(baseDir, book.FileUUID+".pvf")
 		}
 		acc := sameAccountBooks[0].Account
-		cmd := exec.Command("./integrations/d4s", "download", downloadIdString.String(), acc.Username, acc.Password)
-		control.SetCurrentCmd(cmd)
-		stdout, _ := cmd.StdoutPipe()
-		stderr, _ := cmd.StderrPipe()
-		if err := cmd.Start(); err != nil {
-			control.ClearCurrentCmd(cmd)
-			return fmt.Errorf("failed to start downloader command: %w", err)
+		password, err := accountPassword(acc)
+		if err != nil {
+			l.Err(err.Error())
+			continue
 		}
-		go func() {
-			scanner := bufio.NewScanner(stdout)
-			lastText := ""
-			start := time.Now()
-			var lastPageTime time.Time
-			var lastPage int
-
-			for scanner.Scan() {
-				t := scanner.Text()
-				if strings.Contains(t, "PAGE_COUNT") && strings.Contains(lastText, "PAGE_COUNT") {
-					parts := strings.Split(t, ": ")
-					page, _ := strconv.Atoi(parts[1])
-					now := time.Now()
-
-					if lastPageTime.IsZero() {
-						lastPageTime = now
-					}
-
-					elapsed := now.Sub(start)
-					pagesSinceLast := page - lastPage
-					secondsSinceLast := now.Sub(lastPageTime).Seconds()
-					avgPerPage := elapsed.Seconds() / float64(page)
-					pagesPerSecond := float64(pagesSinceLast) / secondsSinceLast
-
-					l.ReplaceLastInfo(fmt.Sprintf(
-						"Downloaded %d Pages | Avg time/page: %.2fs | Pages/sec: %.2f | Total elapsed: %s",
-						page, avgPerPage, pagesPerSecond, elapsed.Truncate(1*time.Second),
-					))
-
-					lastPage = page
-					lastPageTime = now
-				} else {
-					l.Info(t)
-				}
-				lastText = t
-			}
-		}()
-
-		go func() {
-			scanner := bufio.NewScanner(stderr)
-			for scanner.Scan() {
-				l.Err(fmt.Sprintf("Error occoured while downloading book: %s", scanner.Text()))
-			}
-		}()
 
+		rescanDone := make(chan struct{})
 		go func() {
+			ticker := time.NewTicker(180 * time.Second)
+			defer ticker.Stop()
 			for {
-				time.Sleep(180 * time.Second)
+				select {
+				case <-rescanDone:
+					return
+				case <-ticker.C:
+				}
 				if !l.IsRunning() || control.IsStopRequested() {
 					return
 				}
@@ -203,12 +295,12 @@ func downloadBooks(l *task.TaskRunner, books []Book, control *syncControl) error
 			}
 		}()
 
-		waitErr := cmd.Wait()
-		control.ClearCurrentCmd(cmd)
-		if waitErr != nil && !control.IsStopRequested() {
-			l.Err(fmt.Sprintf("Downloader process exited with error: %v", waitErr))
+		downloadErr := integration.Download(control.Context(), acc.Username, password, targets, progress.handleEvent)
+		close(rescanDone)
+		if downloadErr != nil && !control.IsStopRequested() {
+			l.Err(fmt.Sprintf("Downloader finished with error: %v", downloadErr))
 		}
-		err := rescanForDBInsert(baseDir, copyBooks)
+		err = rescanForDBInsert(baseDir, copyBooks)
 		if err != nil {
 			l.Err(fmt.Sprintf("Failed to rescan for books: %s", err.Error()))
 		}
@@ -221,24 +313,21 @@ func downloadBooks(l *task.TaskRunner, books []Book, control *syncControl) error
 
 type syncControl struct {
 	mu            sync.Mutex
-	currentCmd    *exec.Cmd
+	ctx           context.Context
+	cancel        context.CancelFunc
 	stopRequested bool
 	rescanBaseDir string
 	rescanBooks   []Book
 }
 
-func (s *syncControl) SetCurrentCmd(cmd *exec.Cmd) {
-	s.mu.Lock()
-	s.currentCmd = cmd
-	s.mu.Unlock()
+func newSyncControl() *syncControl {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &syncControl{ctx: ctx, cancel: cancel}
 }
 
-func (s *syncControl) ClearCurrentCmd(cmd *exec.Cmd) {
-	s.mu.Lock()
-	if s.currentCmd == cmd {
-		s.currentCmd = nil
-	}
-	s.mu.Unlock()
+// Context is cancelled once the task is stopped, which aborts the running download.
+func (s *syncControl) Context() context.Context {
+	return s.ctx
 }
 
 func (s *syncControl) SetRescanContext(baseDir string, books []Book) {
@@ -257,17 +346,12 @@ func (s *syncControl) IsStopRequested() bool {
 func (s *syncControl) Stop(l *task.TaskRunner) error {
 	s.mu.Lock()
 	s.stopRequested = true
-	cmd := s.currentCmd
 	baseDir := s.rescanBaseDir
 	books := slices.Clone(s.rescanBooks)
 	s.mu.Unlock()
 
-	if cmd != nil && cmd.Process != nil {
-		l.Warn("stopping digi4school downloader process")
-		if err := cmd.Process.Kill(); err != nil {
-			l.Err(fmt.Sprintf("failed to kill downloader process: %v", err))
-		}
-	}
+	l.Warn("stopping digi4school downloader")
+	s.cancel()
 
 	if baseDir != "" && len(books) > 0 {
 		l.Info("running final rescan before stopping")
@@ -275,6 +359,9 @@ func (s *syncControl) Stop(l *task.TaskRunner) error {
 			l.Err(fmt.Sprintf("final rescan failed: %v", err))
 		}
 	}
+	if err := repo.Digi4SchoolBook.ResetInterrupted(); err != nil {
+		l.Err(fmt.Sprintf("failed to reset interrupted books: %v", err))
+	}
 	return nil
 }
 
@@ -286,10 +373,10 @@ func rescanForDBInsert(dir string, books []Book) error {
 	for _, file := range files {
 		for _, book := range books {
 			// already in db
-			if repo.Digi4SchoolBook.GetByUUID(book.UUID) != nil {
+			if dbBook := repo.Digi4SchoolBook.GetByBookID(book.DataId); dbBook != nil && dbBook.State == entity.BookDone {
 				continue
 			}
-			if file.Name() == book.UUID+".pvf" {
+			if file.Name() == book.FileUUID+".pvf" {
 				fullPath := filepath.Join(dir, file.Name())
 				info, statErr := os.Stat(fullPath)
 				if statErr != nil {
@@ -302,26 +389,20 @@ func rescanForDBInsert(dir string, books []Book) error {
 				}
 
 				fd := entity.FileDocument{
-					UUID:  book.UUID,
+					UUID:  book.FileUUID,
 					Path:  fullPath,
 					Size:  uint64(info.Size()),
 					Pages: metadata.PageCount,
 				}
 				_ = repo.FileDocument.Save(&fd)
 
-				err = repo.Digi4SchoolBook.Save(&entity.Digi4SchoolBook{
-					UUID:      book.UUID,
-					BookName:  book.Name,
-					BookID:    book.DataId,
-					AccountID: book.Account.ID,
-					FileUUID:  book.UUID,
-				})
+				err = markBookDone(book)
 				if err != nil {
 					return fmt.Errorf("failed to save book %s: %v", book.UUID, err)
 				}
 				continue
 			}
-			if file.Name() == book.UUID+".pdf" {
+			if file.Name() == book.FileUUID+".pdf" {
 				fullPath := filepath.Join(dir, file.Name())
 				viewPVFFile, err := pvf.WritePVFFromPDF(fullPath)
 				if err != nil {
@@ -356,20 +437,14 @@ func rescanForDBInsert(dir string, books []Book) error {
 				}
 
 				fd := entity.FileDocument{
-					UUID:  book.UUID,
+					UUID:  book.FileUUID,
 					Path:  viewDst,
 					Size:  uint64(info.Size()),
 					Pages: metadata.PageCount,
 				}
 				_ = repo.FileDocument.Save(&fd)
 
-				err = repo.Digi4SchoolBook.Save(&entity.Digi4SchoolBook{
-					UUID:      book.UUID,
-					BookName:  book.Name,
-					BookID:    book.DataId,
-					AccountID: book.Account.ID,
-					FileUUID:  book.UUID,
-				})
+				err = markBookDone(book)
 				if err != nil {
 					return fmt.Errorf("failed to save book %s: %v", book.UUID, err)
 				}
@@ -379,24 +454,73 @@ func rescanForDBInsert(dir string, books []Book) error {
 
 	return nil
 }
+
+// fileUUIDFor returns the file a book is downloaded to. An updated edition gets a new
+// file so the current one stays in use until the download is done.
+func fileUUIDFor(book Book, dbBook entity.Digi4SchoolBook) string {
+	if dbBook.UpdateFileUUID != "" {
+		return dbBook.UpdateFileUUID
+	}
+	return book.UUID
+}
+
+// markBookPending creates or resets the row of a book that is about to be downloaded.
+func markBookPending(book Book, id int) error {
+	if id == 0 {
+		return repo.Digi4SchoolBook.Save(&entity.Digi4SchoolBook{
+			UUID:      book.UUID,
+			BookName:  book.Name,
+			BookID:    book.DataId,
+			AccountID: book.Account.ID,
+			State:     entity.BookPending,
+		})
+	}
+	return repo.Digi4SchoolBook.SetState(book.DataId, entity.BookPending, "")
+}
+
+func markBookDone(book Book) error {
+	dbBook := repo.Digi4SchoolBook.GetByBookID(book.DataId)
+	if dbBook == nil {
+		dbBook = &entity.Digi4SchoolBook{
+			UUID:      book.UUID,
+			BookID:    book.DataId,
+			AccountID: book.Account.ID,
+		}
+	}
+	if dbBook.FileUUID != nil && *dbBook.FileUUID != book.FileUUID {
+		if err := replaceBookFile(dbBook, book.FileUUID); err != nil {
+			return err
+		}
+	}
+	dbBook.BookName = book.Name
+	dbBook.State = entity.BookDone
+	dbBook.Error = ""
+	dbBook.FileUUID = &book.FileUUID
+	dbBook.UpdateAvailable = false
+	dbBook.UpdateFileUUID = ""
+	return repo.Digi4SchoolBook.Save(dbBook)
+}
+
 func ListBooksForAccount(acc *entity.Digi4SchoolAccount) ([]Book, error) {
-	cmd := exec.Command("./integrations/d4s", "list", acc.Username, acc.Password)
-	output, err := cmd.CombinedOutput()
+	password, err := accountPassword(acc)
 	if err != nil {
-		log.Printf("failed to execute list for user %s: %v, output: %s", acc.Username, err, string(output))
 		return nil, err
 	}
-
-	outStr := string(output)
-	outStr = strings.TrimSpace(outStr)
-	var books []Book
-	if err := json.Unmarshal([]byte(outStr), &books); err != nil {
-		log.Printf("failed to unmarshal list for user %s: %v, output: %s", acc.Username, err, string(output))
+	listed, err := integration.ListBooks(context.Background(), acc.Username, password)
+	if err != nil {
+		log.Printf("failed to list books for user %s: %v", acc.Username, err)
 		return nil, err
 	}
-	for i, _ := range books {
-		books[i].Account = acc
-		books[i].UUID = uuid.NewString()
+
+	books := make([]Book, 0, len(listed))
+	for _, b := range listed {
+		books = append(books, Book{
+			Name:     b.Name,
+			DataCode: b.DataCode,
+			DataId:   b.DataId,
+			UUID:     bookUUID(b.DataId),
+			Account:  acc,
+		})
 	}
 	return books, nil
 }
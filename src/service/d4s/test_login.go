@@ -1,28 +1,36 @@
 package d4s
 
 import (
-	"os/exec"
+	"context"
+	"errors"
 	"paperlink/db/entity"
-	"strings"
+	"paperlink_d4s/client"
 )
 
 func TestLogin(acc *entity.Digi4SchoolAccount) bool {
-	cmd := exec.Command("./integrations/d4s", "test-login", acc.Username, acc.Password)
+	return CheckLogin(acc) == entity.AccountStatusOK
+}
 
-	output, err := cmd.CombinedOutput()
+// CheckLogin logs into the account and classifies the outcome.
+func CheckLogin(acc *entity.Digi4SchoolAccount) entity.Digi4SchoolAccountStatus {
+	password, err := accountPassword(acc)
 	if err != nil {
-		log.Printf("failed to execute test-login for user %s: %v, output: %s", acc.Username, err, string(output))
-		return false
+		log.Printf("failed to prepare test-login for user %s: %v", acc.Username, err)
+		return entity.AccountStatusUnknown
 	}
 
-	outStr := string(output)
-	outStr = strings.TrimSpace(outStr)
-	if outStr == "1" {
-		return true
-	} else if outStr == "0" {
-		return false
+	err = integration.TestLogin(context.Background(), acc.Username, password)
+	switch {
+	case err == nil:
+		return entity.AccountStatusOK
+	case errors.Is(err, client.ErrInvalidCredentials):
+		return entity.AccountStatusInvalidCredentials
+	case errors.Is(err, client.ErrLocked):
+		return entity.AccountStatusLocked
+	case errors.Is(err, client.ErrNetwork):
+		return entity.AccountStatusNetworkError
 	}
 
-	log.Printf("unexpected output from test-login for user %s: %q", acc.Username, outStr)
-	return false
+	log.Printf("unexpected error from test-login for user %s: %v", acc.Username, err)
+	return entity.AccountStatusUnknown
 }
@@ -0,0 +1,213 @@
+package d4s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+	"paperlink/service/collabedit"
+	"paperlink/service/task"
+	"paperlink_d4s/downloader"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// checkForUpdates compares the page count of the downloaded books with the one the
+// publisher reports now. Changed books are flagged and queued for download into a new
+// file, the current file stays in use until the new edition is done.
+func checkForUpdates(l *task.TaskRunner, accountBooks []Book, control *syncControl) {
+	// Books shared by several accounts are only checked once.
+	seen := make(map[string]bool)
+	byAccount := make(map[int][]string)
+	accounts := make(map[int]*entity.Digi4SchoolAccount)
+	for _, book := range accountBooks {
+		if seen[book.DataId] {
+			continue
+		}
+		dbBook := repo.Digi4SchoolBook.GetByBookID(book.DataId)
+		if dbBook == nil || dbBook.State != entity.BookDone || dbBook.FileUUID == nil {
+			continue
+		}
+		seen[book.DataId] = true
+		byAccount[book.Account.ID] = append(byAccount[book.Account.ID], book.DataId)
+		accounts[book.Account.ID] = book.Account
+	}
+
+	l.SetStage("Checking for updates", len(byAccount))
+	checked := 0
+	for accountID, ids := range byAccount {
+		if !l.IsRunning() || control.IsStopRequested() {
+			return
+		}
+		checked++
+		acc := accounts[accountID]
+		l.Info(fmt.Sprintf("Check %d books of account %s for updates", len(ids), acc.Username))
+		metadata, err := fetchMetadata(control.Context(), acc, ids)
+		l.SetProgress(checked, 0)
+		if err != nil {
+			l.Err(fmt.Sprintf("Failed to check books of account %s for updates: %s", acc.Username, err.Error()))
+			continue
+		}
+		for _, meta := range metadata {
+			if err := compareRemote(l, meta); err != nil {
+				l.Err(fmt.Sprintf("Failed to check book %s for updates: %s", meta.Name, err.Error()))
+			}
+		}
+	}
+}
+
+func compareRemote(l *task.TaskRunner, meta downloader.Metadata) error {
+	if meta.Pages <= 0 {
+		return nil
+	}
+	dbBook := repo.Digi4SchoolBook.GetByBookID(meta.DataId)
+	if dbBook == nil || dbBook.FileUUID == nil {
+		return nil
+	}
+
+	// Compare against the count seen at the last check. Books that were never checked
+	// are compared against the downloaded file.
+	known := dbBook.RemotePages
+	if known == 0 {
+		file := repo.FileDocument.GetByUUID(*dbBook.FileUUID)
+		if file == nil {
+			return fmt.Errorf("file %s not found", *dbBook.FileUUID)
+		}
+		known = int(file.Pages)
+	}
+
+	dbBook.RemotePages = meta.Pages
+	if known != meta.Pages {
+		l.Info(fmt.Sprintf("Book %s changed from %d to %d pages, downloading the new edition", dbBook.BookName, known, meta.Pages))
+		dbBook.UpdateAvailable = true
+		dbBook.UpdateFileUUID = uuid.NewString()
+		dbBook.State = entity.BookPending
+	}
+	return repo.Digi4SchoolBook.Save(dbBook)
+}
+
+// fetchMetadata returns the metadata of the books. Books the publisher could not
+// resolve are logged and left out.
+func fetchMetadata(ctx context.Context, acc *entity.Digi4SchoolAccount, ids []string) ([]downloader.Metadata, error) {
+	password, err := accountPassword(acc)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := integration.Metadata(ctx, acc.Username, password, ids)
+	if err != nil && metadata == nil {
+		return nil, err
+	}
+	if err != nil {
+		log.Warnf("metadata of account %s: %v", acc.Username, err)
+	}
+	return metadata, nil
+}
+
+// replaceBookFile moves the documents taken from the book to the new file and removes
+// the old one. If the page count changed, documents with annotations or comments stay on
+// the old file, since they would land on other pages. They are flagged, their owners are
+// notified and the old file is kept for them.
+func replaceBookFile(dbBook *entity.Digi4SchoolBook, newFileUUID string) error {
+	oldFileUUID := *dbBook.FileUUID
+	kept, err := documentsToKeep(oldFileUUID, newFileUUID)
+	if err != nil {
+		return fmt.Errorf("failed to check documents of book %s: %w", dbBook.BookName, err)
+	}
+
+	keep := make([]int, 0, len(kept))
+	for _, doc := range kept {
+		keep = append(keep, doc.ID)
+	}
+	moved, err := repo.Document.ReplaceFile(oldFileUUID, newFileUUID, keep)
+	if err != nil {
+		return fmt.Errorf("failed to move documents of book %s: %w", dbBook.BookName, err)
+	}
+	log.Infof("book %s updated to version %d, moved %d documents, %d annotated documents keep the old edition", dbBook.BookName, dbBook.Version+1, moved, len(kept))
+	dbBook.Version++
+
+	if len(kept) > 0 {
+		if err := repo.Document.FlagOutdatedEdition(keep); err != nil {
+			return fmt.Errorf("failed to flag documents of book %s: %w", dbBook.BookName, err)
+		}
+		for i := range kept {
+			notifyOutdatedEdition(&kept[i], dbBook)
+		}
+		return nil
+	}
+
+	if old := repo.FileDocument.GetByUUID(oldFileUUID); old != nil {
+		if err := repo.FileDocument.DeleteByUUID(oldFileUUID); err != nil {
+			log.Warnf("failed to delete old file %s: %v", oldFileUUID, err)
+			return nil
+		}
+		_ = os.Remove(old.Path)
+		_ = os.Remove(strings.TrimSuffix(old.Path, filepath.Ext(old.Path)) + "_thumb.ptf")
+	}
+	return nil
+}
+
+// documentsToKeep returns the documents of the old file that have to stay on it. Only a
+// changed page count moves annotations to other pages, documents being edited count as
+// annotated since their annotations may not be flushed yet.
+func documentsToKeep(oldFileUUID, newFileUUID string) ([]entity.Document, error) {
+	oldFile := repo.FileDocument.GetByUUID(oldFileUUID)
+	newFile := repo.FileDocument.GetByUUID(newFileUUID)
+	if oldFile == nil || newFile == nil || oldFile.Pages == newFile.Pages {
+		return nil, nil
+	}
+
+	documents, err := repo.Document.GetByFileUUID(oldFileUUID)
+	if err != nil {
+		return nil, err
+	}
+	var kept []entity.Document
+	for _, doc := range documents {
+		annotated, err := isAnnotated(doc)
+		if err != nil {
+			return nil, err
+		}
+		if annotated {
+			kept = append(kept, doc)
+		}
+	}
+	return kept, nil
+}
+
+func isAnnotated(doc entity.Document) (bool, error) {
+	if collabedit.PDFCollab.IsDocumentOpen(doc.UUID) {
+		return true, nil
+	}
+	annotations, err := repo.Annotation.CountByDocument(doc.ID)
+	if err != nil || annotations > 0 {
+		return annotations > 0, err
+	}
+	threads, err := repo.CommentThread.CountByDocument(doc.ID)
+	return threads > 0, err
+}
+
+type bookEditionActionData struct {
+	DocumentID string `json:"documentId"`
+	BookID     string `json:"bookId"`
+}
+
+func notifyOutdatedEdition(doc *entity.Document, dbBook *entity.Digi4SchoolBook) {
+	actionData, err := json.Marshal(bookEditionActionData{DocumentID: doc.UUID, BookID: dbBook.BookID})
+	if err != nil {
+		log.Errorf("failed to encode edition notice of document %s: %v", doc.UUID, err)
+		return
+	}
+	notification := &entity.Notification{
+		Title:      "New edition available",
+		Text:       fmt.Sprintf("%s has a new edition with other pages. %s keeps the old edition so its annotations stay in place.", dbBook.BookName, doc.Name),
+		Action:     entity.BookEdition,
+		ActionData: string(actionData),
+		UserID:     doc.UserID,
+	}
+	if err := repo.Notification.Save(notification); err != nil {
+		log.Errorf("failed to notify user %d about the new edition of %s: %v", doc.UserID, dbBook.BookName, err)
+	}
+}
@@ -0,0 +1,43 @@
+package oidc
+
+import (
+	"paperlink/util"
+	"strings"
+)
+
+var log = util.GroupLog("OIDC")
+
+type Config struct {
+	// Issuer is the base URL of the identity provider. OIDC login is disabled if it is empty.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// UsernameClaim is the ID token claim used as Paperlink username.
+	UsernameClaim string
+	// AutoProvision creates unknown users on their first login instead of rejecting them.
+	AutoProvision bool
+	// GroupsClaim and AdminGroup grant admin rights to members of the given group.
+	// Admin rights are synced on every login if AdminGroup is set.
+	GroupsClaim string
+	AdminGroup  string
+	// PostLoginRedirect is where the browser is sent after a successful login.
+	PostLoginRedirect string
+}
+
+func loadConfig() Config {
+	return Config{
+		Issuer:            strings.TrimSuffix(util.EnvString("PAPERLINK_OIDC_ISSUER", ""), "/"),
+		ClientID:          util.EnvString("PAPERLINK_OIDC_CLIENT_ID", ""),
+		ClientSecret:      util.EnvString("PAPERLINK_OIDC_CLIENT_SECRET", ""),
+		RedirectURL:       util.EnvString("PAPERLINK_OIDC_REDIRECT_URL", ""),
+		Scopes:            util.EnvList("PAPERLINK_OIDC_SCOPES", []string{"openid", "profile", "email"}),
+		UsernameClaim:     util.EnvString("PAPERLINK_OIDC_USERNAME_CLAIM", "preferred_username"),
+		AutoProvision:     util.EnvBool("PAPERLINK_OIDC_AUTO_PROVISION", false),
+		GroupsClaim:       util.EnvString("PAPERLINK_OIDC_GROUPS_CLAIM", "groups"),
+		AdminGroup:        util.EnvString("PAPERLINK_OIDC_ADMIN_GROUP", ""),
+		PostLoginRedirect: util.EnvString("PAPERLINK_OIDC_POST_LOGIN_REDIRECT", "/"),
+	}
+}
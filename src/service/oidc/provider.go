@@ -0,0 +1,283 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrDisabled     = errors.New("oidc login is not configured")
+	ErrInvalidState = errors.New("invalid or expired login state")
+	ErrInvalidToken = errors.New("invalid id token")
+	// ErrBrowserMismatch is returned if the flow is finished in another browser than the
+	// one that started it, e.g. through a link sent by an attacker.
+	ErrBrowserMismatch = errors.New("login was started in another browser")
+)
+
+// FlowTTL is the time a browser has to finish a started flow.
+const FlowTTL = 10 * time.Minute
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+}
+
+// Login is the outcome of a finished authorization code flow.
+type Login struct {
+	Claims jwt.MapClaims
+	// LinkUserID is the user that started the flow to link the identity to their
+	// account, 0 for a login.
+	LinkUserID int
+}
+
+type Provider struct {
+	config Config
+	client *http.Client
+	states *stateStore
+	keys   *keySet
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+}
+
+var provider = newProvider(loadConfig())
+
+func newProvider(config Config) *Provider {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return &Provider{
+		config: config,
+		client: client,
+		states: newStateStore(FlowTTL),
+		keys:   newKeySet(client),
+	}
+}
+
+// Default returns the provider configured through the PAPERLINK_OIDC_* environment variables.
+func Default() *Provider {
+	return provider
+}
+
+func (p *Provider) Enabled() bool {
+	return p.config.Issuer != "" && p.config.ClientID != "" && p.config.RedirectURL != ""
+}
+
+func (p *Provider) Config() Config {
+	return p.config
+}
+
+// AuthCodeURL starts a new PKCE authorization code flow and returns the URL of the identity provider.
+// A linkUserID other than 0 links the identity to that user instead of logging in.
+//
+// The returned binding ties the flow to the browser that started it. It has to be kept in
+// a cookie of that browser and passed to Exchange, the state alone is no proof of it.
+func (p *Provider) AuthCodeURL(ctx context.Context, linkUserID int) (authURL, binding string, err error) {
+	if !p.Enabled() {
+		return "", "", ErrDisabled
+	}
+
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	binding, err = randomString()
+	if err != nil {
+		return "", "", err
+	}
+	p.states.put(state, pendingLogin{
+		Nonce:       nonce,
+		Verifier:    verifier,
+		LinkUserID:  linkUserID,
+		BindingHash: sha256.Sum256([]byte(binding)),
+	})
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("scope", strings.Join(p.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return doc.AuthorizationEndpoint + separator + params.Encode(), binding, nil
+}
+
+// Exchange finishes the flow started by AuthCodeURL and returns the verified ID token claims.
+// binding is the one AuthCodeURL returned to the browser finishing the flow.
+func (p *Provider) Exchange(ctx context.Context, state, code, binding string) (*Login, error) {
+	if !p.Enabled() {
+		return nil, ErrDisabled
+	}
+
+	pending, ok := p.states.take(state)
+	if !ok {
+		return nil, ErrInvalidState
+	}
+	bindingHash := sha256.Sum256([]byte(binding))
+	if binding == "" || subtle.ConstantTimeCompare(bindingHash[:], pending.BindingHash[:]) != 1 {
+		return nil, ErrBrowserMismatch
+	}
+
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", pending.Verifier)
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var tokens tokenResponse
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: token response contains no id_token", ErrInvalidToken)
+	}
+
+	claims, err := p.verifyIDToken(ctx, doc, tokens.IDToken, pending.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	return &Login{Claims: claims, LinkUserID: pending.LinkUserID}, nil
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, doc *discoveryDocument, raw string, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.get(ctx, doc.JWKSURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(doc.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var doc discoveryDocument
+	if err := getJSON(ctx, p.client, p.config.Issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("oidc discovery returned issuer %q, expected %q", doc.Issuer, p.config.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("oidc discovery document is incomplete")
+	}
+
+	p.discovery = &doc
+	return p.discovery, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, target any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(target)
+}
+
+func randomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
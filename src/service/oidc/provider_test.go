@@ -0,0 +1,299 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testClientID = "paperlink"
+
+// mockIdP is an identity provider serving discovery, JWKS and the token endpoint.
+// authorize stands in for the browser login and hands out authorization codes.
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+	// tamperNonce makes the token endpoint issue ID tokens with a foreign nonce.
+	tamperNonce bool
+}
+
+type mockGrant struct {
+	subject   string
+	username  string
+	nonce     string
+	challenge string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key, codes: map[string]mockGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]string{{
+			"kid": "test",
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	if r.PostForm.Get("client_id") != testClientID {
+		http.Error(w, "invalid_client", http.StatusUnauthorized)
+		return
+	}
+
+	idp.mu.Lock()
+	grant, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	tamper := idp.tamperNonce
+	idp.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge {
+		http.Error(w, "invalid_grant", http.StatusBadRequest)
+		return
+	}
+
+	nonce := grant.nonce
+	if tamper {
+		nonce = "foreign"
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                idp.server.URL,
+		"aud":                testClientID,
+		"sub":                grant.subject,
+		"preferred_username": grant.username,
+		"nonce":              nonce,
+		"iat":                time.Now().Unix(),
+		"exp":                time.Now().Add(time.Minute).Unix(),
+	})
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(idp.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]string{"access_token": "access", "token_type": "Bearer", "id_token": idToken})
+}
+
+// authorize logs the subject in at the authorization URL and returns state and code of the redirect.
+func (idp *mockIdP) authorize(t *testing.T, authURL, subject, username string) (string, string) {
+	t.Helper()
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != testClientID {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	code := fmt.Sprintf("code-%d", time.Now().UnixNano())
+	idp.mu.Lock()
+	idp.codes[code] = mockGrant{subject: subject, username: username, nonce: query.Get("nonce"), challenge: query.Get("code_challenge")}
+	idp.mu.Unlock()
+	return query.Get("state"), code
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func newTestProvider(idp *mockIdP, autoProvision bool) *Provider {
+	return newProvider(Config{
+		Issuer:            idp.server.URL,
+		ClientID:          testClientID,
+		RedirectURL:       "http://paperlink.test/api/v1/auth/oidc/callback",
+		Scopes:            []string{"openid"},
+		UsernameClaim:     "preferred_username",
+		AutoProvision:     autoProvision,
+		PostLoginRedirect: "/",
+	})
+}
+
+func login(t *testing.T, idp *mockIdP, provider *Provider, linkUserID int, subject, username string) (*Login, error) {
+	t.Helper()
+
+	authURL, binding, err := provider.AuthCodeURL(context.Background(), linkUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := idp.authorize(t, authURL, subject, username)
+	return provider.Exchange(context.Background(), state, code, binding)
+}
+
+func TestExchangeVerifiesIDToken(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := newTestProvider(idp, false)
+
+	authURL, binding, err := provider.AuthCodeURL(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := idp.authorize(t, authURL, "subject-1", "alice")
+
+	result, err := provider.Exchange(context.Background(), state, code, binding)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if result.Claims["sub"] != "subject-1" || result.LinkUserID != 0 {
+		t.Fatalf("unexpected login %+v", result)
+	}
+
+	if _, err := provider.Exchange(context.Background(), state, code, binding); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("replayed state: got %v, want ErrInvalidState", err)
+	}
+}
+
+func TestExchangeRequiresBrowserBinding(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := newTestProvider(idp, false)
+
+	// The attacker starts a link of their account and hands the URL to the victim,
+	// whose browser has no or another binding cookie.
+	for _, binding := range []string{"", "binding-of-another-flow"} {
+		authURL, _, err := provider.AuthCodeURL(context.Background(), 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state, code := idp.authorize(t, authURL, "victim", "victim")
+
+		if _, err := provider.Exchange(context.Background(), state, code, binding); !errors.Is(err, ErrBrowserMismatch) {
+			t.Fatalf("binding %q: got %v, want ErrBrowserMismatch", binding, err)
+		}
+	}
+}
+
+func TestExchangeRejectsForeignNonce(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.tamperNonce = true
+	provider := newTestProvider(idp, false)
+
+	if _, err := login(t, idp, provider, 0, "subject-1", "alice"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("got %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestUnknownIdentityIsRejected(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := newTestProvider(idp, false)
+
+	result, err := login(t, idp, provider, 0, "subject-unknown", "unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.ResolveUser(result.Claims); !errors.Is(err, ErrUnknownUser) {
+		t.Fatalf("got %v, want ErrUnknownUser", err)
+	}
+}
+
+func TestProvisionDoesNotTakeOverLocalUser(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := newTestProvider(idp, true)
+
+	local := &entity.User{Username: "bob", Password: "x"}
+	if err := repo.User.Save(local); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := login(t, idp, provider, 0, "subject-bob", local.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.ResolveUser(result.Claims); !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("got %v, want ErrUsernameTaken", err)
+	}
+}
+
+func TestLinkExistingUser(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := newTestProvider(idp, false)
+	subject := "subject-carol"
+
+	carol := &entity.User{Username: "carol", Password: "x"}
+	dave := &entity.User{Username: "dave", Password: "x"}
+	if err := repo.User.Save(carol); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.User.Save(dave); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := login(t, idp, provider, carol.ID, subject, "someone-else")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.LinkUserID != carol.ID {
+		t.Fatalf("link flow lost its user: got %d, want %d", result.LinkUserID, carol.ID)
+	}
+	if _, err := provider.LinkUser(result.LinkUserID, result.Claims); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+
+	result, err = login(t, idp, provider, 0, subject, "someone-else")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := provider.ResolveUser(result.Claims)
+	if err != nil {
+		t.Fatalf("linked user not resolved: %v", err)
+	}
+	if user.ID != carol.ID {
+		t.Fatalf("resolved user %d, want %d", user.ID, carol.ID)
+	}
+
+	result, err = login(t, idp, provider, dave.ID, subject, "someone-else")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.LinkUser(result.LinkUserID, result.Claims); !errors.Is(err, ErrAlreadyLinked) {
+		t.Fatalf("got %v, want ErrAlreadyLinked", err)
+	}
+}
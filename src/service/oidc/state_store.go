@@ -0,0 +1,63 @@
+package oidc
+
+import (
+	"sync"
+	"time"
+)
+
+type pendingLogin struct {
+	Nonce      string
+	Verifier   string
+	LinkUserID int
+	// BindingHash is the SHA-256 of the binding kept in the cookie of the browser that
+	// started the flow.
+	BindingHash [32]byte
+	ExpiresAt   time.Time
+}
+
+type stateStore struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	states map[string]pendingLogin
+}
+
+func newStateStore(ttl time.Duration) *stateStore {
+	return &stateStore{
+		ttl:    ttl,
+		states: make(map[string]pendingLogin),
+	}
+}
+
+func (s *stateStore) put(state string, login pendingLogin) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.cleanupExpiredLocked(now)
+	login.ExpiresAt = now.Add(s.ttl)
+	s.states[state] = login
+}
+
+func (s *stateStore) take(state string) (pendingLogin, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	login, ok := s.states[state]
+	if !ok {
+		return pendingLogin{}, false
+	}
+	delete(s.states, state)
+
+	if time.Now().After(login.ExpiresAt) {
+		return pendingLogin{}, false
+	}
+	return login, true
+}
+
+func (s *stateStore) cleanupExpiredLocked(now time.Time) {
+	for state, login := range s.states {
+		if now.After(login.ExpiresAt) {
+			delete(s.states, state)
+		}
+	}
+}
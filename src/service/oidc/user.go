@@ -0,0 +1,127 @@
+package oidc
+
+import (
+	"errors"
+	"fmt"
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownUser   = errors.New("no paperlink user is linked to this identity")
+	ErrUsernameTaken = errors.New("username is already taken by a local user")
+	ErrMissingClaim  = errors.New("required claim missing in id token")
+	ErrAlreadyLinked = errors.New("identity is already linked to another user")
+)
+
+// ResolveUser maps the ID token claims to a Paperlink user. Users are linked through the
+// "sub" claim, either by LinkUser or when they were provisioned. Unknown identities are
+// created if auto provisioning is enabled.
+func (p *Provider) ResolveUser(claims jwt.MapClaims) (*entity.User, error) {
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: sub", ErrMissingClaim)
+	}
+
+	user, err := repo.User.GetUserByOIDCSubject(subject)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if user == nil {
+		if !p.config.AutoProvision {
+			return nil, ErrUnknownUser
+		}
+		user, err = p.provision(subject, claims)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.config.AdminGroup != "" {
+		isAdmin := p.isInAdminGroup(claims)
+		if user.IsAdmin != isAdmin {
+			log.Infof("updating admin rights of %s to %t from group membership", user.Username, isAdmin)
+			user.IsAdmin = isAdmin
+			if err := repo.User.Save(user); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return user, nil
+}
+
+// LinkUser links the identity of the claims to an existing user, so the user can log in
+// through the identity provider afterwards. It replaces an identity linked before.
+func (p *Provider) LinkUser(userID int, claims jwt.MapClaims) (*entity.User, error) {
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: sub", ErrMissingClaim)
+	}
+
+	linked, err := repo.User.GetUserByOIDCSubject(subject)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if linked != nil && linked.ID != userID {
+		return nil, ErrAlreadyLinked
+	}
+
+	user, err := repo.User.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	user.OIDCSubject = subject
+	if err := repo.User.Save(user); err != nil {
+		return nil, err
+	}
+
+	log.Infof("linked user %s to an identity of the identity provider", user.Username)
+	return user, nil
+}
+
+func (p *Provider) provision(subject string, claims jwt.MapClaims) (*entity.User, error) {
+	username, _ := claims[p.config.UsernameClaim].(string)
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, fmt.Errorf("%w: %s", ErrMissingClaim, p.config.UsernameClaim)
+	}
+
+	if repo.User.DoesUserByNameExist(username) {
+		return nil, ErrUsernameTaken
+	}
+
+	user := entity.User{
+		Username:    username,
+		OIDCSubject: subject,
+	}
+	if err := repo.User.Save(&user); err != nil {
+		return nil, err
+	}
+
+	log.Infof("provisioned user %s from identity provider", username)
+	return &user, nil
+}
+
+func (p *Provider) isInAdminGroup(claims jwt.MapClaims) bool {
+	switch groups := claims[p.config.GroupsClaim].(type) {
+	case []any:
+		for _, group := range groups {
+			if name, ok := group.(string); ok && name == p.config.AdminGroup {
+				return true
+			}
+		}
+	case string:
+		for _, name := range strings.Fields(groups) {
+			if name == p.config.AdminGroup {
+				return true
+			}
+		}
+	}
+	return false
+}
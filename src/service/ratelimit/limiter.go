@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"math"
+	"paperlink/util"
+	"sync"
+	"time"
+)
+
+var log = util.GroupLog("RATELIMIT")
+
+type Config struct {
+	// FreeAttempts is the number of failures that are allowed before backoff starts.
+	FreeAttempts int
+	// BaseDelay is the first backoff delay. It doubles with every further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutAfter locks the key for LockoutDuration once this many failures happened. 0 disables lockouts.
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	// ResetAfter forgets the failures of a key if nothing happened for this duration.
+	ResetAfter time.Duration
+}
+
+type entry struct {
+	failures     int
+	blockedUntil time.Time
+	lastFailure  time.Time
+}
+
+type Limiter struct {
+	name    string
+	config  Config
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+func NewLimiter(name string, config Config) *Limiter {
+	return &Limiter{
+		name:    name,
+		config:  config,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Check returns how long the key is still blocked. A zero duration means the request may proceed.
+func (l *Limiter) Check(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.cleanupLocked(now)
+
+	e, ok := l.entries[key]
+	if !ok || !now.Before(e.blockedUntil) {
+		return 0
+	}
+	return e.blockedUntil.Sub(now)
+}
+
+// Fail records a failed attempt for the key and applies backoff or lockout.
+func (l *Limiter) Fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	e, ok := l.entries[key]
+	if !ok {
+		e = &entry{}
+		l.entries[key] = e
+	}
+	e.failures++
+	e.lastFailure = now
+
+	if l.config.LockoutAfter > 0 && e.failures >= l.config.LockoutAfter {
+		e.blockedUntil = now.Add(l.config.LockoutDuration)
+		log.Warnf("%s: locked %s for %s after %d failed attempts", l.name, key, l.config.LockoutDuration, e.failures)
+		return
+	}
+
+	if e.failures <= l.config.FreeAttempts {
+		return
+	}
+
+	exp := e.failures - l.config.FreeAttempts - 1
+	delay := time.Duration(float64(l.config.BaseDelay) * math.Pow(2, float64(exp)))
+	if delay <= 0 || delay > l.config.MaxDelay {
+		delay = l.config.MaxDelay
+	}
+	e.blockedUntil = now.Add(delay)
+	log.Warnf("%s: %d failed attempts for %s, backing off for %s", l.name, e.failures, key, delay)
+}
+
+// Success forgets all recorded failures of the key.
+func (l *Limiter) Success(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, key)
+}
+
+func (l *Limiter) cleanupLocked(now time.Time) {
+	for key, e := range l.entries {
+		if now.After(e.blockedUntil) && now.Sub(e.lastFailure) > l.config.ResetAfter {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// IP throttles authentication attempts per client address with exponential backoff.
+var IP = NewLimiter("ip", Config{
+	FreeAttempts: 5,
+	BaseDelay:    time.Second,
+	MaxDelay:     5 * time.Minute,
+	ResetAfter:   30 * time.Minute,
+})
+
+// Username throttles attempts per account and locks it temporarily after repeated failures.
+var Username = NewLimiter("username", Config{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+	ResetAfter:      30 * time.Minute,
+})
+
+// TOTP throttles the second factor of the login per user. Its failures are only forgotten
+// once a code was accepted, not when the password is entered again.
+var TOTP = NewLimiter("totp", Config{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+	ResetAfter:      30 * time.Minute,
+})
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterBackoff(t *testing.T) {
+	l := NewLimiter("test", Config{
+		FreeAttempts: 2,
+		BaseDelay:    time.Minute,
+		MaxDelay:     4 * time.Minute,
+		ResetAfter:   time.Hour,
+	})
+
+	for i := 0; i < 2; i++ {
+		l.Fail("k")
+		if wait := l.Check("k"); wait != 0 {
+			t.Fatalf("blocked after %d free failures for %s", i+1, wait)
+		}
+	}
+
+	// The delay doubles with every failure after the free ones and is capped at MaxDelay.
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute} {
+		l.Fail("k")
+		wait := l.Check("k")
+		if wait <= want-time.Second || wait > want {
+			t.Fatalf("wait = %s, want about %s", wait, want)
+		}
+	}
+
+	if wait := l.Check("other"); wait != 0 {
+		t.Errorf("unrelated key blocked for %s", wait)
+	}
+}
+
+func TestLimiterLockout(t *testing.T) {
+	l := NewLimiter("test", Config{
+		FreeAttempts:    10,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Second,
+		LockoutAfter:    3,
+		LockoutDuration: time.Hour,
+		ResetAfter:      time.Hour,
+	})
+
+	for i := 0; i < 3; i++ {
+		l.Fail("k")
+	}
+	if wait := l.Check("k"); wait <= 59*time.Minute {
+		t.Errorf("wait = %s, want the lockout of an hour", wait)
+	}
+}
+
+func TestLimiterSuccessResets(t *testing.T) {
+	l := NewLimiter("test", Config{
+		FreeAttempts: 1,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Minute,
+		ResetAfter:   time.Hour,
+	})
+
+	l.Fail("k")
+	l.Fail("k")
+	if l.Check("k") == 0 {
+		t.Fatal("not blocked after exceeding the free attempts")
+	}
+
+	l.Success("k")
+	if wait := l.Check("k"); wait != 0 {
+		t.Errorf("still blocked for %s after success", wait)
+	}
+	l.Fail("k")
+	if wait := l.Check("k"); wait != 0 {
+		t.Errorf("failures before the success still counted, blocked for %s", wait)
+	}
+}
+
+func TestLimiterForgetsIdleKeys(t *testing.T) {
+	l := NewLimiter("test", Config{
+		FreeAttempts: 1,
+		BaseDelay:    time.Millisecond,
+		MaxDelay:     time.Millisecond,
+		ResetAfter:   10 * time.Millisecond,
+	})
+
+	l.Fail("k")
+	l.Fail("k")
+	time.Sleep(20 * time.Millisecond)
+	l.Check("k")
+
+	l.mu.Lock()
+	_, ok := l.entries["k"]
+	l.mu.Unlock()
+	if ok {
+		t.Error("idle key was not forgotten")
+	}
+}
@@ -0,0 +1,108 @@
+package task
+
+import (
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+	"time"
+)
+
+// progressPersistInterval limits how often the progress of a running task is written
+// to the database. The final progress is always stored when the task finishes.
+const progressPersistInterval = 2 * time.Second
+
+// SetStage starts a new stage of the task and resets its progress. Pass 0 as total if
+// the amount of work is not known yet.
+func (tr *TaskRunner) SetStage(stage string, total int) {
+	tr.logMu.Lock()
+	tr.progress = entity.TaskProgress{
+		Stage:          stage,
+		Total:          total,
+		StageStartedAt: time.Now().Unix(),
+	}
+	persist := tr.updateProgressLocked(true)
+	tr.logMu.Unlock()
+
+	if persist {
+		tr.persistProgress()
+	}
+}
+
+// SetProgress updates the progress of the current stage. A total of 0 keeps the total
+// of the stage.
+func (tr *TaskRunner) SetProgress(current, total int) {
+	tr.logMu.Lock()
+	tr.progress.Current = current
+	if total > 0 {
+		tr.progress.Total = total
+	}
+	persist := tr.updateProgressLocked(false)
+	tr.logMu.Unlock()
+
+	if persist {
+		tr.persistProgress()
+	}
+}
+
+// Progress returns the progress of the current stage.
+func (tr *TaskRunner) Progress() entity.TaskProgress {
+	tr.logMu.Lock()
+	defer tr.logMu.Unlock()
+	return tr.progress
+}
+
+// updateProgressLocked derives percentage and ETA and tells the streams. It reports
+// whether the progress is due to be stored, which the caller does after unlocking logMu.
+func (tr *TaskRunner) updateProgressLocked(force bool) bool {
+	p := &tr.progress
+	p.Percent = 0
+	p.ETA = 0
+	if p.Total > 0 {
+		current := min(p.Current, p.Total)
+		p.Percent = float64(current) * 100 / float64(p.Total)
+
+		// Extrapolate the time the stage took so far on the remaining work.
+		elapsed := time.Since(time.Unix(p.StageStartedAt, 0))
+		if current > 0 && current < p.Total {
+			remaining := elapsed * time.Duration(p.Total-current) / time.Duration(current)
+			p.ETA = time.Now().Add(remaining).Unix()
+		}
+	}
+	tr.notifyLocked()
+
+	if !force && time.Since(tr.progressPersisted) < progressPersistInterval {
+		return false
+	}
+	tr.progressPersisted = time.Now()
+	return true
+}
+
+// persistProgress stores the current progress. The write runs without logMu, so the
+// log, the progress and the streams do not wait for the database.
+func (tr *TaskRunner) persistProgress() {
+	tr.persistMu.Lock()
+	defer tr.persistMu.Unlock()
+	if tr.progressFinal {
+		return
+	}
+	// Taken under persistMu, a write never replaces a newer progress.
+	progress := tr.Progress()
+	if err := repo.Task.UpdateProgress(tr.Task.ID, progress); err != nil {
+		log.Warnf("failed to store progress of task %s: %v", tr.Task.ID, err)
+	}
+}
+
+// finalizeProgress stops the progress writes once the task ended. It waits for a write
+// in flight, so it cannot overwrite the final progress stored with the outcome.
+func (tr *TaskRunner) finalizeProgress() {
+	tr.persistMu.Lock()
+	defer tr.persistMu.Unlock()
+	tr.progressFinal = true
+}
+
+// finalProgressLocked is the progress stored once the task ended, the ETA no longer
+// applies then.
+func (tr *TaskRunner) finalProgressLocked() entity.TaskProgress {
+	p := tr.progress
+	p.ETA = 0
+	return p
+}
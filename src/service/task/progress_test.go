@@ -0,0 +1,39 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+)
+
+func TestLateProgressKeepsFinalProgress(t *testing.T) {
+	Init()
+
+	runner, err := Enqueue(Spec{Kind: "test-progress", Name: "progress"}, func(tr *TaskRunner) {
+		tr.SetStage("download", 4)
+		tr.SetProgress(4, 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for runner.IsRunning() || runner.Status() == entity.QUEUED {
+		if time.Now().After(deadline) {
+			t.Fatal("task did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A worker of the task reporting after it completed.
+	runner.SetStage("late", 10)
+
+	stored, err := repo.Task.Get(runner.Task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Progress.Stage != "download" || stored.Progress.Percent != 100 {
+		t.Fatalf("stored progress %+v, want the final download stage", stored.Progress)
+	}
+}
@@ -0,0 +1,151 @@
+package task
+
+import (
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+	"slices"
+	"sync"
+)
+
+// Priorities of queued tasks. Tasks with a higher priority start first, tasks with the
+// same priority in the order they were queued.
+const (
+	PriorityLow    = -10
+	PriorityNormal = 0
+	PriorityHigh   = 10
+)
+
+// DefaultConcurrency is the number of tasks of a group that run at the same time if the
+// group has no limit set.
+const DefaultConcurrency = 1
+
+type queuedTask struct {
+	runner *TaskRunner
+	run    func(*TaskRunner)
+	group  string
+	seq    int
+}
+
+var (
+	queueMu sync.Mutex
+	pending []*queuedTask
+	running = make(map[string]int)
+	limits  = make(map[string]int)
+	seq     int
+)
+
+// SetConcurrency limits how many tasks of the group run at the same time.
+func SetConcurrency(group string, n int) {
+	queueMu.Lock()
+	limits[group] = max(n, 1)
+	queueMu.Unlock()
+	schedule()
+}
+
+// Enqueue creates a QUEUED task and runs it once its group has a free slot. A run that
+// returns without finishing the task completes it.
+func Enqueue(spec Spec, run func(*TaskRunner), stopHandler ...func(*TaskRunner) error) (*TaskRunner, error) {
+	runner, err := createTask(spec, stopHandler...)
+	if err != nil {
+		return nil, err
+	}
+	group := spec.Group
+	if group == "" {
+		group = spec.Kind
+	}
+
+	queueMu.Lock()
+	seq++
+	pending = append(pending, &queuedTask{runner: runner, run: run, group: group, seq: seq})
+	// Stable order: priority first, then the order the tasks were queued in.
+	slices.SortStableFunc(pending, func(a, b *queuedTask) int {
+		if a.runner.Task.Priority != b.runner.Task.Priority {
+			return b.runner.Task.Priority - a.runner.Task.Priority
+		}
+		return a.seq - b.seq
+	})
+	queueMu.Unlock()
+
+	runner.Info("task queued")
+	schedule()
+	return runner, nil
+}
+
+// HasActive reports whether a task of the kind is queued or running.
+func HasActive(kind string) bool {
+	for _, runner := range activeRunners() {
+		if runner.Task.Kind == kind && isActive(runner.Status()) {
+			return true
+		}
+	}
+	return false
+}
+
+// schedule starts every pending task whose group has a free slot.
+func schedule() {
+	queueMu.Lock()
+	var start []*queuedTask
+	pending = slices.DeleteFunc(pending, func(q *queuedTask) bool {
+		if running[q.group] >= limitOf(q.group) {
+			return false
+		}
+		running[q.group]++
+		// Started under the queue lock, so a stop either dequeues the task or sees it
+		// running.
+		q.runner.statusMu.Lock()
+		if err := repo.Task.StartTask(q.runner.Task); err != nil {
+			log.Errorf("failed to store start of task %s: %v", q.runner.Task.ID, err)
+		}
+		q.runner.statusMu.Unlock()
+		start = append(start, q)
+		return true
+	})
+	queueMu.Unlock()
+
+	for _, q := range start {
+		go execute(q)
+	}
+}
+
+func limitOf(group string) int {
+	if n, ok := limits[group]; ok {
+		return n
+	}
+	return DefaultConcurrency
+}
+
+func execute(q *queuedTask) {
+	defer func() {
+		queueMu.Lock()
+		running[q.group]--
+		queueMu.Unlock()
+		schedule()
+	}()
+
+	tr := q.runner
+	tr.notify()
+	tr.Info("task started")
+
+	q.run(tr)
+	if tr.IsRunning() {
+		if err := tr.Complete(); err != nil {
+			log.Errorf("failed to complete task %s: %v", tr.Task.ID, err)
+		}
+	}
+}
+
+// dequeue removes a task that did not start yet from the queue. It returns false if the
+// task already started.
+func dequeue(tr *TaskRunner) bool {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	before := len(pending)
+	pending = slices.DeleteFunc(pending, func(q *queuedTask) bool {
+		return q.runner == tr
+	})
+	return len(pending) < before
+}
+
+func isActive(status entity.TaskStatus) bool {
+	return status == entity.QUEUED || status == entity.RUNNING
+}
@@ -0,0 +1,118 @@
+package task
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"paperlink/db/entity"
+)
+
+// waitFinished waits until the runners left the queue and ran.
+func waitFinished(t *testing.T, runners ...*TaskRunner) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, runner := range runners {
+		for isActive(runner.Status()) {
+			if time.Now().After(deadline) {
+				t.Fatalf("task %s did not finish", runner.Task.Name)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestGroupLimit(t *testing.T) {
+	Init()
+
+	tests := []struct {
+		limit   int
+		tasks   int
+		running int
+	}{
+		{limit: 1, tasks: 2, running: 1},
+		{limit: 2, tasks: 3, running: 2},
+		{limit: 3, tasks: 2, running: 2},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("limit %d", test.limit), func(t *testing.T) {
+			group := fmt.Sprintf("test-limit-%d", test.limit)
+			SetConcurrency(group, test.limit)
+
+			release := make(chan struct{})
+			var runners []*TaskRunner
+			for i := range test.tasks {
+				runner, err := Enqueue(Spec{Kind: "test-limit", Name: fmt.Sprint(i), Group: group}, func(tr *TaskRunner) { <-release })
+				if err != nil {
+					t.Fatal(err)
+				}
+				runners = append(runners, runner)
+			}
+
+			running := 0
+			for _, runner := range runners {
+				if runner.Status() == entity.RUNNING {
+					running++
+				}
+			}
+			if running != test.running {
+				t.Errorf("%d tasks running, want %d", running, test.running)
+			}
+
+			close(release)
+			waitFinished(t, runners...)
+		})
+	}
+}
+
+func TestPriorityOrder(t *testing.T) {
+	Init()
+
+	tests := []struct {
+		name       string
+		priorities []int
+		want       []string
+	}{
+		{"higher first", []int{PriorityLow, PriorityHigh, PriorityNormal}, []string{"1", "2", "0"}},
+		{"same priority in queue order", []int{PriorityNormal, PriorityNormal, PriorityNormal}, []string{"0", "1", "2"}},
+		{"high after normal ones", []int{PriorityNormal, PriorityNormal, PriorityHigh}, []string{"2", "0", "1"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			group := "test-priority-" + test.name
+
+			// Keeps the single slot of the group busy until every task is queued.
+			release := make(chan struct{})
+			blocker, err := Enqueue(Spec{Kind: "test-priority", Name: "blocker", Group: group}, func(tr *TaskRunner) { <-release })
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var mu sync.Mutex
+			var started []string
+			runners := []*TaskRunner{blocker}
+			for i, priority := range test.priorities {
+				spec := Spec{Kind: "test-priority", Name: fmt.Sprint(i), Group: group, Priority: priority}
+				runner, err := Enqueue(spec, func(tr *TaskRunner) {
+					mu.Lock()
+					started = append(started, tr.Task.Name)
+					mu.Unlock()
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				runners = append(runners, runner)
+			}
+
+			close(release)
+			waitFinished(t, runners...)
+			mu.Lock()
+			defer mu.Unlock()
+			if !slices.Equal(started, test.want) {
+				t.Errorf("started %v, want %v", started, test.want)
+			}
+		})
+	}
+}
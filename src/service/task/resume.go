@@ -0,0 +1,84 @@
+package task
+
+import (
+	"fmt"
+	"os"
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+	"sync"
+)
+
+// Resumer starts an interrupted task again with its stored params and returns the id
+// of the new task.
+type Resumer func(params string) (string, error)
+
+var (
+	resumers    = make(map[string]Resumer)
+	interrupted []*entity.Task
+	resumeMu    sync.Mutex
+)
+
+// RegisterResumable declares tasks of the kind as resumable. Tasks of the kind that were
+// interrupted by a restart are started again by ResumeInterrupted.
+func RegisterResumable(kind string, resume Resumer) {
+	resumeMu.Lock()
+	defer resumeMu.Unlock()
+	resumers[kind] = resume
+}
+
+// reconcileOrphans marks the tasks that were still queued or running when the server
+// stopped as interrupted. No task runs yet when it is called, so every such row is an
+// orphan.
+func reconcileOrphans() {
+	tasks, err := repo.Task.ListByStatus(entity.QUEUED, entity.RUNNING)
+	if err != nil {
+		log.Errorf("failed to list orphaned tasks: %v", err)
+		return
+	}
+	for _, t := range tasks {
+		appendLogLine(t.ID, "[WARN] task interrupted by a server restart")
+		if err := repo.Task.InterruptTask(t); err != nil {
+			log.Errorf("failed to mark task %s as interrupted: %v", t.ID, err)
+			continue
+		}
+		log.Warnf("task %s (%s) was interrupted by a server restart", t.Name, t.ID)
+		interrupted = append(interrupted, t)
+	}
+}
+
+// ResumeInterrupted starts the tasks interrupted by the last restart again if their kind
+// is resumable. It has to be called after the services registered their kinds.
+func ResumeInterrupted() {
+	resumeMu.Lock()
+	tasks := interrupted
+	interrupted = nil
+	resumeMu.Unlock()
+
+	for _, t := range tasks {
+		resumeMu.Lock()
+		resume, ok := resumers[t.Kind]
+		resumeMu.Unlock()
+		if !ok {
+			continue
+		}
+
+		id, err := resume(t.Params)
+		if err != nil {
+			appendLogLine(t.ID, fmt.Sprintf("[ERROR] failed to resume task: %v", err))
+			log.Errorf("failed to resume task %s (%s): %v", t.Name, t.ID, err)
+			continue
+		}
+		appendLogLine(t.ID, fmt.Sprintf("[INFO] resumed as task %s", id))
+		log.Infof("resumed task %s (%s) as %s", t.Name, t.ID, id)
+	}
+}
+
+func appendLogLine(taskID, line string) {
+	f, err := os.OpenFile(logFilePath(taskID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		log.Warnf("failed to open log file of task %s: %v", taskID, err)
+		return
+	}
+	defer f.Close()
+	_, _ = f.WriteString(line + "\n")
+}
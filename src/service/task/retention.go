@@ -0,0 +1,78 @@
+package task
+
+import (
+	"os"
+	"paperlink/db/repo"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// SettingRetentionMaxAgeDays removes finished tasks older than the number of days.
+	// 0 keeps them regardless of their age.
+	SettingRetentionMaxAgeDays = "task.retention.max_age_days"
+	// SettingRetentionMaxCount keeps only the newest finished tasks. 0 keeps all of them.
+	SettingRetentionMaxCount = "task.retention.max_count"
+
+	DefaultRetentionMaxAgeDays = 30
+	DefaultRetentionMaxCount   = 500
+
+	cleanupInterval = time.Hour
+)
+
+type Retention struct {
+	MaxAgeDays int64 `json:"maxAgeDays"`
+	MaxCount   int64 `json:"maxCount"`
+}
+
+func CurrentRetention() Retention {
+	return Retention{
+		MaxAgeDays: repo.Setting.GetInt64(SettingRetentionMaxAgeDays, DefaultRetentionMaxAgeDays),
+		MaxCount:   repo.Setting.GetInt64(SettingRetentionMaxCount, DefaultRetentionMaxCount),
+	}
+}
+
+// StartCleanup prunes finished tasks by the retention settings at startup and every hour.
+func StartCleanup() {
+	go func() {
+		for {
+			if removed, err := Prune(CurrentRetention()); err != nil {
+				log.Errorf("failed to prune tasks: %v", err)
+			} else if removed > 0 {
+				log.Infof("pruned %d finished tasks", removed)
+			}
+			time.Sleep(cleanupInterval)
+		}
+	}()
+}
+
+// Prune removes the finished tasks that are older than the retention or exceed its count,
+// together with their log and details files. Queued and running tasks are never removed.
+func Prune(retention Retention) (int, error) {
+	var before int64
+	if retention.MaxAgeDays > 0 {
+		before = time.Now().AddDate(0, 0, -int(retention.MaxAgeDays)).Unix()
+	}
+	ids, err := repo.Task.ListPrunable(before, int(retention.MaxCount))
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if err := repo.Task.DeleteByIDs(ids); err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		removeTaskFiles(id)
+	}
+	return len(ids), nil
+}
+
+func removeTaskFiles(id string) {
+	for _, path := range []string{logFilePath(id), filepath.Join(dataDir, id+".details.json")} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Warnf("failed to remove %s: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package task
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"paperlink/db"
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+)
+
+func TestPrune(t *testing.T) {
+	Init()
+	now := time.Now()
+	daysAgo := func(days int) int64 { return now.AddDate(0, 0, -days).Unix() }
+
+	type stored struct {
+		id     string
+		status entity.TaskStatus
+		end    int64
+	}
+	tasks := []stored{
+		{"queued", entity.QUEUED, 0},
+		{"running", entity.RUNNING, 0},
+		{"new", entity.COMPLETED, daysAgo(1)},
+		{"week", entity.FAILED, daysAgo(7)},
+		{"month", entity.STOPPED, daysAgo(40)},
+		{"year", entity.INTERRUPTED, daysAgo(365)},
+	}
+
+	tests := []struct {
+		name      string
+		retention Retention
+		removed   []string
+	}{
+		{"by age", Retention{MaxAgeDays: 30}, []string{"month", "year"}},
+		{"by count", Retention{MaxCount: 1}, []string{"week", "month", "year"}},
+		{"by age and count", Retention{MaxAgeDays: 5, MaxCount: 3}, []string{"week", "month", "year"}},
+		{"disabled", Retention{}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := db.DB().Where("1 = 1").Delete(&entity.Task{}).Error; err != nil {
+				t.Fatal(err)
+			}
+			for _, task := range tasks {
+				start := task.end
+				if start == 0 {
+					start = daysAgo(400)
+				}
+				err := repo.Task.Save(&entity.Task{ID: task.id, Name: task.id, Status: task.status, StartTime: start, EndTime: task.end})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(logFilePath(task.id), []byte("[INFO] done\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			removed, err := Prune(test.retention)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != len(test.removed) {
+				t.Errorf("removed %d tasks, want %d", removed, len(test.removed))
+			}
+
+			for _, task := range tasks {
+				_, err := repo.Task.Get(task.id)
+				_, fileErr := os.Stat(logFilePath(task.id))
+				want := !slices.Contains(test.removed, task.id)
+				if (err == nil) != want || (fileErr == nil) != want {
+					t.Errorf("task %s: stored %v, log file %v, want both %v", task.id, err == nil, fileErr == nil, want)
+				}
+			}
+		})
+	}
+}
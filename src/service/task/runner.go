@@ -1,20 +1,29 @@
 package task
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"paperlink/db/entity"
 	"paperlink/db/repo"
+	"paperlink/util"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
+var log = util.GroupLog("TASK")
+
+// maxLogLines caps the lines a running task keeps in memory. Older lines are only
+// kept in the log file. At least one line is kept.
+var maxLogLines = max(util.EnvInt("PAPERLINK_TASK_LOG_LINES", 5000), 1)
+
 var (
 	taskStore   = make(map[string]*TaskRunner)
 	taskStoreMu sync.RWMutex
-	dataDir     = "./data/tasks"
+	dataDir     = util.DataPath("tasks")
 )
 
 var (
@@ -23,9 +32,28 @@ var (
 )
 
 type TaskRunner struct {
-	Task        *entity.Task
-	logs        []string
-	logMu       sync.Mutex
+	Task *entity.Task
+	// statusMu guards Task.Status. It is held through every transition, so a task is
+	// started and finished once even if it is stopped while it completes.
+	statusMu sync.Mutex
+	logs     []string
+	// logOffset is the number of lines dropped from the start of logs.
+	logOffset  int
+	details    any
+	detailsRev int
+	progress   entity.TaskProgress
+	// progressPersisted is the last time the progress was written to the database.
+	progressPersisted time.Time
+	// persistMu orders the progress writes, which run outside of logMu. Once
+	// progressFinal is set, the final progress is stored with the outcome instead.
+	persistMu     sync.Mutex
+	progressFinal bool
+	// logFile receives every line as it is logged, so the log survives a crash.
+	logFile *os.File
+	logMu   sync.Mutex
+	// changed is closed and replaced on every change of the log, details, progress or
+	// status, so streams can wait for the next update.
+	changed     chan struct{}
 	stopHandler func(*TaskRunner) error
 	Complete    func() error
 	Fail        func() error
@@ -33,18 +61,40 @@ type TaskRunner struct {
 }
 
 type TaskInfo struct {
-	UUID   string            `json:"uuid"`
-	Name   string            `json:"name"`
-	Status entity.TaskStatus `json:"status"`
-	Lines  []string          `json:"lines,omitempty"`
+	UUID     string              `json:"uuid"`
+	Name     string              `json:"name"`
+	Status   entity.TaskStatus   `json:"status"`
+	Lines    []string            `json:"lines,omitempty"`
+	Details  any                 `json:"details,omitempty"`
+	Progress entity.TaskProgress `json:"progress"`
+}
+
+// Spec describes a new task. Params are stored with the task, a resumable kind is
+// started again with them after a restart.
+type Spec struct {
+	Kind   string
+	Name   string
+	Params any
+	// Group is the concurrency group the task is queued in, it defaults to Kind.
+	Group    string
+	Priority int
 }
 
 func Init() {
 	_ = os.MkdirAll(dataDir, os.ModePerm)
+	reconcileOrphans()
 }
 
-func CreateNewTask(name string, stopHandler ...func(*TaskRunner) error) (*TaskRunner, error) {
-	task, err := repo.Task.StartTask(name)
+func createTask(spec Spec, stopHandler ...func(*TaskRunner) error) (*TaskRunner, error) {
+	params := ""
+	if spec.Params != nil {
+		data, err := json.Marshal(spec.Params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode params of task %s: %w", spec.Name, err)
+		}
+		params = string(data)
+	}
+	task, err := repo.Task.QueueTask(spec.Kind, spec.Name, params, spec.Priority)
 	if err != nil {
 		return nil, err
 	}
@@ -58,6 +108,12 @@ func CreateNewTask(name string, stopHandler ...func(*TaskRunner) error) (*TaskRu
 		Task:        task,
 		logs:        []string{},
 		stopHandler: stopper,
+		changed:     make(chan struct{}),
+	}
+	runner.logFile, err = os.OpenFile(logFilePath(task.ID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		// The log is still written once the task finished.
+		log.Warnf("failed to open log file of task %s: %v", task.ID, err)
 	}
 	runner.Complete = func() error { return completeTask(runner) }
 	runner.Fail = func() error { return failTask(runner) }
@@ -75,84 +131,169 @@ func (tr *TaskRunner) log(level, msg string) {
 	defer tr.logMu.Unlock()
 	line := fmt.Sprintf("[%s] %s", level, msg)
 	tr.logs = append(tr.logs, line)
+	if len(tr.logs) > maxLogLines {
+		// Drop a tenth at once, so the lines are not copied on every append.
+		drop := min(max(len(tr.logs)-maxLogLines, maxLogLines/10), len(tr.logs))
+		tr.logs = append([]string(nil), tr.logs[drop:]...)
+		tr.logOffset += drop
+	}
+	if tr.logFile != nil {
+		if _, err := tr.logFile.WriteString(line + "\n"); err != nil {
+			log.Warnf("failed to write log of task %s: %v", tr.Task.ID, err)
+		}
+	}
+	tr.notifyLocked()
 }
 
 func (tr *TaskRunner) Info(msg string)     { tr.log("INFO", msg) }
 func (tr *TaskRunner) Warn(msg string)     { tr.log("WARN", msg) }
 func (tr *TaskRunner) Err(msg string)      { tr.log("ERROR", msg) }
 func (tr *TaskRunner) Critical(msg string) { tr.log("CRITICAL", msg) }
-func (tr *TaskRunner) ReplaceLastInfo(msg string) {
-	if len(tr.logs) == 0 {
-		return
-	}
-	if strings.Contains(tr.logs[len(tr.logs)-1], "INFO") {
-		tr.logs = tr.logs[:len(tr.logs)-1]
-		tr.Info(msg)
-	}
+
+// SetDetails replaces the structured, task specific state shown next to the log,
+// e.g. the per-book progress of a sync. It has to be JSON serializable.
+func (tr *TaskRunner) SetDetails(details any) {
+	tr.logMu.Lock()
+	defer tr.logMu.Unlock()
+	tr.details = details
+	tr.detailsRev++
+	tr.notifyLocked()
+}
+
+func (tr *TaskRunner) notifyLocked() {
+	close(tr.changed)
+	tr.changed = make(chan struct{})
+}
+
+// notify wakes up the streams after the status changed.
+func (tr *TaskRunner) notify() {
+	tr.logMu.Lock()
+	defer tr.logMu.Unlock()
+	tr.notifyLocked()
 }
 
 func completeTask(tr *TaskRunner) error {
+	tr.statusMu.Lock()
+	defer tr.statusMu.Unlock()
 	if tr.Task.Status != entity.RUNNING {
 		return nil
 	}
+	tr.finalizeProgress()
 	tr.logMu.Lock()
 	lines := append([]string(nil), tr.logs...)
+	details := tr.details
+	tr.Task.Progress = tr.finalProgressLocked()
 	tr.logMu.Unlock()
 
-	if err := writeLogFile(tr.Task.ID, lines); err != nil {
+	if err := tr.closeLog(lines); err != nil {
+		return err
+	}
+	if err := writeDetailsFile(tr.Task.ID, details); err != nil {
 		return err
 	}
 	if err := repo.Task.FinishTask(tr.Task); err != nil {
 		return err
 	}
-	removeTask(tr.Task.ID)
+	tr.finished()
 	return nil
 }
 
 func failTask(tr *TaskRunner) error {
+	tr.statusMu.Lock()
+	defer tr.statusMu.Unlock()
 	if tr.Task.Status != entity.RUNNING {
 		return nil
 	}
+	tr.finalizeProgress()
 	tr.logMu.Lock()
 	lines := append([]string(nil), tr.logs...)
+	details := tr.details
+	tr.Task.Progress = tr.finalProgressLocked()
 	tr.logMu.Unlock()
 
-	if err := writeLogFile(tr.Task.ID, lines); err != nil {
+	if err := tr.closeLog(lines); err != nil {
+		return err
+	}
+	if err := writeDetailsFile(tr.Task.ID, details); err != nil {
 		return err
 	}
 
 	if err := repo.Task.FailTask(tr.Task); err != nil {
 		return err
 	}
-	removeTask(tr.Task.ID)
+	tr.finished()
 	return nil
 }
 
 func stopTask(tr *TaskRunner) error {
-	if tr.Task.Status != entity.RUNNING {
+	// A task still in the queue never starts once it is dequeued.
+	if dequeue(tr) {
+		return cancelQueued(tr)
+	}
+	if !tr.IsRunning() {
 		return ErrTaskNotRunning
 	}
 
+	// The stop handler runs without statusMu, it usually waits for the task to return.
 	if tr.stopHandler != nil {
 		if err := tr.stopHandler(tr); err != nil {
 			tr.Err(fmt.Sprintf("stop handler failed: %v", err))
 		}
 	}
 
+	tr.statusMu.Lock()
+	defer tr.statusMu.Unlock()
+	if tr.Task.Status != entity.RUNNING {
+		// Finished while the stop handler ran.
+		return nil
+	}
+
+	tr.finalizeProgress()
 	tr.logMu.Lock()
 	lines := append([]string(nil), tr.logs...)
+	details := tr.details
+	tr.Task.Progress = tr.finalProgressLocked()
 	tr.logMu.Unlock()
 
-	if err := writeLogFile(tr.Task.ID, lines); err != nil {
+	if err := tr.closeLog(lines); err != nil {
+		return err
+	}
+	if err := writeDetailsFile(tr.Task.ID, details); err != nil {
 		return err
 	}
 	if err := repo.Task.StopTask(tr.Task); err != nil {
 		return err
 	}
-	removeTask(tr.Task.ID)
+	tr.finished()
+	return nil
+}
+
+// cancelQueued stops a task that never started, so there is no stop handler to run.
+func cancelQueued(tr *TaskRunner) error {
+	tr.Warn("task cancelled before it started")
+	tr.statusMu.Lock()
+	defer tr.statusMu.Unlock()
+	tr.logMu.Lock()
+	lines := append([]string(nil), tr.logs...)
+	tr.logMu.Unlock()
+
+	if err := tr.closeLog(lines); err != nil {
+		return err
+	}
+	if err := repo.Task.StopTask(tr.Task); err != nil {
+		return err
+	}
+	tr.finished()
 	return nil
 }
 
+// finished removes the task from the running ones and wakes up its streams.
+// Requires statusMu.
+func (tr *TaskRunner) finished() {
+	removeTask(tr.Task.ID)
+	tr.notify()
+}
+
 func GetTaskInfo(uuid string) (*TaskInfo, error) {
 	taskStoreMu.RLock()
 	runner, ok := taskStore[uuid]
@@ -160,64 +301,50 @@ func GetTaskInfo(uuid string) (*TaskInfo, error) {
 
 	var lines []string
 	var task *entity.Task
+	var status entity.TaskStatus
+
+	var details any
+	var progress entity.TaskProgress
 
 	if ok {
 		runner.logMu.Lock()
 		lines = append([]string(nil), runner.logs...)
+		offset := runner.logOffset
+		details = runner.details
+		progress = runner.progress
 		runner.logMu.Unlock()
 		task = runner.Task
+		status = runner.Status()
+		if offset > 0 {
+			// The head of the log is only on disk.
+			if all, err := readLogFile(uuid); err == nil {
+				lines = all
+			}
+		}
 	} else {
-		filePath := filepath.Join(dataDir, uuid+".log")
-		content, err := os.ReadFile(filePath)
+		var err error
+		lines, err = readLogFile(uuid)
 		if err != nil {
 			return nil, err
 		}
-		raw := strings.TrimSpace(string(content))
-		if raw != "" {
-			lines = strings.Split(raw, "\n")
-		} else {
-			lines = []string{}
-		}
 		task, err = repo.Task.Get(uuid)
 		if err != nil {
 			return nil, err
 		}
+		details = readDetailsFile(uuid)
+		progress = task.Progress
+		status = task.Status
 	}
 
 	return &TaskInfo{
-		UUID:   uuid,
-		Name:   task.Name,
-		Status: task.Status,
-		Lines:  lines,
+		UUID:     uuid,
+		Name:     task.Name,
+		Status:   status,
+		Lines:    lines,
+		Details:  details,
+		Progress: progress,
 	}, nil
 }
-func ListTasks() ([]*TaskInfo, error) {
-	taskStoreMu.RLock()
-	list := make([]*TaskInfo, 0, len(taskStore))
-	for _, runner := range taskStore {
-		list = append(list, &TaskInfo{
-			UUID:   runner.Task.ID,
-			Name:   runner.Task.Name,
-			Status: runner.Task.Status,
-		})
-	}
-	taskStoreMu.RUnlock()
-
-	completedTasks, err := repo.Task.ListCompletedOrFailed()
-	if err != nil {
-		return nil, err
-	}
-	for _, t := range completedTasks {
-		list = append(list, &TaskInfo{
-			UUID:   t.ID,
-			Name:   t.Name,
-			Status: t.Status,
-		})
-	}
-
-	return list, nil
-}
-
 func StopTask(uuid string) error {
 	taskStoreMu.RLock()
 	runner, ok := taskStore[uuid]
@@ -232,12 +359,57 @@ func StopTask(uuid string) error {
 }
 
 func (tr *TaskRunner) IsRunning() bool {
-	return tr.Task.Status == entity.RUNNING
+	return tr.Status() == entity.RUNNING
+}
+
+func (tr *TaskRunner) Status() entity.TaskStatus {
+	tr.statusMu.Lock()
+	defer tr.statusMu.Unlock()
+	return tr.Task.Status
+}
+
+// activeRunners returns the queued and running tasks. Their status is read after
+// taskStoreMu is released, a finishing task holds statusMu while it removes itself.
+func activeRunners() []*TaskRunner {
+	taskStoreMu.RLock()
+	defer taskStoreMu.RUnlock()
+	runners := make([]*TaskRunner, 0, len(taskStore))
+	for _, runner := range taskStore {
+		runners = append(runners, runner)
+	}
+	return runners
+}
+
+// closeLog closes the log file. If it could not be opened, the whole log is written now.
+func (tr *TaskRunner) closeLog(lines []string) error {
+	tr.logMu.Lock()
+	f := tr.logFile
+	tr.logFile = nil
+	tr.logMu.Unlock()
+	if f != nil {
+		return f.Close()
+	}
+	return writeLogFile(tr.Task.ID, lines)
+}
+
+func readLogFile(taskID string) ([]string, error) {
+	content, err := os.ReadFile(logFilePath(taskID))
+	if err != nil {
+		return nil, err
+	}
+	raw := strings.TrimSpace(string(content))
+	if raw == "" {
+		return []string{}, nil
+	}
+	return strings.Split(raw, "\n"), nil
+}
+
+func logFilePath(taskID string) string {
+	return filepath.Join(dataDir, taskID+".log")
 }
 
 func writeLogFile(taskID string, lines []string) error {
-	filePath := filepath.Join(dataDir, taskID+".log")
-	f, err := os.Create(filePath)
+	f, err := os.Create(logFilePath(taskID))
 	if err != nil {
 		return err
 	}
@@ -249,6 +421,25 @@ func writeLogFile(taskID string, lines []string) error {
 	return nil
 }
 
+func writeDetailsFile(taskID string, details any) error {
+	if details == nil {
+		return nil
+	}
+	data, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dataDir, taskID+".details.json"), data, 0o644)
+}
+
+func readDetailsFile(taskID string) any {
+	data, err := os.ReadFile(filepath.Join(dataDir, taskID+".details.json"))
+	if err != nil {
+		return nil
+	}
+	return json.RawMessage(data)
+}
+
 func removeTask(taskID string) {
 	taskStoreMu.Lock()
 	delete(taskStore, taskID)
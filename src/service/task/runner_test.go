@@ -0,0 +1,103 @@
+package task
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"paperlink/db/entity"
+)
+
+// TestStopWhileRunning stops a task while its status is read concurrently. Run with -race.
+func TestStopWhileRunning(t *testing.T) {
+	Init()
+
+	stopped := make(chan struct{})
+	started := make(chan struct{})
+	runner, err := Enqueue(Spec{Kind: "test-stop", Name: "stop while running"}, func(tr *TaskRunner) {
+		close(started)
+		for tr.IsRunning() {
+			time.Sleep(time.Millisecond)
+		}
+		close(stopped)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	var readers sync.WaitGroup
+	done := make(chan struct{})
+	for range 4 {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				HasActive("test-stop")
+				if _, err := GetTaskInfo(runner.Task.ID); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	if err := StopTask(runner.Task.ID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not see the stop")
+	}
+	close(done)
+	readers.Wait()
+
+	if status := runner.Status(); status != entity.STOPPED {
+		t.Errorf("status = %s, want %s", status, entity.STOPPED)
+	}
+	if HasActive("test-stop") {
+		t.Error("stopped task is still active")
+	}
+	if err := StopTask(runner.Task.ID); err != ErrTaskNotRunning {
+		t.Errorf("second stop: got %v, want ErrTaskNotRunning", err)
+	}
+}
+
+func TestStopQueuedTask(t *testing.T) {
+	Init()
+
+	release := make(chan struct{})
+	blocker, err := Enqueue(Spec{Kind: "test-queue", Name: "blocker"}, func(tr *TaskRunner) { <-release })
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran := false
+	queued, err := Enqueue(Spec{Kind: "test-queue", Name: "queued"}, func(tr *TaskRunner) { ran = true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := queued.Status(); status != entity.QUEUED {
+		t.Fatalf("status = %s, want %s", status, entity.QUEUED)
+	}
+	if err := StopTask(queued.Task.ID); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	for blocker.IsRunning() {
+		time.Sleep(time.Millisecond)
+	}
+
+	if ran {
+		t.Error("cancelled task ran")
+	}
+	if status := queued.Status(); status != entity.STOPPED {
+		t.Errorf("status = %s, want %s", status, entity.STOPPED)
+	}
+}
@@ -0,0 +1,136 @@
+package task
+
+import (
+	"context"
+	"paperlink/db/entity"
+	"paperlink/db/repo"
+	"time"
+)
+
+// streamHeartbeat is the interval a stream sends an empty update at, so proxies do not
+// close idle connections.
+const streamHeartbeat = 15 * time.Second
+
+// TaskUpdate is one step of a task stream. Lines are the log lines from Cursor on,
+// the cursor of the next update is Cursor+len(Lines).
+type TaskUpdate struct {
+	Cursor  int               `json:"cursor"`
+	Lines   []string          `json:"lines"`
+	Status  entity.TaskStatus `json:"status"`
+	Details any               `json:"details,omitempty"`
+	// Progress is set if it changed since the last update.
+	Progress *entity.TaskProgress `json:"progress,omitempty"`
+	// Heartbeat is set for the keep-alive updates that carry no change.
+	Heartbeat bool `json:"-"`
+}
+
+// snapshot is the state of a runner a stream has not sent yet.
+type snapshot struct {
+	// first is the index of the first line, it is past the cursor if dropped lines
+	// could not be read from disk.
+	first    int
+	lines    []string
+	details  any
+	rev      int
+	progress entity.TaskProgress
+	changed  <-chan struct{}
+}
+
+// since returns the lines from cursor on, the details if they changed after rev, the
+// progress and the channel that is closed on the next change.
+func (tr *TaskRunner) since(cursor, rev int) snapshot {
+	tr.logMu.Lock()
+	defer tr.logMu.Unlock()
+
+	snap := snapshot{first: cursor, rev: tr.detailsRev, progress: tr.progress, changed: tr.changed}
+	if cursor < tr.logOffset {
+		// The lines before the offset were dropped from memory, read them from disk.
+		all, err := readLogFile(tr.Task.ID)
+		if err == nil && len(all) >= tr.logOffset {
+			snap.lines = append(snap.lines, all[cursor:tr.logOffset]...)
+		} else {
+			snap.first = tr.logOffset
+		}
+		cursor = tr.logOffset
+	}
+	if rel := cursor - tr.logOffset; rel < len(tr.logs) {
+		snap.lines = append(snap.lines, tr.logs[rel:]...)
+	}
+	if tr.detailsRev != rev {
+		snap.details = tr.details
+	}
+	return snap
+}
+
+// StreamTask sends the log of the task from cursor on and every change after that
+// until the task finished or ctx is done. Finished tasks are read from their log file
+// and sent as a single update.
+func StreamTask(ctx context.Context, uuid string, cursor int, send func(TaskUpdate) error) error {
+	if cursor < 0 {
+		cursor = 0
+	}
+
+	taskStoreMu.RLock()
+	runner, ok := taskStore[uuid]
+	taskStoreMu.RUnlock()
+	if !ok {
+		return sendFinished(uuid, cursor, send)
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	rev := 0
+	status := entity.TaskStatus("")
+	var progress entity.TaskProgress
+	for {
+		// The status is read before the log, so the final lines are always sent
+		// together with or before the final status.
+		current := runner.Status()
+		snap := runner.since(cursor, rev)
+		if len(snap.lines) > 0 || snap.first != cursor || snap.rev != rev || current != status || snap.progress != progress {
+			update := TaskUpdate{Cursor: snap.first, Lines: snap.lines, Status: current, Details: snap.details}
+			if snap.progress != progress {
+				update.Progress = &snap.progress
+			}
+			if err := send(update); err != nil {
+				return err
+			}
+			cursor = snap.first + len(snap.lines)
+			rev = snap.rev
+			status = current
+			progress = snap.progress
+		}
+		if !isActive(current) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-snap.changed:
+		case <-heartbeat.C:
+			if err := send(TaskUpdate{Cursor: cursor, Status: status, Heartbeat: true}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func sendFinished(uuid string, cursor int, send func(TaskUpdate) error) error {
+	t, err := repo.Task.Get(uuid)
+	if err != nil || t == nil {
+		return ErrTaskNotFound
+	}
+	info, err := GetTaskInfo(uuid)
+	if err != nil {
+		// Tasks interrupted by a restart never wrote their log file.
+		return send(TaskUpdate{Cursor: cursor, Lines: []string{}, Status: t.Status})
+	}
+
+	lines := []string{}
+	if cursor < len(info.Lines) {
+		lines = info.Lines[cursor:]
+	}
+	return send(TaskUpdate{Cursor: cursor, Lines: lines, Status: info.Status, Details: info.Details, Progress: &info.Progress})
+}
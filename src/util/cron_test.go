@@ -0,0 +1,89 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr           string
+		wantErr        bool
+		domAny, dowAny bool
+	}{
+		{expr: "* * * * *", domAny: true, dowAny: true},
+		{expr: "@daily", domAny: true, dowAny: true},
+		{expr: "0 3 * * 1-5", domAny: true},
+		{expr: "0 0 13 * 5"},
+		{expr: "0 0 */2 * 1", domAny: true},
+		{expr: "0 0 1-31 * 1", domAny: true},
+		{expr: "0 0 1 * 0-6", dowAny: true},
+		{expr: "0 0 1 * 1-7", dowAny: true},
+		{expr: "0,30 8-18/2 1,15 1-12 */2", dowAny: true},
+		{expr: "* * * *", wantErr: true},
+		{expr: "60 * * * *", wantErr: true},
+		{expr: "* 24 * * *", wantErr: true},
+		{expr: "* * 0 * *", wantErr: true},
+		{expr: "* * * 13 *", wantErr: true},
+		{expr: "* * * * 8", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+		{expr: "5-1 * * * *", wantErr: true},
+		{expr: "a * * * *", wantErr: true},
+		{expr: "@sometimes", wantErr: true},
+	}
+	for _, tt := range tests {
+		s, err := ParseCron(tt.expr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseCron(%q) succeeded, want error", tt.expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if s.domAny != tt.domAny || s.dowAny != tt.dowAny {
+			t.Errorf("ParseCron(%q): domAny, dowAny = %t, %t, want %t, %t", tt.expr, s.domAny, s.dowAny, tt.domAny, tt.dowAny)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+
+	// 2026-10-19 is a monday.
+	tests := []struct {
+		expr  string
+		after time.Time
+		want  time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, 10, 19, 10, 7, 30, 0, time.UTC), time.Date(2026, 10, 19, 10, 15, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 19, 10, 15, 0, 0, time.UTC), time.Date(2026, 10, 19, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * 1-5", time.Date(2026, 10, 24, 12, 0, 0, 0, time.UTC), time.Date(2026, 10, 26, 3, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// both day fields restricted: the 13th or a friday
+		{"0 0 13 * 5", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 23, 0, 0, 0, 0, time.UTC)},
+		// a day of month starting with "*" is unrestricted: odd days that are mondays
+		{"0 0 */2 * 1", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), time.Date(2026, 11, 9, 0, 0, 0, 0, time.UTC)},
+		// a range over every day is unrestricted: mondays
+		{"0 0 1-31 * 1", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 26, 0, 0, 0, 0, time.UTC)},
+		// hours start on the half hour in UTC
+		{"0 12 * * *", time.Date(2026, 10, 19, 10, 7, 0, 0, kolkata), time.Date(2026, 10, 19, 12, 0, 0, 0, kolkata)},
+		{"0 0 31 2 *", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+		}
+		if got := s.Next(tt.after); !got.Equal(tt.want) {
+			t.Errorf("%q.Next(%s) = %s, want %s", tt.expr, tt.after, got, tt.want)
+		}
+	}
+}
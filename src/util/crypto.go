@@ -0,0 +1,137 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// encryptedPrefix marks values produced by EncryptString so plaintext can be detected and migrated.
+const encryptedPrefix = "enc:v1:"
+
+var (
+	secretKeyPath = DataPath("secret.key")
+	secretKeyOnce sync.Once
+	secretKeyData []byte
+	secretKeyErr  error
+)
+
+// secretKey returns the 32 byte server key. It is taken from PAPERLINK_SECRET_KEY (base64)
+// or from secret.key in the data directory, which is generated on first use.
+func secretKey() ([]byte, error) {
+	secretKeyOnce.Do(func() {
+		secretKeyData, secretKeyErr = loadSecretKey()
+	})
+	return secretKeyData, secretKeyErr
+}
+
+func loadSecretKey() ([]byte, error) {
+	if encoded := EnvString("PAPERLINK_SECRET_KEY", ""); encoded != "" {
+		return decodeSecretKey(encoded)
+	}
+
+	data, err := os.ReadFile(secretKeyPath)
+	if err == nil {
+		return decodeSecretKey(string(data))
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(secretKeyPath), 0o750); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(secretKeyPath, []byte(base64.StdEncoding.EncodeToString(key)), 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func decodeSecretKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, errors.New("invalid secret key: expected 32 bytes")
+	}
+	return key, nil
+}
+
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// EncryptString encrypts the value with AES-GCM using the server key.
+func EncryptString(plain string) (string, error) {
+	gcm, err := secretGCM()
+	if err != nil {
+		return "", err
+	}
+	return sealString(gcm, plain)
+}
+
+func DecryptString(value string) (string, error) {
+	gcm, err := secretGCM()
+	if err != nil {
+		return "", err
+	}
+	return openString(gcm, value)
+}
+
+func sealString(gcm cipher.AEAD, plain string) (string, error) {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func openString(gcm cipher.AEAD, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return "", errors.New("value is not encrypted")
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("encrypted value too short")
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func secretGCM() (cipher.AEAD, error) {
+	key, err := secretKey()
+	if err != nil {
+		return nil, err
+	}
+	return newGCM(key)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
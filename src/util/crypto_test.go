@@ -0,0 +1,77 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestEncryptStringRoundTrip(t *testing.T) {
+	for _, plain := range []string{"", "secret", "päßwörd with spaces"} {
+		encrypted, err := EncryptString(plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncrypted(encrypted) || strings.Contains(encrypted, "secret") {
+			t.Fatalf("%q encrypted to %q", plain, encrypted)
+		}
+		decrypted, err := DecryptString(encrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decrypted != plain {
+			t.Fatalf("decrypted %q, want %q", decrypted, plain)
+		}
+	}
+}
+
+func TestDecryptStringRejects(t *testing.T) {
+	encrypted, err := EncryptString("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(encrypted, encryptedPrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed[len(sealed)-1] ^= 1
+	tampered := encryptedPrefix + base64.RawStdEncoding.EncodeToString(sealed)
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"plaintext", "secret"},
+		{"tampered ciphertext", tampered},
+		{"truncated", encryptedPrefix + "AAAA"},
+		{"invalid base64", encryptedPrefix + "!!"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := DecryptString(test.value); err == nil {
+				t.Fatalf("decrypted %q", test.value)
+			}
+		})
+	}
+}
+
+func TestDecryptStringWithWrongKey(t *testing.T) {
+	encrypted, err := EncryptString("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openString(gcm, encrypted); err == nil {
+		t.Fatal("decrypted with another key")
+	}
+}
@@ -0,0 +1,27 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// dataDir is the directory the server keeps its database and files in. Test binaries use
+// a new temporary directory, so tests neither leave files next to the sources nor share
+// state between runs.
+var dataDir = sync.OnceValue(func() string {
+	if !testing.Testing() {
+		return "./data"
+	}
+	dir, err := os.MkdirTemp("", "paperlink-test-")
+	if err != nil {
+		panic(err)
+	}
+	return dir
+})
+
+// DataPath joins the elements to a path in the data directory.
+func DataPath(elem ...string) string {
+	return filepath.Join(append([]string{dataDir()}, elem...)...)
+}
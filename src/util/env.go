@@ -0,0 +1,50 @@
+package util
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func EnvString(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && strings.TrimSpace(value) != "" {
+		return strings.TrimSpace(value)
+	}
+	return fallback
+}
+
+func EnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(EnvString(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func EnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(EnvString(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func EnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(EnvString(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// EnvList splits a comma or space separated environment variable.
+func EnvList(key string, fallback []string) []string {
+	value := EnvString(key, "")
+	if value == "" {
+		return fallback
+	}
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
@@ -58,6 +58,26 @@ func GenerateJWT(userID int, name string) (string, string, error) {
 	return accessToken, refreshToken, nil
 }
 
+// GenerateChallengeJWT issues a short-lived token that only proves the password
+// step of a two-factor login succeeded. It can not be used as an access token.
+func GenerateChallengeJWT(userID int, name string) (string, error) {
+	now := time.Now()
+
+	challengeClaims := UserClaims{
+		UserID: userID,
+		Name:   name,
+		Type:   "challenge",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, challengeClaims).
+		SignedString(jwtSecret)
+}
+
 func ParseJWT(tokenStr string) (*UserClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenStr, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -0,0 +1,89 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 test vectors, "12345678901234567890".
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The RFC lists 8 digit codes, the last 6 digits are the 6 digit codes.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(key, uint64(tt.unix/totpPeriod)); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	tests := []struct {
+		name   string
+		offset time.Duration
+		want   bool
+	}{
+		{"current step", 0, true},
+		{"previous step", -totpPeriod * time.Second, true},
+		{"next step", totpPeriod * time.Second, true},
+		{"two steps ago", -2 * totpPeriod * time.Second, false},
+		{"two steps ahead", 2 * totpPeriod * time.Second, false},
+	}
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := totpCode(key, uint64(now.Add(tt.offset).Unix()/totpPeriod))
+			if _, ok := matchTOTPAt(rfc6238Secret, code, now, 0); ok != tt.want {
+				t.Errorf("matchTOTPAt = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchTOTPRejectsReplay(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	counter, ok := matchTOTPAt(rfc6238Secret, "050471", now, 0)
+	if !ok || counter != 1111111111/totpPeriod {
+		t.Fatalf("matchTOTPAt = %d, %v, want step %d", counter, ok, 1111111111/totpPeriod)
+	}
+
+	// The same code within the skew window is rejected once its step was used.
+	if _, ok := matchTOTPAt(rfc6238Secret, "050471", now.Add(totpPeriod*time.Second), counter); ok {
+		t.Error("replayed code was accepted")
+	}
+	// Codes of earlier steps are rejected as well.
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+	previous := totpCode(key, uint64(counter-1))
+	if _, ok := matchTOTPAt(rfc6238Secret, previous, now, counter); ok {
+		t.Error("code of an earlier step was accepted")
+	}
+}
+
+func TestMatchTOTPInvalidInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870820", "abcdef"} {
+		if _, ok := matchTOTPAt(rfc6238Secret, code, now, 0); ok {
+			t.Errorf("code %q was accepted", code)
+		}
+	}
+	if _, ok := matchTOTPAt("not base32!", "287082", now, 0); ok {
+		t.Error("invalid secret was accepted")
+	}
+}